@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/agent"
+	"praktikum-gophkeeper/pkg/cache"
+	"praktikum-gophkeeper/pkg/offline"
+	"praktikum-gophkeeper/pkg/session"
+	pb "praktikum-gophkeeper/proto"
+	"syscall"
+	"time"
+)
+
+const (
+	agentUsage   = "agent [-idle duration] | agent lock"
+	agentTimeout = time.Second
+)
+
+// agentConn is the connection to the agent of the profile. Commands work
+// without an agent, asking for the secrets instead.
+type agentConn struct {
+	client *agent.Client
+	status *pb.StatusResponse
+}
+
+func (c *agentConn) close() {
+	if c != nil && c.client != nil {
+		c.client.Close()
+	}
+}
+
+func (a *app) agentPath() string {
+	return filepath.Join(a.dir, "agent.sock")
+}
+
+// agentConn connects to the agent and fetches its status once.
+func (a *app) agentConn() *agentConn {
+	if a.agent != nil {
+		return a.agent
+	}
+
+	a.agent = &agentConn{}
+	c, err := agent.Dial(a.agentPath())
+	if err != nil {
+		return a.agent
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), agentTimeout)
+	defer cancel()
+
+	resp, err := c.Status(ctx, &pb.StatusRequest{})
+	if err != nil {
+		c.Close()
+		return a.agent
+	}
+	a.agent.client, a.agent.status = c, resp
+
+	return a.agent
+}
+
+// agentSession returns the session the agent holds unless it has expired.
+func (a *app) agentSession() *session.Session {
+	data := a.agentConn().status.GetSession()
+	if len(data) == 0 {
+		return nil
+	}
+
+	s := &session.Session{}
+	if json.Unmarshal(data, s) != nil || s.Expired() {
+		return nil
+	}
+
+	return s
+}
+
+// unlock hands secrets to the agent. The agent is only a convenience, so
+// there is nothing to do without one.
+func (a *app) unlock(req *pb.UnlockRequest) error {
+	c := a.agentConn()
+	if c.client == nil {
+		return agent.ErrNotRunning
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), agentTimeout)
+	defer cancel()
+
+	_, err := c.client.Unlock(ctx, req)
+	return err
+}
+
+// remember hands the session with the PIN or master password it was read
+// with to the agent, which saves the session again once it is refreshed.
+// They are only sent once they have been verified.
+func (a *app) remember(s *session.Session) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+
+	req := &pb.UnlockRequest{
+		Secrets: &pb.Secrets{
+			MasterPassword: a.password,
+			Pin:            a.pin,
+			Session:        data,
+		},
+		SessionPath: a.sessionPath,
+	}
+	if file, ok := a.sessions().(*session.FileStore); ok {
+		req.SessionPin = file.PIN
+	}
+
+	// Commands work without the agent.
+	a.unlock(req)
+}
+
+// openCache opens the local cache at path. With an agent running, the agent
+// opens it and serves it, so that the master password stays there.
+func (a *app) openCache(path string) (offline.Store, error) {
+	c := a.agentConn()
+	if c.client != nil && c.status.GetCachePath() == path {
+		return c.client.Cache(), nil
+	}
+
+	password, err := a.masterPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.unlock(&pb.UnlockRequest{
+		Secrets:   &pb.Secrets{MasterPassword: password},
+		CachePath: path,
+	})
+	if status.Code(err) == codes.PermissionDenied {
+		return nil, cache.ErrWrongPassword
+	}
+	if err != nil {
+		// Commands work without the agent.
+		return cache.Open(path, password)
+	}
+
+	return c.client.Cache(), nil
+}
+
+// saveSession saves a refreshed session. An agent holding the session saves
+// it itself, as it holds the PIN or master password it is protected with.
+func (a *app) saveSession(s *session.Session) error {
+	c := a.agentConn()
+	if len(c.status.GetSession()) == 0 {
+		err := a.sessions().Save(s)
+		if err != nil {
+			return err
+		}
+
+		a.remember(s)
+		return nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), agentTimeout)
+	defer cancel()
+
+	_, err = c.client.SaveSession(ctx, &pb.SaveSessionRequest{Session: data})
+	return err
+}
+
+// forget locks the agent when the session ends.
+func (a *app) forget() {
+	c := a.agentConn()
+	if c.client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), agentTimeout)
+	defer cancel()
+
+	c.client.Lock(ctx, &pb.LockRequest{})
+}
+
+// runAgent serves the agent of the profile until it is interrupted. The
+// agent starts locked and is unlocked by the next command that asks for the
+// master password.
+func runAgent(ctx context.Context, a *app, args []string) error {
+	if len(args) == 1 && args[0] == "lock" {
+		c, err := agent.Dial(a.agentPath())
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		_, err = c.Lock(ctx, &pb.LockRequest{})
+		return err
+	}
+
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	idle := fs.Duration("idle", 15*time.Minute, "Lock after being idle for this long, 0 never locks.")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: " + agentUsage)
+	}
+
+	l, err := agent.Listen(a.agentPath())
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer()
+	agentServer := agent.NewServer(*idle)
+	pb.RegisterAgentServer(server, agentServer)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append(lockSignals, os.Interrupt, syscall.SIGTERM)...)
+	defer signal.Stop(signals)
+
+	go func() {
+		for sig := range signals {
+			agentServer.Lock(ctx, &pb.LockRequest{})
+			if sig == os.Interrupt || sig == syscall.SIGTERM {
+				server.GracefulStop()
+				return
+			}
+		}
+	}()
+
+	fmt.Printf("Agent listening on %s.\n", a.agentPath())
+	return server.Serve(l)
+}
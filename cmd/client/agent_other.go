@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockSignals lock the agent without stopping it.
+var lockSignals []os.Signal
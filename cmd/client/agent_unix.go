@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockSignals lock the agent without stopping it.
+var lockSignals = []os.Signal{syscall.SIGUSR1}
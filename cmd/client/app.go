@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/client"
+	"praktikum-gophkeeper/pkg/offline"
+	"praktikum-gophkeeper/pkg/session"
+	"praktikum-gophkeeper/pkg/tlsconfig"
+)
+
+const defaultAddress = ":8080"
+
+// app holds the client settings and lazily opened connection and cache.
+type app struct {
+	address     string
+	tls         bool
+	caFile      string
+	certFile    string
+	keyFile     string
+	tlsVersion  string
+	tlsCiphers  string
+	login       string
+	token       string
+	sessionPath string
+	cachePath   string
+	// dir keeps the session and cache of the profile.
+	dir      string
+	strategy offline.Strategy
+	profiles *profiles
+
+	store session.Store
+	// sess is the loaded session and sessErr tells why there is none.
+	sess     *session.Session
+	sessErr  error
+	password []byte
+	pin      []byte
+	agent    *agentConn
+	client   *client.Client
+	cache    offline.Store
+}
+
+func defaultPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+
+	return filepath.Join(dir, "gophkeeper", name)
+}
+
+func (a *app) close() {
+	if c, ok := a.cache.(io.Closer); ok {
+		c.Close()
+	}
+	if a.client != nil {
+		a.keepRefreshed()
+		a.client.Close()
+	}
+	a.agent.close()
+}
+
+// sessions returns the store the session is kept in.
+func (a *app) sessions() session.Store {
+	if a.store == nil {
+		a.store = session.Open(a.sessionPath, a.passphrase)
+	}
+
+	return a.store
+}
+
+// session returns the stored session with the token flag applied. A missing
+// or expired session is empty.
+func (a *app) session() (*session.Session, error) {
+	if a.sess != nil {
+		return a.sess, nil
+	}
+
+	s := a.agentSession()
+	if s == nil {
+		var err error
+		s, err = a.sessions().Load()
+		if errors.Is(err, session.ErrNoSession) || errors.Is(err, session.ErrExpired) {
+			s, a.sessErr = &session.Session{}, err
+		} else if err != nil {
+			return nil, err
+		} else {
+			a.remember(s)
+		}
+	}
+
+	if a.token != "" {
+		s.Token = a.token
+	}
+
+	a.sess = s
+	return s, nil
+}
+
+// passphrase asks for the PIN or the master password the session is encrypted with.
+func (a *app) passphrase(pin bool) ([]byte, error) {
+	if !pin {
+		return a.masterPassword()
+	}
+
+	if len(a.pin) == 0 {
+		var err error
+		a.pin, err = readPIN()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a.pin, nil
+}
+
+// masterPassword asks for the master password once, it also opens the cache.
+func (a *app) masterPassword() ([]byte, error) {
+	if len(a.password) == 0 {
+		var err error
+		a.password, err = readMasterPassword()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a.password, nil
+}
+
+// tlsConfig returns nil unless TLS is enabled or certificates are given.
+func (a *app) tlsConfig() (*tls.Config, error) {
+	if !a.tls && a.caFile == "" && a.certFile == "" {
+		return nil, nil
+	}
+
+	opts := tlsconfig.Options{
+		CertFile: a.certFile,
+		KeyFile:  a.keyFile,
+		CAFile:   a.caFile,
+	}
+
+	var err error
+	opts.MinVersion, err = tlsconfig.ParseVersion(a.tlsVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.CipherSuites, err = tlsconfig.ParseCipherSuites(a.tlsCiphers)
+	if err != nil {
+		return nil, err
+	}
+
+	return tlsconfig.Client(opts)
+}
+
+// connect connects to the server the session belongs to unless another address is given.
+func (a *app) connect() (*client.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	s, err := a.session()
+	if err != nil {
+		return nil, err
+	}
+
+	address := a.address
+	if address == "" {
+		address = s.Address
+	}
+	if address == "" {
+		address = defaultAddress
+	}
+
+	tlsConfig, err := a.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config := client.Config{
+		Address: address,
+		TLS:     tlsConfig,
+		Token:   s.Token,
+	}
+	// A token given as a flag isn't refreshed with the one of the session.
+	if a.token == "" {
+		config.RefreshToken = s.RefreshToken
+	}
+
+	a.client, err = client.New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	a.address = address
+	return a.client, nil
+}
+
+// keepRefreshed saves the session again when the client refreshed its token,
+// as the refresh token it was saved with can't be used again.
+func (a *app) keepRefreshed() {
+	if a.sess == nil || a.token != "" || a.sess.RefreshToken == "" || a.client.RefreshToken() == a.sess.RefreshToken {
+		return
+	}
+
+	s := session.New(a.address, a.sess.Login, a.client.Token(), a.client.RefreshToken())
+	err := a.saveSession(s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Couldn't save the refreshed session:", err)
+		return
+	}
+	a.sess = s
+}
+
+// vault opens the local cache of the logged in user, asking for the master
+// password unless the agent has it open.
+func (a *app) vault() (*offline.Vault, offline.Store, error) {
+	s, err := a.session()
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.Token == "" {
+		if a.sessErr != nil {
+			return nil, nil, a.sessErr
+		}
+		return nil, nil, session.ErrNoSession
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if a.cache == nil {
+		path := a.cachePath
+		if path == "" {
+			path = filepath.Join(a.dir, "cache", s.Login+".db")
+		}
+
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		a.cache, err = a.openCache(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return offline.New(conn.GophKeeper(), a.cache, a.strategy), a.cache, nil
+}
+
+// expire removes a stored session whose token the server no longer accepts.
+func (a *app) expire(err error) error {
+	if !errors.Is(err, client.ErrUnauthenticated) || a.token != "" || a.sess == nil || a.sess.Token == "" {
+		return err
+	}
+
+	a.forget()
+	rmErr := a.sessions().Remove()
+	if rmErr != nil {
+		return rmErr
+	}
+
+	return session.ErrExpired
+}
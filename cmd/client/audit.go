@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"praktikum-gophkeeper/pkg/client"
+	pb "praktikum-gophkeeper/proto"
+	"strings"
+	"time"
+)
+
+const auditUsage = "audit [verify]"
+
+// runAudit prints the audit events of the user or verifies their chain.
+func runAudit(ctx context.Context, a *app, args []string) error {
+	if len(args) > 1 || len(args) == 1 && args[0] != "verify" {
+		return errors.New("usage: " + auditUsage)
+	}
+
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	events, err := c.AuditEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if len(events) == 0 {
+			fmt.Println("No audit events.")
+		}
+		for _, e := range events {
+			printAuditEvent(e)
+		}
+
+		return nil
+	}
+
+	n, err := client.VerifyAudit(events)
+	if err != nil {
+		return fmt.Errorf("audit log was tampered with: %w", err)
+	}
+
+	fmt.Printf("Audit log of %d events is unbroken, the server verifies that none was altered.\n", n)
+	return nil
+}
+
+// printAuditEvent prints an event like
+// "12 2023-01-02 15:04:05 get password 6ba7b810-... OK from 127.0.0.1, session 1f2e...".
+func printAuditEvent(e *pb.AuditEvent) {
+	what := strings.ToLower(strings.TrimPrefix(e.GetAction().String(), "AUDIT_ACTION_"))
+	if e.GetItemType() != pb.ItemType_ITEM_TYPE_UNSPECIFIED {
+		what += " " + strings.ToLower(strings.TrimPrefix(e.GetItemType().String(), "ITEM_TYPE_"))
+	}
+	if len(e.GetItemIds()) > 0 {
+		what += " " + strings.Join(e.GetItemIds(), ",")
+	}
+
+	fmt.Printf("%d %s %s %s from %s, session %s\n",
+		e.GetSeq(),
+		e.GetCreatedAt().AsTime().Local().Format(time.DateTime),
+		what,
+		e.GetOutcome(),
+		e.GetIp(),
+		e.GetSession(),
+	)
+}
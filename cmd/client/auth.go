@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"praktikum-gophkeeper/pkg/client"
+	"praktikum-gophkeeper/pkg/session"
+	pb "praktikum-gophkeeper/proto"
+)
+
+// readUser reads the credentials and whether the session is protected with a PIN.
+func readUser(name, defaultLogin string, args []string) (*pb.User, bool, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	login := fs.String("u", defaultLogin, "Login, the profile's by default.")
+	pin := fs.Bool("pin", false, "Protect the stored session with a PIN instead of the master password.")
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, false, err
+	}
+
+	user := &pb.User{Login: *login}
+	if user.Login == "" {
+		user.Login, err = readLine("Login")
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	user.Password, err = readSecret("Password")
+	if err != nil {
+		return nil, false, err
+	}
+
+	if user.Login == "" || user.Password == "" {
+		return nil, false, errors.New("login and password are required")
+	}
+
+	return user, *pin, nil
+}
+
+func runRegister(ctx context.Context, a *app, args []string) error {
+	user, pin, err := readUser("register", a.login, args)
+	if err != nil {
+		return err
+	}
+
+	conn, err := a.connectReplacing()
+	if err != nil {
+		return err
+	}
+
+	err = conn.Register(ctx, user.Login, user.Password)
+	if err != nil {
+		return err
+	}
+
+	return a.startSession(user.Login, conn.Token(), conn.RefreshToken(), pin)
+}
+
+func runLogin(ctx context.Context, a *app, args []string) error {
+	user, pin, err := readUser("login", a.login, args)
+	if err != nil {
+		return err
+	}
+
+	conn, err := a.connectReplacing()
+	if err != nil {
+		return err
+	}
+
+	err = conn.Login(ctx, user.Login, user.Password)
+	if err != nil {
+		return err
+	}
+
+	return a.startSession(user.Login, conn.Token(), conn.RefreshToken(), pin)
+}
+
+// connectReplacing connects like connect, but a session that can't be
+// decrypted only loses its address since it is about to be replaced.
+func (a *app) connectReplacing() (*client.Client, error) {
+	_, err := a.session()
+	if errors.Is(err, session.ErrWrongPassphrase) {
+		a.sess, a.password = &session.Session{}, nil
+	}
+
+	return a.connect()
+}
+
+// startSession stores the session encrypted with the PIN or the master
+// password, unless it goes to the Secret Service.
+func (a *app) startSession(login, token, refreshToken string, pin bool) error {
+	store := a.sessions()
+	if file, ok := store.(*session.FileStore); ok {
+		file.PIN = pin
+	}
+
+	s := session.New(a.address, login, token, refreshToken)
+	err := store.Save(s)
+	if err != nil {
+		return err
+	}
+	a.sess = s
+	a.remember(s)
+
+	fmt.Printf("Logged in as %s.\n", login)
+	return nil
+}
+
+// runLogout forgets the session. The local cache is kept for the next login.
+func runLogout(_ context.Context, a *app, _ []string) error {
+	a.forget()
+	return a.sessions().Remove()
+}
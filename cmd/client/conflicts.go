@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"praktikum-gophkeeper/pkg/offline"
+	pb "praktikum-gophkeeper/proto"
+	"strconv"
+	"strings"
+)
+
+const conflictsUsage = "conflicts [-show] [resolve <number> <server|client|latest|both|merge>]"
+
+// runConflicts lists conflicts left by sync or resolves one of them. The
+// listed items are only shown with their secrets when asked for.
+func runConflicts(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("conflicts", flag.ContinueOnError)
+	show := fs.Bool("show", false, "Show both versions of the items with their secrets.")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	vault, c, err := a.vault()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		conflicts, err := c.Conflicts()
+		if err != nil {
+			return err
+		}
+
+		if len(conflicts) == 0 {
+			fmt.Println("No conflicts.")
+		}
+		for _, conflict := range conflicts {
+			printConflict(conflict, *show)
+		}
+
+		return nil
+	}
+
+	if len(args) != 3 || args[0] != "resolve" {
+		return errors.New("usage: " + conflictsUsage)
+	}
+
+	seq, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return errors.New("usage: " + conflictsUsage)
+	}
+
+	strategy, err := offline.ParseStrategy(args[2])
+	if err != nil {
+		return err
+	}
+
+	return vault.Resolve(ctx, seq, strategy)
+}
+
+func printConflict(conflict *pb.Conflict, show bool) {
+	local, current := conflict.GetOperation().GetItem(), conflict.GetCurrent()
+
+	fmt.Printf("Conflict %d: %s: %s\n", conflict.GetSeq(), describe(conflict.GetOperation()), conflict.GetReason())
+	if show {
+		fmt.Printf("  local:  %s\n", local.String())
+		if current != nil {
+			fmt.Printf("  server: %s\n", current.String())
+		}
+		return
+	}
+
+	if title := offline.Title(local); title != "" {
+		fmt.Printf("  local:  %q\n", title)
+	}
+	if current != nil {
+		fmt.Printf("  server: %q\n", offline.Title(current))
+	}
+	if changed := offline.ChangedFields(current, local); len(changed) != 0 {
+		fmt.Printf("  changed: %s\n", strings.Join(changed, ", "))
+	}
+}
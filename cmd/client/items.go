@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"os"
+	"praktikum-gophkeeper/pkg/offline"
+	pb "praktikum-gophkeeper/proto"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// field is an item field set with a flag, or prompted for without echo when it is secret.
+type field struct {
+	name   string
+	secret bool
+	get    func(*pb.Change) string
+	set    func(*pb.Change, string)
+}
+
+// content is the body of texts and binaries, which is read from and written to files.
+type content struct {
+	get func(*pb.Change) []byte
+	set func(*pb.Change, []byte)
+}
+
+// kind describes an item type for the item commands.
+type kind struct {
+	name     string
+	itemType pb.ItemType
+	newItem  func() *pb.Change
+	// fields start with the title, which is required.
+	fields  []field
+	content *content
+	common  func(*pb.Change) (tags *[]string, metadata *[]*pb.Metadata, folderID *uint32)
+}
+
+var passwordKind = &kind{
+	name:     "password",
+	itemType: pb.ItemType_ITEM_TYPE_PASSWORD,
+	newItem: func() *pb.Change {
+		return &pb.Change{Item: &pb.Change_Password{Password: &pb.Password{}}}
+	},
+	fields: []field{
+		{
+			name: "website",
+			get:  func(c *pb.Change) string { return c.GetPassword().GetWebsite() },
+			set:  func(c *pb.Change, v string) { c.GetPassword().Website = v },
+		},
+		{
+			name: "login",
+			get:  func(c *pb.Change) string { return c.GetPassword().GetLogin() },
+			set:  func(c *pb.Change, v string) { c.GetPassword().Login = v },
+		},
+		{
+			name:   "password",
+			secret: true,
+			get:    func(c *pb.Change) string { return c.GetPassword().GetPassword() },
+			set:    func(c *pb.Change, v string) { c.GetPassword().Password = v },
+		},
+	},
+	common: func(c *pb.Change) (*[]string, *[]*pb.Metadata, *uint32) {
+		x := c.GetPassword()
+		return &x.Tags, &x.Metadata, &x.FolderId
+	},
+}
+
+var textKind = &kind{
+	name:     "text",
+	itemType: pb.ItemType_ITEM_TYPE_TEXT,
+	newItem: func() *pb.Change {
+		return &pb.Change{Item: &pb.Change_Text{Text: &pb.Text{}}}
+	},
+	fields: []field{
+		{
+			name: "title",
+			get:  func(c *pb.Change) string { return c.GetText().GetTitle() },
+			set:  func(c *pb.Change, v string) { c.GetText().Title = v },
+		},
+	},
+	content: &content{
+		get: func(c *pb.Change) []byte { return []byte(c.GetText().GetText()) },
+		set: func(c *pb.Change, v []byte) { c.GetText().Text = string(v) },
+	},
+	common: func(c *pb.Change) (*[]string, *[]*pb.Metadata, *uint32) {
+		x := c.GetText()
+		return &x.Tags, &x.Metadata, &x.FolderId
+	},
+}
+
+var binaryKind = &kind{
+	name:     "binary",
+	itemType: pb.ItemType_ITEM_TYPE_BINARY,
+	newItem: func() *pb.Change {
+		return &pb.Change{Item: &pb.Change_Binary{Binary: &pb.Binary{}}}
+	},
+	fields: []field{
+		{
+			name: "title",
+			get:  func(c *pb.Change) string { return c.GetBinary().GetTitle() },
+			set:  func(c *pb.Change, v string) { c.GetBinary().Title = v },
+		},
+	},
+	content: &content{
+		get: func(c *pb.Change) []byte { return c.GetBinary().GetFile() },
+		set: func(c *pb.Change, v []byte) { c.GetBinary().File = v },
+	},
+	common: func(c *pb.Change) (*[]string, *[]*pb.Metadata, *uint32) {
+		x := c.GetBinary()
+		return &x.Tags, &x.Metadata, &x.FolderId
+	},
+}
+
+var cardKind = &kind{
+	name:     "card",
+	itemType: pb.ItemType_ITEM_TYPE_PAYMENT,
+	newItem: func() *pb.Change {
+		return &pb.Change{Item: &pb.Change_Payment{Payment: &pb.Payment{}}}
+	},
+	fields: []field{
+		{
+			name: "name",
+			get:  func(c *pb.Change) string { return c.GetPayment().GetName() },
+			set:  func(c *pb.Change, v string) { c.GetPayment().Name = v },
+		},
+		{
+			name: "cardholder",
+			get:  func(c *pb.Change) string { return c.GetPayment().GetCardholder() },
+			set:  func(c *pb.Change, v string) { c.GetPayment().Cardholder = v },
+		},
+		{
+			name: "exp",
+			get:  func(c *pb.Change) string { return c.GetPayment().GetExpDate() },
+			set:  func(c *pb.Change, v string) { c.GetPayment().ExpDate = v },
+		},
+		{
+			name:   "number",
+			secret: true,
+			get:    func(c *pb.Change) string { return c.GetPayment().GetNumber() },
+			set:    func(c *pb.Change, v string) { c.GetPayment().Number = v },
+		},
+		{
+			name:   "code",
+			secret: true,
+			get:    func(c *pb.Change) string { return c.GetPayment().GetCode() },
+			set:    func(c *pb.Change, v string) { c.GetPayment().Code = v },
+		},
+	},
+	common: func(c *pb.Change) (*[]string, *[]*pb.Metadata, *uint32) {
+		x := c.GetPayment()
+		return &x.Tags, &x.Metadata, &x.FolderId
+	},
+}
+
+var kinds = []*kind{passwordKind, textKind, binaryKind, cardKind}
+
+func kindUsage(k *kind) string {
+	return k.name + " add|get|list|update|delete [flags] [id or " + k.fields[0].name + "]"
+}
+
+func (k *kind) run(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: " + kindUsage(k))
+	}
+
+	switch args[0] {
+	case "add":
+		return k.add(ctx, a, args[1:])
+	case "get":
+		return k.get(ctx, a, args[1:])
+	case "list":
+		return k.list(ctx, a, args[1:])
+	case "update":
+		return k.update(ctx, a, args[1:])
+	case "delete":
+		return k.delete(ctx, a, args[1:])
+	default:
+		return errors.New("usage: " + kindUsage(k))
+	}
+}
+
+// metadataFlag collects repeated -meta key=value flags.
+type metadataFlag []*pb.Metadata
+
+func (m *metadataFlag) String() string {
+	pairs := make([]string, 0, len(*m))
+	for _, entry := range *m {
+		pairs = append(pairs, entry.GetKey()+"="+entry.GetValue())
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (m *metadataFlag) Set(value string) error {
+	key, val, _ := strings.Cut(value, "=")
+	if key == "" {
+		return errors.New("metadata must look like key=value")
+	}
+
+	*m = append(*m, &pb.Metadata{Key: key, Value: val})
+	return nil
+}
+
+// itemFlags are the flags of add and update.
+type itemFlags struct {
+	fs       *flag.FlagSet
+	fields   map[string]*string
+	tags     *string
+	metadata metadataFlag
+	folderID *uint
+	in       *string
+	secrets  *bool
+}
+
+func (k *kind) flags(command string) *itemFlags {
+	f := &itemFlags{
+		fs:     flag.NewFlagSet(k.name+" "+command, flag.ContinueOnError),
+		fields: map[string]*string{},
+	}
+
+	for _, fd := range k.fields {
+		if !fd.secret {
+			f.fields[fd.name] = f.fs.String(fd.name, "", capitalize(fd.name)+".")
+		}
+	}
+
+	f.tags = f.fs.String("tags", "", "Comma-separated tags.")
+	f.fs.Var(&f.metadata, "meta", "Metadata as key=value, may be repeated.")
+	if command == "add" {
+		f.folderID = f.fs.Uint("folder", 0, "Folder id.")
+	}
+	if k.content != nil {
+		f.in = f.fs.String("in", "", "File to read the content from, standard input when empty.")
+	}
+	if command == "update" && k.hasSecrets() {
+		f.secrets = f.fs.Bool("secrets", false, "Ask for new secret values.")
+	}
+
+	return f
+}
+
+func capitalize(s string) string {
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func (k *kind) hasSecrets() bool {
+	for _, fd := range k.fields {
+		if fd.secret {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply sets item fields from flags. Only flags given on the command line
+// are applied unless all is set.
+func (k *kind) apply(item *pb.Change, f *itemFlags, all bool) error {
+	visited := map[string]bool{}
+	f.fs.Visit(func(fl *flag.Flag) {
+		visited[fl.Name] = true
+	})
+
+	for _, fd := range k.fields {
+		if fd.secret {
+			if !all && !*f.secrets {
+				continue
+			}
+
+			value, err := readSecret(capitalize(fd.name))
+			if err != nil {
+				return err
+			}
+			fd.set(item, value)
+		} else if all || visited[fd.name] {
+			fd.set(item, *f.fields[fd.name])
+		}
+	}
+
+	tags, metadata, folderID := k.common(item)
+	if all || visited["tags"] {
+		*tags = nil
+		for _, tag := range strings.Split(*f.tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				*tags = append(*tags, tag)
+			}
+		}
+	}
+	if all || visited["meta"] {
+		*metadata = f.metadata
+	}
+	if f.folderID != nil {
+		*folderID = uint32(*f.folderID)
+	}
+
+	if k.content != nil && (all || visited["in"]) {
+		data, err := readContent(*f.in)
+		if err != nil {
+			return err
+		}
+		k.content.set(item, data)
+	}
+
+	if k.fields[0].get(item) == "" {
+		return fmt.Errorf("%s is required", k.fields[0].name)
+	}
+
+	return nil
+}
+
+func readContent(path string) ([]byte, error) {
+	if path != "" {
+		return os.ReadFile(path)
+	}
+
+	if isTerminal() {
+		fmt.Fprintln(os.Stderr, "Enter the content, finish with Ctrl-D:")
+	}
+
+	return io.ReadAll(stdin)
+}
+
+func (k *kind) add(ctx context.Context, a *app, args []string) error {
+	f := k.flags("add")
+	err := f.fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	item := k.newItem()
+	item.Type = k.itemType
+	err = k.apply(item, f, true)
+	if err != nil {
+		return err
+	}
+
+	vault, _, err := a.vault()
+	if err != nil {
+		return err
+	}
+
+	queued, err := vault.Add(ctx, item)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(item.GetId())
+	printQueued(queued)
+	return nil
+}
+
+func (k *kind) update(ctx context.Context, a *app, args []string) error {
+	f := k.flags("update")
+	err := f.fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if f.fs.NArg() != 1 {
+		return errors.New("usage: " + k.name + " update [flags] <id or " + k.fields[0].name + ">")
+	}
+
+	vault, _, err := a.vault()
+	if err != nil {
+		return err
+	}
+
+	item, err := k.find(ctx, vault, f.fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	item = proto.Clone(item).(*pb.Change)
+	err = k.apply(item, f, false)
+	if err != nil {
+		return err
+	}
+
+	queued, err := vault.Update(ctx, item)
+	if err != nil {
+		return err
+	}
+
+	printQueued(queued)
+	return nil
+}
+
+func (k *kind) delete(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: " + k.name + " delete <id or " + k.fields[0].name + ">")
+	}
+
+	vault, _, err := a.vault()
+	if err != nil {
+		return err
+	}
+
+	item, err := k.find(ctx, vault, args[0])
+	if err != nil {
+		return err
+	}
+
+	queued, err := vault.Delete(ctx, k.itemType, item.GetId())
+	if err != nil {
+		return err
+	}
+
+	printQueued(queued)
+	return nil
+}
+
+func (k *kind) get(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet(k.name+" get", flag.ContinueOnError)
+	var out *string
+	if k.content != nil {
+		out = fs.String("out", "", "File to write the content to, standard output when empty.")
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: " + k.name + " get [flags] <id or " + k.fields[0].name + ">")
+	}
+
+	vault, _, err := a.vault()
+	if err != nil {
+		return err
+	}
+
+	item, err := k.find(ctx, vault, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "id:\t%s\n", item.GetId())
+	for _, fd := range k.fields {
+		fmt.Fprintf(w, "%s:\t%s\n", fd.name, fd.get(item))
+	}
+
+	tags, metadata, folderID := k.common(item)
+	fmt.Fprintf(w, "tags:\t%s\n", strings.Join(*tags, ", "))
+	for _, entry := range *metadata {
+		fmt.Fprintf(w, "%s:\t%s\n", entry.GetKey(), entry.GetValue())
+	}
+	if *folderID != 0 {
+		fmt.Fprintf(w, "folder:\t%d\n", *folderID)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if k.content == nil {
+		return nil
+	}
+
+	if *out != "" {
+		return os.WriteFile(*out, k.content.get(item), 0600)
+	}
+
+	fmt.Println()
+	_, err = os.Stdout.Write(k.content.get(item))
+	return err
+}
+
+func (k *kind) list(ctx context.Context, a *app, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: " + k.name + " list")
+	}
+
+	vault, _, err := a.vault()
+	if err != nil {
+		return err
+	}
+
+	items, err := vault.List(ctx, k.itemType)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\t%s\tTAGS\tUPDATED\n", strings.ToUpper(k.fields[0].name))
+	for _, item := range items {
+		tags, _, _ := k.common(item)
+
+		updated := ""
+		if t := offline.UpdatedAt(item); t != nil {
+			updated = t.AsTime().Local().Format(time.DateTime)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.GetId(), k.fields[0].get(item), strings.Join(*tags, ","), updated)
+	}
+
+	return w.Flush()
+}
+
+// find looks an item up by id or by title, which has to be unique.
+func (k *kind) find(ctx context.Context, vault *offline.Vault, ref string) (*pb.Change, error) {
+	items, err := vault.List(ctx, k.itemType)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*pb.Change
+	for _, item := range items {
+		if item.GetId() == ref {
+			return item, nil
+		}
+		if k.fields[0].get(item) == ref {
+			found = append(found, item)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%s %q not found", k.name, ref)
+	case 1:
+		return found[0], nil
+	default:
+		return nil, fmt.Errorf("%d items are called %q, use an id", len(found), ref)
+	}
+}
+
+func printQueued(queued bool) {
+	if queued {
+		fmt.Println("Server is unreachable, the change is queued until the next sync.")
+	}
+}
@@ -2,47 +2,133 @@ package main
 
 import (
 	"context"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"flag"
+	"fmt"
 	"log"
-	pb "praktikum-gophkeeper/proto"
+	"os"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/offline"
+	"sort"
 )
 
-func main() {
-	conn, err := grpc.Dial(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Println(err)
-		return
+var (
+	flProfile = flag.String("profile", os.Getenv("GOPHKEEPER_PROFILE"), "Profile to use, the current one by default.")
+	flAddress = flag.String("a", "", "Server's address, defaults to the profile's, the one used for login or :8080.")
+	flTLS     = flag.Bool("tls", false, "Connect over TLS, implied by -ca and -cert.")
+	flCA      = flag.String("ca", "", "CA certificate to verify the server with, system roots by default.")
+	flCert    = flag.String("cert", "", "Client certificate for servers that require one.")
+	flKey     = flag.String("key", "", "Key of the client certificate.")
+	flVersion = flag.String("tls-min-version", "", "Minimum TLS version, 1.2 by default.")
+	flCiphers = flag.String("tls-ciphers", "", "Comma-separated TLS 1.2 cipher suites in order of preference.")
+	flToken   = flag.String("t", os.Getenv("GOPHKEEPER_TOKEN"), "Authorization token, overrides the stored session.")
+	flSession = flag.String("session", "", "Encrypted file the session is stored in when the Secret Service isn't available, in the profile's directory by default.")
+	flCache   = flag.String("c", "", "Local vault cache, a file per login in the profile's directory by default.")
+	flResolve = flag.String("s", "manual", "Conflict resolution strategy: manual, server, client, latest, both or merge.")
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"register":  {"register [-u login] [-pin]", runRegister},
+	"login":     {"login [-u login] [-pin]", runLogin},
+	"logout":    {"logout", runLogout},
+	"password":  {kindUsage(passwordKind), passwordKind.run},
+	"text":      {kindUsage(textKind), textKind.run},
+	"binary":    {kindUsage(binaryKind), binaryKind.run},
+	"card":      {kindUsage(cardKind), cardKind.run},
+	"sync":      {"sync", runSync},
+	"conflicts": {conflictsUsage, runConflicts},
+	"profile":   {profileUsage, runProfile},
+	"agent":     {agentUsage, runAgent},
+	"audit":     {auditUsage, runAudit},
+	"usage":     {"usage", runUsage},
+	"tui":       {"tui", runTUI},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] <command> [args]\n\nCommands:\n", os.Args[0])
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n", commands[name].usage)
 	}
-	defer conn.Close()
 
-	client := pb.NewAuthorizationClient(conn)
-	Test(client)
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
 }
 
-func Test(client pb.AuthorizationClient) {
-	cc := []*pb.User{
-		{Login: "Login1", Password: "Password1"},
-		{Login: "Login2", Password: "Password2"},
-		{Login: "Login3", Password: "Password3"},
-		{Login: "Login1", Password: "Password1"},
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	for _, c := range cc {
-		resp, err := client.RegisterUser(context.Background(), &pb.RegisterUserRequest{User: c})
-		if err != nil {
-			log.Println(err)
-		}
-		log.Println(resp.GetToken())
+	strategy, err := offline.ParseStrategy(*flResolve)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	log.Println("Login")
+	profiles, err := loadProfiles(profilesPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A missing profile can still be fixed with the profile command.
+	name, prof, err := profiles.choose(*flProfile)
+	if err != nil && flag.Arg(0) != "profile" {
+		log.Fatal(err)
+	} else if err != nil {
+		name, prof = defaultProfile, &profile{}
+	}
+
+	// Flags override the profile.
+	a := &app{
+		address:     prof.Address,
+		tls:         prof.TLS || *flTLS,
+		caFile:      prof.CA,
+		certFile:    prof.Cert,
+		keyFile:     prof.Key,
+		tlsVersion:  *flVersion,
+		tlsCiphers:  *flCiphers,
+		login:       prof.Login,
+		token:       *flToken,
+		sessionPath: *flSession,
+		cachePath:   *flCache,
+		dir:         profileDir(name),
+		strategy:    strategy,
+		profiles:    profiles,
+	}
+	if *flAddress != "" {
+		a.address = *flAddress
+	}
+	if *flCA != "" {
+		a.caFile = *flCA
+	}
+	if *flCert != "" {
+		a.certFile, a.keyFile = *flCert, *flKey
+	}
+	if a.sessionPath == "" {
+		a.sessionPath = filepath.Join(a.dir, "session")
+	}
 
-	for _, c := range cc {
-		resp, err := client.LoginUser(context.Background(), &pb.LoginUserRequest{User: c})
-		if err != nil {
-			log.Println(err)
-		}
-		log.Println(resp.GetToken())
+	err = cmd.run(context.Background(), a, flag.Args()[1:])
+	if name := flag.Arg(0); name != "login" && name != "register" {
+		err = a.expire(err)
+	}
+	a.close()
+	if err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/session"
+	"regexp"
+	"sort"
+)
+
+// defaultProfile is used while no profile is chosen.
+const defaultProfile = "default"
+
+const profileUsage = "profile add <name> [-a address] [-tls] [-ca file] [-cert file -key file] [-u login] | list | use <name> | remove <name>"
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// profile is a server and account the client works with. Its session and
+// cache are kept in a directory of their own.
+type profile struct {
+	Address string `json:"address,omitempty"`
+	TLS     bool   `json:"tls,omitempty"`
+	CA      string `json:"ca,omitempty"`
+	Cert    string `json:"cert,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Login   string `json:"login,omitempty"`
+}
+
+// profiles is the client configuration file.
+type profiles struct {
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*profile `json:"profiles"`
+}
+
+func profilesPath() string {
+	return defaultPath("profiles.json")
+}
+
+// profileDir is the directory of the session and cache of a profile.
+func profileDir(name string) string {
+	return defaultPath(filepath.Join("profiles", name))
+}
+
+func loadProfiles(path string) (*profiles, error) {
+	p := &profiles{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = []byte("{}"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read profiles from %s: %w", path, err)
+	}
+	if p.Profiles == nil {
+		p.Profiles = map[string]*profile{}
+	}
+
+	return p, nil
+}
+
+func saveProfiles(path string, p *profiles) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// choose returns the profile with the name, the current one when it is empty.
+func (p *profiles) choose(name string) (string, *profile, error) {
+	if name == "" {
+		name = p.Current
+	}
+	if name == "" {
+		name = defaultProfile
+	}
+
+	prof, ok := p.Profiles[name]
+	if ok {
+		return name, prof, nil
+	}
+	if name == defaultProfile {
+		return name, &profile{}, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown profile %q, see profile list", name)
+}
+
+// runProfile manages profiles.
+func runProfile(_ context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: " + profileUsage)
+	}
+
+	switch args[0] {
+	case "add":
+		return a.addProfile(args[1:])
+	case "list":
+		return a.listProfiles()
+	case "use":
+		if len(args) != 2 {
+			return errors.New("usage: " + profileUsage)
+		}
+		return a.useProfile(args[1])
+	case "remove":
+		if len(args) != 2 {
+			return errors.New("usage: " + profileUsage)
+		}
+		return a.removeProfile(args[1])
+	default:
+		return errors.New("usage: " + profileUsage)
+	}
+}
+
+func (a *app) addProfile(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: " + profileUsage)
+	}
+
+	name := args[0]
+	if !profileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	if _, ok := a.profiles.Profiles[name]; ok {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+
+	prof := &profile{}
+	fs := flag.NewFlagSet("profile add", flag.ContinueOnError)
+	fs.StringVar(&prof.Address, "a", "", "Server's address.")
+	fs.BoolVar(&prof.TLS, "tls", false, "Connect over TLS.")
+	fs.StringVar(&prof.CA, "ca", "", "CA certificate to verify the server with.")
+	fs.StringVar(&prof.Cert, "cert", "", "Client certificate.")
+	fs.StringVar(&prof.Key, "key", "", "Key of the client certificate.")
+	fs.StringVar(&prof.Login, "u", "", "Login.")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []*string{&prof.CA, &prof.Cert, &prof.Key} {
+		if *path == "" {
+			continue
+		}
+
+		*path, err = filepath.Abs(*path)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.profiles.Profiles[name] = prof
+	if a.profiles.Current == "" {
+		a.profiles.Current = name
+	}
+
+	return saveProfiles(profilesPath(), a.profiles)
+}
+
+func (a *app) listProfiles() error {
+	current, _, _ := a.profiles.choose("")
+
+	names := make([]string, 0, len(a.profiles.Profiles))
+	for name := range a.profiles.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		fmt.Println("No profiles.")
+	}
+	for _, name := range names {
+		prof := a.profiles.Profiles[name]
+
+		marker := " "
+		if name == current {
+			marker = "*"
+		}
+
+		address := prof.Address
+		if address == "" {
+			address = defaultAddress
+		}
+		switch {
+		case prof.Cert != "":
+			address += " (mutual TLS)"
+		case prof.TLS || prof.CA != "":
+			address += " (TLS)"
+		}
+
+		fmt.Printf("%s %s\t%s\t%s\n", marker, name, address, prof.Login)
+	}
+
+	return nil
+}
+
+func (a *app) useProfile(name string) error {
+	if _, ok := a.profiles.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q, see profile list", name)
+	}
+
+	a.profiles.Current = name
+	return saveProfiles(profilesPath(), a.profiles)
+}
+
+// removeProfile forgets a profile with its session and local cache.
+func (a *app) removeProfile(name string) error {
+	if _, ok := a.profiles.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q, see profile list", name)
+	}
+
+	dir := profileDir(name)
+	err := session.Open(filepath.Join(dir, "session"), nil).Remove()
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	delete(a.profiles.Profiles, name)
+	if a.profiles.Current == name {
+		a.profiles.Current = ""
+	}
+
+	return saveProfiles(profilesPath(), a.profiles)
+}
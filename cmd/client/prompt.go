@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	envMasterPassword = "GOPHKEEPER_MASTER_PASSWORD"
+	envPIN            = "GOPHKEEPER_PIN"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// readLine asks for a value, reading it from standard input.
+func readLine(prompt string) (string, error) {
+	if isTerminal() {
+		fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readSecret asks for a value without echoing it. Outside a terminal the
+// value is read from standard input like any other line.
+func readSecret(prompt string) (string, error) {
+	if !isTerminal() {
+		return readLine(prompt)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(secret), err
+}
+
+// readMasterPassword takes the master password from the environment or asks for it.
+func readMasterPassword() ([]byte, error) {
+	if password := os.Getenv(envMasterPassword); password != "" {
+		return []byte(password), nil
+	}
+
+	password, err := readSecret("Master password")
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, errors.New("master password is required")
+	}
+
+	return []byte(password), nil
+}
+
+// readPIN takes the PIN protecting the session from the environment or asks for it.
+func readPIN() ([]byte, error) {
+	if pin := os.Getenv(envPIN); pin != "" {
+		return []byte(pin), nil
+	}
+
+	pin, err := readSecret("PIN")
+	if err != nil {
+		return nil, err
+	}
+	if pin == "" {
+		return nil, errors.New("PIN is required")
+	}
+
+	return []byte(pin), nil
+}
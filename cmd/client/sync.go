@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"praktikum-gophkeeper/pkg/offline"
+	pb "praktikum-gophkeeper/proto"
+	"strings"
+)
+
+// runSync replays operations queued while offline and prints conflicts and
+// operations which couldn't be applied.
+func runSync(ctx context.Context, a *app, _ []string) error {
+	vault, c, err := a.vault()
+	if err != nil {
+		return err
+	}
+
+	report, err := vault.Sync(ctx)
+	if offline.IsOffline(err) {
+		pending, err := c.Pending()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Server is unreachable, %d operations are queued.\n", len(pending))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Applied %d queued operations, resolved %d conflicts.\n", report.Applied, report.Resolved)
+	for _, conflict := range report.Conflicts {
+		printConflict(conflict, false)
+	}
+	for _, rejection := range report.Rejected {
+		fmt.Printf("Couldn't %s: %s\n", describe(rejection.Operation), rejection.Reason)
+	}
+
+	return nil
+}
+
+// describe names a queued operation, e.g. "update password 6ba7b810-...".
+func describe(op *pb.PendingOperation) string {
+	item := op.GetItem()
+	return fmt.Sprintf("%s %s %s",
+		strings.ToLower(strings.TrimPrefix(op.GetOperation().String(), "OPERATION_")),
+		strings.ToLower(strings.TrimPrefix(item.GetType().String(), "ITEM_TYPE_")),
+		item.GetId(),
+	)
+}
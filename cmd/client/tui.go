@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"os"
+	"praktikum-gophkeeper/pkg/offline"
+	pb "praktikum-gophkeeper/proto"
+	"strings"
+)
+
+// mask replaces secret values until they are revealed.
+const mask = "••••••••"
+
+var (
+	paneStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	labelStyle  = lipgloss.NewStyle().Bold(true)
+	statusStyle = lipgloss.NewStyle().Faint(true)
+	errorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+var tuiKeys = struct {
+	add, edit, delete, reveal, export, sync key.Binding
+}{
+	add:    key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "add")),
+	edit:   key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit")),
+	delete: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "delete")),
+	reveal: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "reveal")),
+	export: key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "save file")),
+	sync:   key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "sync")),
+}
+
+type mode int
+
+const (
+	modeBrowse mode = iota
+	modeChooseKind
+	modeForm
+	modeConfirmDelete
+	modeExport
+)
+
+// entry is an item of any type shown in the list.
+type entry struct {
+	kind *kind
+	item *pb.Change
+}
+
+func (e entry) Title() string {
+	return e.kind.fields[0].get(e.item)
+}
+
+func (e entry) Description() string {
+	tags, _, _ := e.kind.common(e.item)
+	if len(*tags) == 0 {
+		return e.kind.name
+	}
+
+	return e.kind.name + " · " + strings.Join(*tags, ", ")
+}
+
+func (e entry) FilterValue() string {
+	tags, _, _ := e.kind.common(e.item)
+	return e.kind.name + " " + e.Title() + " " + strings.Join(*tags, " ")
+}
+
+type (
+	loadedMsg struct {
+		entries []list.Item
+		err     error
+	}
+	doneMsg struct {
+		status string
+		err    error
+	}
+)
+
+type tuiModel struct {
+	ctx   context.Context
+	vault *offline.Vault
+
+	mode     mode
+	list     list.Model
+	form     *form
+	path     textinput.Model
+	revealed bool
+	status   string
+	err      error
+
+	width, height int
+}
+
+// runTUI browses and edits the vault in a full-screen terminal UI.
+func runTUI(ctx context.Context, a *app, _ []string) error {
+	if !isTerminal() {
+		return errors.New("tui needs a terminal")
+	}
+
+	vault, _, err := a.vault()
+	if err != nil {
+		return err
+	}
+
+	l := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+	l.Title = "GophKeeper"
+	l.DisableQuitKeybindings()
+	l.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{tuiKeys.add, tuiKeys.edit, tuiKeys.delete, tuiKeys.reveal, tuiKeys.sync}
+	}
+
+	m := &tuiModel{
+		ctx:   ctx,
+		vault: vault,
+		list:  l,
+		path:  textinput.New(),
+	}
+
+	_, err = tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return m.load
+}
+
+// load lists items of every type.
+func (m *tuiModel) load() tea.Msg {
+	var entries []list.Item
+	for _, k := range kinds {
+		items, err := m.vault.List(m.ctx, k.itemType)
+		if err != nil {
+			return loadedMsg{err: err}
+		}
+
+		for _, item := range items {
+			entries = append(entries, entry{kind: k, item: item})
+		}
+	}
+
+	return loadedMsg{entries: entries}
+}
+
+// run performs a vault call in the background and reloads the list afterwards.
+func (m *tuiModel) run(f func() (bool, error), status string) tea.Cmd {
+	return func() tea.Msg {
+		queued, err := f()
+		if queued {
+			status += ", queued until the server is reachable"
+		}
+
+		return doneMsg{status: status, err: err}
+	}
+}
+
+func (m *tuiModel) selected() (entry, bool) {
+	e, ok := m.list.SelectedItem().(entry)
+	return e, ok
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.list.SetSize(msg.Width/2, msg.Height-3)
+		return m, nil
+	case loadedMsg:
+		m.err = msg.err
+		if msg.err != nil {
+			return m, nil
+		}
+		return m, m.list.SetItems(msg.entries)
+	case doneMsg:
+		m.status, m.err = msg.status, msg.err
+		return m, m.load
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+	}
+
+	switch m.mode {
+	case modeChooseKind:
+		return m.updateChooseKind(msg)
+	case modeForm:
+		return m.updateForm(msg)
+	case modeConfirmDelete:
+		return m.updateConfirmDelete(msg)
+	case modeExport:
+		return m.updateExport(msg)
+	default:
+		return m.updateBrowse(msg)
+	}
+}
+
+func (m *tuiModel) updateBrowse(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok || m.list.SettingFilter() {
+		var cmd tea.Cmd
+		m.list, cmd = m.list.Update(msg)
+		return m, cmd
+	}
+
+	e, selected := m.selected()
+	switch {
+	case keyMsg.String() == "q":
+		return m, tea.Quit
+	case key.Matches(keyMsg, tuiKeys.add):
+		m.mode = modeChooseKind
+		return m, nil
+	case key.Matches(keyMsg, tuiKeys.edit) && selected:
+		m.form = newForm(e.kind, e.item)
+		m.mode = modeForm
+		return m, textinput.Blink
+	case key.Matches(keyMsg, tuiKeys.delete) && selected:
+		m.mode = modeConfirmDelete
+		return m, nil
+	case key.Matches(keyMsg, tuiKeys.reveal):
+		m.revealed = !m.revealed
+		return m, nil
+	case key.Matches(keyMsg, tuiKeys.export) && selected && e.kind.content != nil:
+		m.path.SetValue("")
+		m.path.Placeholder = "path"
+		m.path.Focus()
+		m.mode = modeExport
+		return m, textinput.Blink
+	case key.Matches(keyMsg, tuiKeys.sync):
+		return m, m.run(func() (bool, error) {
+			report, err := m.vault.Sync(m.ctx)
+			if err == nil && len(report.Conflicts)+len(report.Rejected) > 0 {
+				err = fmt.Errorf("%d conflicts and %d rejected operations, see the conflicts command",
+					len(report.Conflicts), len(report.Rejected))
+			}
+			return false, err
+		}, "Synced")
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m *tuiModel) updateChooseKind(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	m.mode = modeBrowse
+	for _, k := range kinds {
+		if keyMsg.String() == k.name[:1] {
+			m.form = newForm(k, nil)
+			m.mode = modeForm
+			return m, textinput.Blink
+		}
+	}
+
+	return m, nil
+}
+
+func (m *tuiModel) updateForm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.mode = modeBrowse
+			return m, nil
+		case "ctrl+s":
+			item, err := m.form.result()
+			if err != nil {
+				m.form.err = err
+				return m, nil
+			}
+
+			m.mode = modeBrowse
+			if m.form.original == nil {
+				return m, m.run(func() (bool, error) { return m.vault.Add(m.ctx, item) }, "Added")
+			}
+			return m, m.run(func() (bool, error) { return m.vault.Update(m.ctx, item) }, "Saved")
+		}
+	}
+
+	return m, m.form.update(msg)
+}
+
+func (m *tuiModel) updateConfirmDelete(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	m.mode = modeBrowse
+	e, selected := m.selected()
+	if keyMsg.String() != "y" || !selected {
+		return m, nil
+	}
+
+	return m, m.run(func() (bool, error) {
+		return m.vault.Delete(m.ctx, e.kind.itemType, e.item.GetId())
+	}, "Moved to trash")
+}
+
+func (m *tuiModel) updateExport(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "esc":
+			m.mode = modeBrowse
+			return m, nil
+		case "enter":
+			m.mode = modeBrowse
+			e, selected := m.selected()
+			if !selected {
+				return m, nil
+			}
+
+			path := m.path.Value()
+			return m, m.run(func() (bool, error) {
+				return false, os.WriteFile(path, e.kind.content.get(e.item), 0600)
+			}, "Saved to "+path)
+		}
+	}
+
+	var cmd tea.Cmd
+	m.path, cmd = m.path.Update(msg)
+	return m, cmd
+}
+
+func (m *tuiModel) View() string {
+	var right string
+	switch m.mode {
+	case modeForm:
+		right = m.form.view()
+	case modeChooseKind:
+		right = "Add [p]assword, [t]ext, [b]inary or [c]ard?"
+	default:
+		right = m.detail()
+	}
+
+	paneWidth := m.width - m.width/2 - 4
+	if paneWidth < 0 {
+		paneWidth = 0
+	}
+	body := lipgloss.JoinHorizontal(lipgloss.Top, m.list.View(), paneStyle.Width(paneWidth).Render(right))
+
+	footer := statusStyle.Render(m.status)
+	switch {
+	case m.err != nil:
+		footer = errorStyle.Render(m.err.Error())
+	case m.mode == modeConfirmDelete:
+		footer = "Move to trash? [y/N]"
+	case m.mode == modeExport:
+		footer = "Save to: " + m.path.View()
+	case m.mode == modeForm:
+		footer = statusStyle.Render("tab next field · ctrl+s save · esc cancel")
+	}
+
+	return body + "\n" + footer
+}
+
+// detail shows the selected item with secrets masked unless revealed.
+func (m *tuiModel) detail() string {
+	e, ok := m.selected()
+	if !ok {
+		return "No items."
+	}
+
+	var b strings.Builder
+	for _, fd := range e.kind.fields {
+		value := fd.get(e.item)
+		if fd.secret && !m.revealed {
+			value = mask
+		}
+		fmt.Fprintf(&b, "%s %s\n", labelStyle.Render(fd.name+":"), value)
+	}
+
+	tags, metadata, folderID := e.kind.common(e.item)
+	if len(*tags) > 0 {
+		fmt.Fprintf(&b, "%s %s\n", labelStyle.Render("tags:"), strings.Join(*tags, ", "))
+	}
+	for _, entry := range *metadata {
+		fmt.Fprintf(&b, "%s %s\n", labelStyle.Render(entry.GetKey()+":"), entry.GetValue())
+	}
+	if *folderID != 0 {
+		fmt.Fprintf(&b, "%s %d\n", labelStyle.Render("folder:"), *folderID)
+	}
+	if t := offline.UpdatedAt(e.item); t != nil {
+		fmt.Fprintf(&b, "%s %s\n", labelStyle.Render("updated:"), t.AsTime().Local().Format("2006-01-02 15:04"))
+	}
+
+	switch {
+	case e.kind == binaryKind:
+		fmt.Fprintf(&b, "\n%d bytes, press x to save to a file\n", len(e.kind.content.get(e.item)))
+	case e.kind.content != nil && m.revealed:
+		fmt.Fprintf(&b, "\n%s\n", e.kind.content.get(e.item))
+	case e.kind.content != nil:
+		fmt.Fprintf(&b, "\n%s\n", mask)
+	}
+
+	return b.String()
+}
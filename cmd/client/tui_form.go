@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/protobuf/proto"
+	"os"
+	pb "praktikum-gophkeeper/proto"
+	"strings"
+)
+
+// form adds or edits an item: an input per field, tags, the file of a binary
+// and the body of a text.
+type form struct {
+	kind *kind
+	// original is the edited item, nil when a new one is added.
+	original *pb.Change
+
+	labels []string
+	inputs []textinput.Model
+	area   *textarea.Model
+	focus  int
+	err    error
+}
+
+const (
+	tagsLabel = "tags"
+	fileLabel = "file"
+)
+
+func newForm(k *kind, original *pb.Change) *form {
+	f := &form{
+		kind:     k,
+		original: original,
+	}
+
+	for _, fd := range k.fields {
+		input := textinput.New()
+		if fd.secret {
+			input.EchoMode = textinput.EchoPassword
+		}
+		if original != nil {
+			input.SetValue(fd.get(original))
+		}
+
+		f.labels = append(f.labels, fd.name)
+		f.inputs = append(f.inputs, input)
+	}
+
+	tags := textinput.New()
+	tags.Placeholder = "comma-separated"
+	if original != nil {
+		value, _, _ := k.common(original)
+		tags.SetValue(strings.Join(*value, ", "))
+	}
+	f.labels = append(f.labels, tagsLabel)
+	f.inputs = append(f.inputs, tags)
+
+	switch {
+	case k == binaryKind:
+		file := textinput.New()
+		file.Placeholder = "path to upload"
+		if original != nil {
+			file.Placeholder = "path to replace the file, empty keeps it"
+		}
+		f.labels = append(f.labels, fileLabel)
+		f.inputs = append(f.inputs, file)
+	case k.content != nil:
+		area := textarea.New()
+		if original != nil {
+			area.SetValue(string(k.content.get(original)))
+		}
+		f.area = &area
+	}
+
+	f.inputs[0].Focus()
+	return f
+}
+
+// size counts the inputs and the text area.
+func (f *form) size() int {
+	if f.area != nil {
+		return len(f.inputs) + 1
+	}
+
+	return len(f.inputs)
+}
+
+func (f *form) setFocus(i int) tea.Cmd {
+	f.focus = (i + f.size()) % f.size()
+
+	for j := range f.inputs {
+		f.inputs[j].Blur()
+	}
+	if f.area != nil {
+		f.area.Blur()
+	}
+
+	if f.focus < len(f.inputs) {
+		return f.inputs[f.focus].Focus()
+	}
+
+	return f.area.Focus()
+}
+
+func (f *form) update(msg tea.Msg) tea.Cmd {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "tab":
+			return f.setFocus(f.focus + 1)
+		case "shift+tab":
+			return f.setFocus(f.focus - 1)
+		case "enter":
+			if f.focus < len(f.inputs) {
+				return f.setFocus(f.focus + 1)
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	if f.focus < len(f.inputs) {
+		f.inputs[f.focus], cmd = f.inputs[f.focus].Update(msg)
+	} else {
+		*f.area, cmd = f.area.Update(msg)
+	}
+
+	return cmd
+}
+
+// result builds the item from the form.
+func (f *form) result() (*pb.Change, error) {
+	var item *pb.Change
+	if f.original != nil {
+		item = proto.Clone(f.original).(*pb.Change)
+	} else {
+		item = f.kind.newItem()
+		item.Type = f.kind.itemType
+	}
+
+	for i, fd := range f.kind.fields {
+		fd.set(item, f.inputs[i].Value())
+	}
+	if f.kind.fields[0].get(item) == "" {
+		return nil, fmt.Errorf("%s is required", f.kind.fields[0].name)
+	}
+
+	tags, _, _ := f.kind.common(item)
+	*tags = nil
+	for i, label := range f.labels {
+		switch label {
+		case tagsLabel:
+			for _, tag := range strings.Split(f.inputs[i].Value(), ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					*tags = append(*tags, tag)
+				}
+			}
+		case fileLabel:
+			path := f.inputs[i].Value()
+			if path == "" {
+				if f.original == nil {
+					return nil, errors.New("file is required")
+				}
+				continue
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			f.kind.content.set(item, data)
+		}
+	}
+
+	if f.area != nil {
+		f.kind.content.set(item, []byte(f.area.Value()))
+	}
+
+	return item, nil
+}
+
+func (f *form) view() string {
+	var b strings.Builder
+	if f.original == nil {
+		fmt.Fprintf(&b, "New %s\n\n", f.kind.name)
+	} else {
+		fmt.Fprintf(&b, "Edit %s\n\n", f.kind.name)
+	}
+
+	for i, input := range f.inputs {
+		fmt.Fprintf(&b, "%s\n%s\n", labelStyle.Render(f.labels[i]), input.View())
+	}
+	if f.area != nil {
+		fmt.Fprintf(&b, "%s\n%s\n", labelStyle.Render("text"), f.area.View())
+	}
+	if f.err != nil {
+		fmt.Fprintf(&b, "\n%s\n", errorStyle.Render(f.err.Error()))
+	}
+
+	return b.String()
+}
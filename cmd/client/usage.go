@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// runUsage prints what the items of the user take and how much of the quota
+// remains.
+func runUsage(ctx context.Context, a *app, args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: usage")
+	}
+
+	c, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	usage, err := c.Usage(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range usage.GetItems() {
+		name := strings.ToLower(strings.TrimPrefix(item.GetType().String(), "ITEM_TYPE_"))
+		items := fmt.Sprint(item.GetItems())
+		if usage.GetMaxItems() > 0 {
+			items += fmt.Sprintf(" of %d", usage.GetMaxItems())
+		}
+		fmt.Printf("%-10s %s items, %s, history %s\n", name, items, formatBytes(item.GetBytes()), formatBytes(item.GetHistoryBytes()))
+	}
+
+	if usage.GetMaxBytes() == 0 {
+		fmt.Printf("Stored %s, no limit.\n", formatBytes(usage.GetBytes()))
+		return nil
+	}
+
+	remaining := usage.GetMaxBytes() - usage.GetBytes()
+	if remaining < 0 {
+		remaining = 0
+	}
+	fmt.Printf("Stored %s of %s, %s remain.\n", formatBytes(usage.GetBytes()), formatBytes(usage.GetMaxBytes()), formatBytes(remaining))
+
+	return nil
+}
+
+// formatBytes formats a size like "1.5 MiB".
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	size, unit := float64(n)/1024, 0
+	for size >= 1024 && unit < 3 {
+		size /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %s", size, [...]string{"KiB", "MiB", "GiB", "TiB"}[unit])
+}
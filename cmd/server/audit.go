@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"praktikum-gophkeeper/pkg/audit"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+)
+
+const auditPage = 1000
+
+// verifyAudit checks the audit events of every actor against the key they
+// were hashed with and prints the result for each. It tells whether every
+// chain is intact.
+func verifyAudit(ctx context.Context, dsn string, key []byte) (bool, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return false, err
+	}
+	defer pool.Close()
+
+	events, err := storage.NewAuditStorage(pool, key)
+	if err != nil {
+		return false, err
+	}
+
+	actors, err := events.Actors(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	intact := true
+	for _, actor := range actors {
+		chain := audit.Chain{Key: key}
+		err := verifyActor(ctx, events, actor, &chain)
+		if err != nil {
+			intact = false
+			fmt.Printf("%q: broken: %v\n", actor, err)
+			continue
+		}
+
+		fmt.Printf("%q: %d events, intact\n", actor, chain.Len())
+	}
+
+	return intact, nil
+}
+
+type auditEvents interface {
+	Since(ctx context.Context, actor string, seq int64, limit uint32) ([]*pb.AuditEvent, error)
+	Head(ctx context.Context, actor string) (int64, string, error)
+}
+
+func verifyActor(ctx context.Context, events auditEvents, actor string, chain *audit.Chain) error {
+	// The head is read first, events recorded meanwhile only extend the chain.
+	seq, hash, err := events.Head(ctx, actor)
+	if err != nil {
+		return err
+	}
+
+	for chain.Len() < seq {
+		page, err := events.Since(ctx, actor, chain.Len(), auditPage)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, e := range page {
+			if e.Seq > seq {
+				return chain.End(seq, hash)
+			}
+			err := chain.Add(e)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return chain.End(seq, hash)
+}
@@ -1,53 +1,210 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"praktikum-gophkeeper/pkg/configuration"
+	"praktikum-gophkeeper/pkg/logging"
+	"praktikum-gophkeeper/pkg/metrics"
+	"praktikum-gophkeeper/pkg/storage"
+	"praktikum-gophkeeper/pkg/tracing"
+	pb "praktikum-gophkeeper/proto"
 	"syscall"
+	"time"
 )
 
+// Flags override the configuration file and the environment; see configuration.Config for the settings.
 var (
-	buildVersion = "N/A"
-	buildDate    = "N/A"
-	buildCommit  = "N/A"
-	flAddress    = flag.String("a", ":8080", "Server's address.") // RUN_ADDRESS
-	flDSN        = flag.String("d", "", "Server's URI.")          // DSN
+	buildVersion  = "N/A"
+	buildDate     = "N/A"
+	buildCommit   = "N/A"
+	flConfig      = flag.String("c", os.Getenv("CONFIG"), "Configuration file, YAML or JSON.")
+	flPrintConfig = flag.Bool("print-config", false, "Print the effective configuration with secrets redacted and exit.")
+	flVerifyAudit = flag.Bool("verify-audit", false, "Verify the audit log of every user and exit, with status 1 if it was tampered with.")
+	flSetQuota    = flag.String("set-quota", "", "Set the quota of a user as login:items:bytes and exit, an empty limit takes the default.")
+	_             = flag.String("a", ":8080", "Server's address.")                                                  // RUN_ADDRESS
+	_             = flag.String("d", "", "Server's URI.")                                                           // DSN
+	_             = flag.String("r", "", "Trash retention period.")                                                 // TRASH_RETENTION
+	_             = flag.String("tls-cert", "", "TLS certificate, enables TLS.")                                    // TLS_CERT
+	_             = flag.String("tls-key", "", "TLS key.")                                                          // TLS_KEY
+	_             = flag.String("tls-client-ca", "", "CA of client certificates, requires clients to present one.") // TLS_CLIENT_CA
+	_             = flag.String("tls-min-version", "", "Minimum TLS version, 1.2 by default.")                      // TLS_MIN_VERSION
+	_             = flag.String("tls-ciphers", "", "Comma-separated TLS 1.2 cipher suites in order of preference.") // TLS_CIPHERS
+	_             = flag.String("tls-dev", "", "Directory of a generated development CA and certificate.")          // TLS_DEV_DIR
+	_             = flag.String("health-address", "", "Address of the HTTP listener of /healthz and /readyz.")      // HEALTH_ADDRESS
+	_             = flag.String("metrics-address", "", "Address of the HTTP listener of the metrics.")              // METRICS_ADDRESS
+	_             = flag.String("tracing", "", "Span exporter: none, otlp or stdout.")                              // TRACING_EXPORTER
+	_             = flag.String("log-level", "info", "Log level: debug, info, warn or error.")                      // LOG_LEVEL
+	_             = flag.String("log-format", "text", "Log format: text or json.")                                  // LOG_FORMAT
 )
 
 func main() {
 	flag.Parse()
-	log.Println("Build version:", buildVersion)
-	log.Println("Build date:", buildDate)
-	log.Println("Build commit:", buildCommit)
 
-	config, err := configuration.NewServer(flAddress, flDSN)
+	os.Exit(run())
+}
+
+// run serves until the server is stopped and returns the exit status, which
+// is 1 after a failure. Deferred cleanups run before the process exits.
+func run() int {
+	// Records are written as text to standard error until the configuration
+	// tells how to write them, so that they are redacted like all others.
+	logging.Setup(logging.FormatText)
+
+	config, err := configuration.Load(*flConfig, flag.CommandLine)
+	if err != nil {
+		slog.Error("Couldn't load configuration", "error", err)
+		return 1
+	}
+
+	if *flPrintConfig {
+		out, err := config.Redacted().YAML()
+		if err != nil {
+			slog.Error("Couldn't print configuration", "error", err)
+			return 1
+		}
+		fmt.Print(out)
+		return 0
+	}
+
+	if *flVerifyAudit {
+		intact, err := verifyAudit(context.Background(), config.DSN, []byte(config.Audit.Secret))
+		if err != nil {
+			slog.Error("Couldn't verify audit log", "error", err)
+			return 1
+		}
+		if !intact {
+			return 1
+		}
+		return 0
+	}
+
+	if *flSetQuota != "" {
+		err := setQuota(context.Background(), config.DSN, *flSetQuota)
+		if err != nil {
+			slog.Error("Couldn't set quota", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	err = logging.Output.Open(config.Log.Output)
+	if err != nil {
+		slog.Error("Couldn't open log output", "output", config.Log.Output, "error", err)
+		return 1
+	}
+	err = logging.Setup(config.Log.Format)
+	if err != nil {
+		slog.Error("Couldn't set up logging", "error", err)
+		return 1
+	}
+	level, _ := logging.ParseLevel(config.Log.Level)
+	logging.Level.Set(level)
+
+	slog.Info("Build", "version", buildVersion, "date", buildDate, "commit", buildCommit)
+
+	stopTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    config.Tracing.Exporter,
+		Endpoint:    config.Tracing.Endpoint,
+		Insecure:    config.Tracing.Insecure,
+		File:        config.Tracing.File,
+		SampleRatio: config.Tracing.SampleRatio,
+		Service:     "gophkeeper-server",
+		Version:     buildVersion,
+	})
 	if err != nil {
-		log.Println(err)
-		return
+		slog.Error("Couldn't set up tracing", "error", err)
+		return 1
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := stopTracing(ctx); err != nil {
+			slog.Error("Couldn't export spans", "error", err)
+		}
+	}()
+
+	server, err := configuration.NewServer(config)
+	if err != nil {
+		slog.Error("Couldn't start server", "error", err)
+		return 1
+	}
+	defer server.DB.Close()
 
 	listener, err := net.Listen("tcp", config.Address)
 	if err != nil {
-		log.Println(err)
-		return
+		slog.Error("Couldn't listen", "address", config.Address, "error", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if config.Features.Purge {
+		go server.GophKeeper.RunPurger(ctx, time.Duration(config.Trash.Retention), time.Duration(config.Trash.PurgeInterval))
+	}
+	if config.Features.Watch {
+		go server.GophKeeper.RunChangeListener(ctx, config.DSN)
+	}
+
+	go server.Health.Run(ctx, time.Duration(config.Health.Interval), time.Duration(config.Health.Timeout))
+
+	go metrics.RunStoredBytes(ctx, time.Duration(config.Metrics.StoredInterval), func(ctx context.Context) (map[pb.ItemType]int64, error) {
+		return storage.StoredBytes(ctx, server.DB)
+	})
+
+	httpServers := server.HTTPServers()
+	for _, httpServer := range httpServers {
+		go func(httpServer *http.Server) {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("HTTP server failed", "address", httpServer.Addr, "error", err)
+			}
+		}(httpServer)
+	}
+
+	if server.TLS == nil {
+		slog.Warn("TLS is disabled, credentials are sent in plaintext")
 	}
 
 	go func() {
-		log.Println("Server starting...")
-		if err := config.Server.Serve(listener); err != nil {
-			log.Println(err)
+		slog.Info("Server starting", "address", config.Address)
+		if err := server.Server.Serve(listener); err != nil {
+			slog.Error("Server failed", "error", err)
 		}
 	}()
 
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP)
 
-	sig := <-signals
+	for sig := range signals {
+		slog.Info("Got signal", "signal", sig.String())
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		// SIGHUP re-reads the configuration file, the environment and the
+		// flags can't change while the server runs.
+		config, err := configuration.Load(*flConfig, flag.CommandLine)
+		if err != nil {
+			slog.Error("Configuration not reloaded", "error", err)
+			continue
+		}
+		server.Reload(config)
+	}
+
+	// Balancers see the server stopping while calls in flight finish.
+	server.Health.Shutdown()
+	server.Server.GracefulStop()
+	for _, httpServer := range httpServers {
+		httpServer.Close()
+	}
 
-	log.Println("Got signal:", sig)
-	config.Server.GracefulStop()
+	return 0
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"praktikum-gophkeeper/pkg/storage"
+	"strconv"
+	"strings"
+)
+
+// setQuota sets the quota of a user given as login:items:bytes, where an
+// empty limit takes the default one.
+func setQuota(ctx context.Context, dsn, spec string) error {
+	login, items, bytes, err := parseQuota(spec)
+	if err != nil {
+		return err
+	}
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	// Setting a quota doesn't depend on the default one.
+	usage, err := storage.NewUsageStorage(pool, storage.NewDefaultQuota(storage.Quota{}))
+	if err != nil {
+		return err
+	}
+
+	return usage.SetQuota(ctx, login, items, bytes)
+}
+
+func parseQuota(spec string) (login string, items, bytes *int64, err error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", nil, nil, fmt.Errorf("quota %q: expected login:items:bytes", spec)
+	}
+
+	limits := make([]*int64, 2)
+	for i, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+
+		limit, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || limit < 0 {
+			return "", nil, nil, fmt.Errorf("quota %q: expected a non-negative limit, got %q", spec, part)
+		}
+		limits[i] = &limit
+	}
+
+	return parts[0], limits[0], limits[1], nil
+}
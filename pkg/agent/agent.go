@@ -0,0 +1,313 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"net"
+	"os"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/cache"
+	"praktikum-gophkeeper/pkg/session"
+	pb "praktikum-gophkeeper/proto"
+	"sync"
+	"time"
+)
+
+var ErrNotRunning = errors.New("agent is not running")
+
+// Server keeps the secrets the CLI unlocks until it is locked, explicitly or
+// after it has been idle for a while. It opens the local cache with the master
+// password and serves it to the CLI, so that the secrets never leave it.
+type Server struct {
+	pb.UnimplementedAgentServer
+
+	idle time.Duration
+
+	mu             sync.Mutex
+	masterPassword *lockedBuffer
+	pin            *lockedBuffer
+	session        *lockedBuffer
+	sessionPath    string
+	sessionPIN     bool
+	cache          *cache.Cache
+	cachePath      string
+	timer          *time.Timer
+}
+
+// NewServer returns a locked agent. With a zero idle timeout it only locks
+// when asked to.
+func NewServer(idle time.Duration) *Server {
+	return &Server{
+		idle: idle,
+	}
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// touch restarts the idle timer, s.mu must be held.
+func (s *Server) touch() {
+	if s.idle == 0 {
+		return
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(s.idle, s.lock)
+}
+
+// replace stores secret in *buf unless it is empty and zeroes it.
+func replace(buf **lockedBuffer, secret []byte) error {
+	if len(secret) == 0 {
+		return nil
+	}
+	defer zero(secret)
+
+	locked, err := newLockedBuffer(secret)
+	if err != nil {
+		return err
+	}
+
+	(*buf).destroy()
+	*buf = locked
+	return nil
+}
+
+func (s *Server) Unlock(_ context.Context, req *pb.UnlockRequest) (*pb.UnlockResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets := req.GetSecrets()
+	// The cache is opened first, so that a wrong master password replaces nothing.
+	if req.GetCachePath() != "" {
+		password := secrets.GetMasterPassword()
+		if len(password) == 0 {
+			password = s.masterPassword.bytes()
+		}
+
+		err := s.openCache(req.GetCachePath(), password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range []struct {
+		buf    **lockedBuffer
+		secret []byte
+	}{
+		{&s.masterPassword, secrets.GetMasterPassword()},
+		{&s.pin, secrets.GetPin()},
+		{&s.session, secrets.GetSession()},
+	} {
+		err := replace(r.buf, r.secret)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	if req.GetSessionPath() != "" {
+		s.sessionPath, s.sessionPIN = req.GetSessionPath(), req.GetSessionPin()
+	}
+
+	s.touch()
+	return &pb.UnlockResponse{}, nil
+}
+
+// openCache replaces the open cache with the one at path, s.mu must be held.
+func (s *Server) openCache(path string, masterPassword []byte) error {
+	if len(masterPassword) == 0 {
+		return status.Error(codes.FailedPrecondition, "master password is needed to open the cache")
+	}
+
+	s.closeCache()
+	c, err := cache.Open(path, masterPassword)
+	if errors.Is(err, cache.ErrWrongPassword) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	} else if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	s.cache, s.cachePath = c, path
+	return nil
+}
+
+// closeCache closes the open cache, s.mu must be held.
+func (s *Server) closeCache() {
+	if s.cache == nil {
+		return
+	}
+
+	s.cache.Close()
+	s.cache, s.cachePath = nil, ""
+}
+
+func (s *Server) Status(context.Context, *pb.StatusRequest) (*pb.StatusResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session != nil || s.cache != nil {
+		s.touch()
+	}
+
+	return &pb.StatusResponse{
+		Session:   append([]byte(nil), s.session.bytes()...),
+		CachePath: s.cachePath,
+	}, nil
+}
+
+func (s *Server) SaveSession(_ context.Context, req *pb.SaveSessionRequest) (*pb.SaveSessionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sessionPath == "" {
+		return nil, status.Error(codes.FailedPrecondition, "agent is locked")
+	}
+
+	sess := &session.Session{}
+	err := json.Unmarshal(req.GetSession(), sess)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	store := session.Open(s.sessionPath, s.passphrase)
+	if file, ok := store.(*session.FileStore); ok {
+		file.PIN = s.sessionPIN
+	}
+
+	err = store.Save(sess)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	err = replace(&s.session, req.GetSession())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	s.touch()
+	return &pb.SaveSessionResponse{}, nil
+}
+
+// passphrase returns the PIN or the master password the session file is
+// protected with, s.mu must be held.
+func (s *Server) passphrase(pin bool) ([]byte, error) {
+	if pin {
+		if s.pin == nil {
+			return nil, errors.New("agent holds no PIN")
+		}
+		return s.pin.bytes(), nil
+	}
+
+	if s.masterPassword == nil {
+		return nil, errors.New("agent holds no master password")
+	}
+	return s.masterPassword.bytes(), nil
+}
+
+func (s *Server) Lock(context.Context, *pb.LockRequest) (*pb.LockResponse, error) {
+	s.lock()
+	return &pb.LockResponse{}, nil
+}
+
+// lock zeroes and forgets the secrets and closes the cache.
+func (s *Server) lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	for _, buf := range []**lockedBuffer{&s.masterPassword, &s.pin, &s.session} {
+		(*buf).destroy()
+		*buf = nil
+	}
+
+	s.closeCache()
+	s.sessionPath, s.sessionPIN = "", false
+}
+
+// Listen creates the socket of the agent, accessible only by the user. A
+// socket left by an agent that is no longer running is replaced.
+func Listen(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s is accessible by other users", dir)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("an agent is already listening on %s", path)
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Client is a connection to a running agent.
+type Client struct {
+	pb.AgentClient
+	conn *grpc.ClientConn
+}
+
+// Dial connects to the agent listening on path. It returns ErrNotRunning
+// when there is no socket.
+func Dial(path string) (*Client, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial("unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		AgentClient: pb.NewAgentClient(conn),
+		conn:        conn,
+	}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/cache"
+	"praktikum-gophkeeper/pkg/session"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, idle time.Duration) (*Client, string) {
+	path := filepath.Join(t.TempDir(), "agent", "agent.sock")
+
+	l, err := Listen(path)
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	pb.RegisterAgentServer(server, NewServer(idle))
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	client, err := Dial(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return client, path
+}
+
+func TestAgent(t *testing.T) {
+	ctx := context.Background()
+	client, path := serve(t, 0)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = Listen(path)
+	require.ErrorContains(t, err, "already listening")
+
+	resp, err := client.Status(ctx, &pb.StatusRequest{})
+	require.NoError(t, err)
+	require.Empty(t, resp.GetSession())
+	require.Empty(t, resp.GetCachePath())
+
+	_, err = client.Cache().Items(pb.ItemType_ITEM_TYPE_TEXT)
+	require.ErrorContains(t, err, "no cache open")
+
+	cachePath := filepath.Join(t.TempDir(), "vault.db")
+	_, err = client.Unlock(ctx, &pb.UnlockRequest{CachePath: cachePath})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Unlock(ctx, &pb.UnlockRequest{Secrets: &pb.Secrets{MasterPassword: []byte("master")}, CachePath: cachePath})
+	require.NoError(t, err)
+	_, err = client.Unlock(ctx, &pb.UnlockRequest{Secrets: &pb.Secrets{Session: []byte("session")}})
+	require.NoError(t, err)
+
+	resp, err = client.Status(ctx, &pb.StatusRequest{})
+	require.NoError(t, err)
+	require.Equal(t, []byte("session"), resp.GetSession())
+	require.Equal(t, cachePath, resp.GetCachePath())
+
+	c := client.Cache()
+	op := &pb.PendingOperation{Operation: pb.Operation_OPERATION_DELETE, Item: &pb.Change{Type: pb.ItemType_ITEM_TYPE_TEXT, Id: "a"}}
+	require.NoError(t, c.Enqueue(op))
+	require.NotZero(t, op.GetSeq())
+
+	pending, err := c.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	_, err = c.Item(pb.ItemType_ITEM_TYPE_TEXT, "a")
+	require.ErrorIs(t, err, cache.ErrNotFound)
+	_, err = c.Conflict(1)
+	require.ErrorIs(t, err, cache.ErrNoConflict)
+
+	_, err = client.Lock(ctx, &pb.LockRequest{})
+	require.NoError(t, err)
+	resp, err = client.Status(ctx, &pb.StatusRequest{})
+	require.NoError(t, err)
+	require.Empty(t, resp.GetSession())
+	require.Empty(t, resp.GetCachePath())
+
+	_, err = client.Unlock(ctx, &pb.UnlockRequest{Secrets: &pb.Secrets{MasterPassword: []byte("wrong")}, CachePath: cachePath})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = Dial(filepath.Join(t.TempDir(), "missing.sock"))
+	require.ErrorIs(t, err, ErrNotRunning)
+}
+
+func TestAgentSaveSession(t *testing.T) {
+	ctx := context.Background()
+	client, _ := serve(t, 0)
+
+	_, err := client.SaveSession(ctx, &pb.SaveSessionRequest{Session: []byte("{}")})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	path := filepath.Join(t.TempDir(), "session")
+	store := session.NewFileStore(path, func(pin bool) ([]byte, error) {
+		require.True(t, pin)
+		return []byte("1234"), nil
+	})
+	store.PIN = true
+	require.NoError(t, store.Save(session.New("", "user", "token", "refresh")))
+
+	_, err = client.Unlock(ctx, &pb.UnlockRequest{
+		Secrets:     &pb.Secrets{Pin: []byte("1234")},
+		SessionPath: path,
+		SessionPin:  true,
+	})
+	require.NoError(t, err)
+
+	refreshed, err := json.Marshal(session.New("", "user", "new token", "new refresh"))
+	require.NoError(t, err)
+	_, err = client.SaveSession(ctx, &pb.SaveSessionRequest{Session: refreshed})
+	require.NoError(t, err)
+
+	s, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, "new token", s.Token)
+
+	resp, err := client.Status(ctx, &pb.StatusRequest{})
+	require.NoError(t, err)
+	require.Equal(t, refreshed, resp.GetSession())
+}
+
+func TestAgentIdle(t *testing.T) {
+	ctx := context.Background()
+	client, _ := serve(t, 50*time.Millisecond)
+
+	_, err := client.Unlock(ctx, &pb.UnlockRequest{Secrets: &pb.Secrets{Session: []byte("session")}})
+	require.NoError(t, err)
+
+	// Every request restarts the timer, so the agent is only checked after it expired.
+	time.Sleep(100 * time.Millisecond)
+	resp, err := client.Status(ctx, &pb.StatusRequest{})
+	require.NoError(t, err)
+	require.Empty(t, resp.GetSession())
+}
+
+func TestLockedBuffer(t *testing.T) {
+	secret := []byte("secret")
+
+	b, err := newLockedBuffer(secret)
+	require.NoError(t, err)
+	require.Equal(t, secret, b.bytes())
+
+	b.destroy()
+	require.Nil(t, b.bytes())
+
+	empty, err := newLockedBuffer(nil)
+	require.NoError(t, err)
+	require.Nil(t, empty.bytes())
+	empty.destroy()
+}
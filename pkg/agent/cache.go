@@ -0,0 +1,304 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"praktikum-gophkeeper/pkg/cache"
+	pb "praktikum-gophkeeper/proto"
+	"time"
+)
+
+// cacheTimeout limits calls to the cache the agent has open.
+const cacheTimeout = 10 * time.Second
+
+// withCache calls f with the open cache while holding s.mu, so that the
+// cache isn't closed meanwhile.
+func (s *Server) withCache(f func(c *cache.Cache) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache == nil {
+		return status.Error(codes.FailedPrecondition, "agent has no cache open")
+	}
+
+	s.touch()
+	err := f(s.cache)
+	if errors.Is(err, cache.ErrNotFound) || errors.Is(err, cache.ErrNoConflict) {
+		return status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return nil
+}
+
+func (s *Server) CacheSeq(context.Context, *pb.CacheSeqRequest) (*pb.CacheSeqResponse, error) {
+	resp := &pb.CacheSeqResponse{}
+	err := s.withCache(func(c *cache.Cache) (err error) {
+		resp.Seq, err = c.Seq()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *Server) CacheApply(_ context.Context, req *pb.CacheApplyRequest) (*pb.CacheApplyResponse, error) {
+	err := s.withCache(func(c *cache.Cache) error {
+		return c.Apply(req.GetChanges(), req.GetSeq())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CacheApplyResponse{}, nil
+}
+
+func (s *Server) CacheItem(_ context.Context, req *pb.CacheItemRequest) (*pb.CacheItemResponse, error) {
+	resp := &pb.CacheItemResponse{}
+	err := s.withCache(func(c *cache.Cache) (err error) {
+		resp.Item, err = c.Item(req.GetType(), req.GetId())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *Server) CacheItems(_ context.Context, req *pb.CacheItemsRequest) (*pb.CacheItemsResponse, error) {
+	resp := &pb.CacheItemsResponse{}
+	err := s.withCache(func(c *cache.Cache) (err error) {
+		resp.Items, err = c.Items(req.GetType())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *Server) CacheEnqueue(_ context.Context, req *pb.CacheEnqueueRequest) (*pb.CacheEnqueueResponse, error) {
+	op := req.GetOperation()
+	err := s.withCache(func(c *cache.Cache) error {
+		return c.Enqueue(op)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CacheEnqueueResponse{Seq: op.GetSeq()}, nil
+}
+
+func (s *Server) CachePending(context.Context, *pb.CachePendingRequest) (*pb.CachePendingResponse, error) {
+	resp := &pb.CachePendingResponse{}
+	err := s.withCache(func(c *cache.Cache) (err error) {
+		resp.Operations, err = c.Pending()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *Server) CacheDequeue(_ context.Context, req *pb.CacheDequeueRequest) (*pb.CacheDequeueResponse, error) {
+	err := s.withCache(func(c *cache.Cache) error {
+		return c.Dequeue(req.GetSeq())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CacheDequeueResponse{}, nil
+}
+
+func (s *Server) CacheAddConflict(_ context.Context, req *pb.CacheAddConflictRequest) (*pb.CacheAddConflictResponse, error) {
+	conflict := req.GetConflict()
+	err := s.withCache(func(c *cache.Cache) error {
+		return c.AddConflict(conflict)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CacheAddConflictResponse{Seq: conflict.GetSeq()}, nil
+}
+
+func (s *Server) CacheConflicts(context.Context, *pb.CacheConflictsRequest) (*pb.CacheConflictsResponse, error) {
+	resp := &pb.CacheConflictsResponse{}
+	err := s.withCache(func(c *cache.Cache) (err error) {
+		resp.Conflicts, err = c.Conflicts()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *Server) CacheConflict(_ context.Context, req *pb.CacheConflictRequest) (*pb.CacheConflictResponse, error) {
+	resp := &pb.CacheConflictResponse{}
+	err := s.withCache(func(c *cache.Cache) (err error) {
+		resp.Conflict, err = c.Conflict(req.GetSeq())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *Server) CacheRemoveConflict(_ context.Context, req *pb.CacheRemoveConflictRequest) (*pb.CacheRemoveConflictResponse, error) {
+	err := s.withCache(func(c *cache.Cache) error {
+		return c.RemoveConflict(req.GetSeq())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CacheRemoveConflictResponse{}, nil
+}
+
+// Cache is the cache an agent has open. It has the methods of cache.Cache,
+// which are forwarded to the agent.
+type Cache struct {
+	client pb.AgentClient
+}
+
+// Cache returns the cache the agent has open.
+func (c *Client) Cache() *Cache {
+	return &Cache{
+		client: c.AgentClient,
+	}
+}
+
+// cacheError turns the error of a cache call into the one cache.Cache
+// returns. Other errors are wrapped, so that they aren't taken for errors of
+// the server the vault is synced with.
+func cacheError(err, notFound error) error {
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) == codes.NotFound && notFound != nil {
+		return notFound
+	}
+
+	return fmt.Errorf("agent: %s", status.Convert(err).Message())
+}
+
+func (c *Cache) Seq() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	resp, err := c.client.CacheSeq(ctx, &pb.CacheSeqRequest{})
+	return resp.GetSeq(), cacheError(err, nil)
+}
+
+func (c *Cache) Apply(changes []*pb.Change, seq int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	_, err := c.client.CacheApply(ctx, &pb.CacheApplyRequest{Changes: changes, Seq: seq})
+	return cacheError(err, nil)
+}
+
+func (c *Cache) Item(itemType pb.ItemType, id string) (*pb.Change, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	resp, err := c.client.CacheItem(ctx, &pb.CacheItemRequest{Type: itemType, Id: id})
+	if err != nil {
+		return nil, cacheError(err, cache.ErrNotFound)
+	}
+
+	return resp.GetItem(), nil
+}
+
+func (c *Cache) Items(itemType pb.ItemType) ([]*pb.Change, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	resp, err := c.client.CacheItems(ctx, &pb.CacheItemsRequest{Type: itemType})
+	return resp.GetItems(), cacheError(err, nil)
+}
+
+func (c *Cache) Enqueue(op *pb.PendingOperation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	resp, err := c.client.CacheEnqueue(ctx, &pb.CacheEnqueueRequest{Operation: op})
+	if err != nil {
+		return cacheError(err, nil)
+	}
+
+	op.Seq = resp.GetSeq()
+	return nil
+}
+
+func (c *Cache) Pending() ([]*pb.PendingOperation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	resp, err := c.client.CachePending(ctx, &pb.CachePendingRequest{})
+	return resp.GetOperations(), cacheError(err, nil)
+}
+
+func (c *Cache) Dequeue(seq uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	_, err := c.client.CacheDequeue(ctx, &pb.CacheDequeueRequest{Seq: seq})
+	return cacheError(err, nil)
+}
+
+func (c *Cache) AddConflict(conflict *pb.Conflict) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	resp, err := c.client.CacheAddConflict(ctx, &pb.CacheAddConflictRequest{Conflict: conflict})
+	if err != nil {
+		return cacheError(err, nil)
+	}
+
+	conflict.Seq = resp.GetSeq()
+	return nil
+}
+
+func (c *Cache) Conflicts() ([]*pb.Conflict, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	resp, err := c.client.CacheConflicts(ctx, &pb.CacheConflictsRequest{})
+	return resp.GetConflicts(), cacheError(err, nil)
+}
+
+func (c *Cache) Conflict(seq uint64) (*pb.Conflict, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	resp, err := c.client.CacheConflict(ctx, &pb.CacheConflictRequest{Seq: seq})
+	if err != nil {
+		return nil, cacheError(err, cache.ErrNoConflict)
+	}
+
+	return resp.GetConflict(), nil
+}
+
+func (c *Cache) RemoveConflict(seq uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	_, err := c.client.CacheRemoveConflict(ctx, &pb.CacheRemoveConflictRequest{Seq: seq})
+	return cacheError(err, nil)
+}
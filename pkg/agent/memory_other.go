@@ -0,0 +1,34 @@
+//go:build !unix
+
+package agent
+
+// lockedBuffer holds a secret that is zeroed when it is destroyed. Memory
+// can't be locked on this platform.
+type lockedBuffer struct {
+	data []byte
+}
+
+func newLockedBuffer(secret []byte) (*lockedBuffer, error) {
+	if len(secret) == 0 {
+		return nil, nil
+	}
+
+	return &lockedBuffer{data: append([]byte(nil), secret...)}, nil
+}
+
+func (b *lockedBuffer) bytes() []byte {
+	if b == nil {
+		return nil
+	}
+
+	return b.data
+}
+
+func (b *lockedBuffer) destroy() {
+	if b == nil {
+		return
+	}
+
+	zero(b.data)
+	b.data = nil
+}
@@ -0,0 +1,54 @@
+//go:build unix
+
+package agent
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+)
+
+// lockedBuffer holds a secret in memory that is locked against swapping and
+// zeroed when it is destroyed.
+type lockedBuffer struct {
+	data []byte
+}
+
+func newLockedBuffer(secret []byte) (*lockedBuffer, error) {
+	if len(secret) == 0 {
+		return nil, nil
+	}
+
+	// The memory is mapped outside the Go heap, so the garbage collector never copies it.
+	data, err := unix.Mmap(-1, 0, len(secret), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+
+	err = unix.Mlock(data)
+	if err != nil {
+		unix.Munmap(data)
+		return nil, fmt.Errorf("couldn't lock memory: %w", err)
+	}
+
+	copy(data, secret)
+	return &lockedBuffer{data: data}, nil
+}
+
+func (b *lockedBuffer) bytes() []byte {
+	if b == nil {
+		return nil
+	}
+
+	return b.data
+}
+
+func (b *lockedBuffer) destroy() {
+	if b == nil {
+		return
+	}
+
+	zero(b.data)
+	unix.Munlock(b.data)
+	unix.Munmap(b.data)
+	b.data = nil
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	pb "praktikum-gophkeeper/proto"
+	"strconv"
+)
+
+// Hash returns the HMAC of the event under the key, which covers every field
+// but the hash itself, including the hash of the previous event. The key isn't
+// stored with the events, so whoever can change them can't hash them anew.
+func Hash(key []byte, e *pb.AuditEvent) string {
+	h := hmac.New(sha256.New, key)
+	write := func(s string) {
+		// Lengths keep the fields apart, "ab"+"c" doesn't hash like "a"+"bc".
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(s)))
+		h.Write(length[:])
+		h.Write([]byte(s))
+	}
+
+	write(e.PrevHash)
+	write(strconv.FormatInt(e.Seq, 10))
+	// The database keeps microseconds.
+	write(strconv.FormatInt(e.CreatedAt.AsTime().UnixMicro(), 10))
+	write(e.Actor)
+	write(e.Session)
+	write(e.Ip)
+	write(strconv.Itoa(int(e.Action)))
+	write(strconv.Itoa(int(e.ItemType)))
+	write(strconv.Itoa(len(e.ItemIds)))
+	for _, id := range e.ItemIds {
+		write(id)
+	}
+	write(e.Outcome)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Session identifies a token without revealing it, empty without a token.
+func Session(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Chain verifies the events of an actor in order, from the first one.
+// Without the key the events were hashed with only the links between them are
+// verified, which doesn't catch events altered and hashed anew.
+type Chain struct {
+	Key  []byte
+	seq  int64
+	hash string
+}
+
+// Add verifies that the event follows the last one added and that it wasn't
+// altered.
+func (c *Chain) Add(e *pb.AuditEvent) error {
+	if e.Seq != c.seq+1 {
+		return fmt.Errorf("event %d follows event %d, events were deleted", e.Seq, c.seq)
+	}
+	if e.PrevHash != c.hash {
+		return fmt.Errorf("event %d doesn't hold the hash of event %d, one of them was altered", e.Seq, c.seq)
+	}
+	if c.Key != nil && !hmac.Equal([]byte(Hash(c.Key, e)), []byte(e.Hash)) {
+		return fmt.Errorf("event %d doesn't match its hash, it was altered", e.Seq)
+	}
+
+	c.seq, c.hash = e.Seq, e.Hash
+	return nil
+}
+
+// Len returns the number of verified events.
+func (c *Chain) Len() int64 {
+	return c.seq
+}
+
+// End verifies that the last added event is the last event recorded, which
+// catches deletion of the latest events.
+func (c *Chain) End(seq int64, hash string) error {
+	if c.seq != seq || c.hash != hash {
+		return fmt.Errorf("the chain ends with event %d, event %d was recorded last", c.seq, seq)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+	"time"
+)
+
+var key = []byte("audit secret")
+
+func chain(n int) []*pb.AuditEvent {
+	var events []*pb.AuditEvent
+	prev := ""
+	for i := 1; i <= n; i++ {
+		e := &pb.AuditEvent{
+			Seq:       int64(i),
+			CreatedAt: timestamppb.New(time.Date(2023, 1, 1, 0, 0, i, 0, time.UTC)),
+			Actor:     "user",
+			Session:   Session("token"),
+			Ip:        "127.0.0.1",
+			Action:    pb.AuditAction_AUDIT_ACTION_GET,
+			ItemType:  pb.ItemType_ITEM_TYPE_PASSWORD,
+			ItemIds:   []string{"id"},
+			Outcome:   "OK",
+			PrevHash:  prev,
+		}
+		e.Hash = Hash(key, e)
+		prev = e.Hash
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(events []*pb.AuditEvent) []*pb.AuditEvent
+		wantErr string
+	}{
+		{
+			name:   "intact",
+			tamper: func(events []*pb.AuditEvent) []*pb.AuditEvent { return events },
+		},
+		{
+			name: "altered field",
+			tamper: func(events []*pb.AuditEvent) []*pb.AuditEvent {
+				events[1].Outcome = "PermissionDenied"
+				return events
+			},
+			wantErr: "event 2 doesn't match its hash",
+		},
+		{
+			name: "altered and rehashed",
+			tamper: func(events []*pb.AuditEvent) []*pb.AuditEvent {
+				events[1].Ip = "10.0.0.1"
+				events[1].Hash = Hash(key, events[1])
+				return events
+			},
+			wantErr: "event 3 doesn't hold the hash of event 2",
+		},
+		{
+			name: "rewritten without the key",
+			tamper: func(events []*pb.AuditEvent) []*pb.AuditEvent {
+				prev := ""
+				for _, e := range events {
+					e.Ip = "10.0.0.1"
+					e.PrevHash = prev
+					e.Hash = Hash([]byte("guessed"), e)
+					prev = e.Hash
+				}
+				return events
+			},
+			wantErr: "event 1 doesn't match its hash",
+		},
+		{
+			name: "deleted event",
+			tamper: func(events []*pb.AuditEvent) []*pb.AuditEvent {
+				return append(events[:1], events[2:]...)
+			},
+			wantErr: "event 3 follows event 1",
+		},
+		{
+			name: "deleted last event",
+			tamper: func(events []*pb.AuditEvent) []*pb.AuditEvent {
+				return events[:2]
+			},
+			wantErr: "the chain ends with event 2, event 3 was recorded last",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := chain(3)
+			last := events[2]
+
+			c := Chain{Key: key}
+			var err error
+			for _, e := range tt.tamper(events) {
+				if err = c.Add(e); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = c.End(last.Seq, last.Hash)
+			}
+
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				require.Equal(t, int64(3), c.Len())
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestChainWithoutKey(t *testing.T) {
+	events := chain(3)
+	events[1].Outcome = "PermissionDenied"
+
+	var c Chain
+	for _, e := range events {
+		require.NoError(t, c.Add(e))
+	}
+
+	c = Chain{}
+	require.NoError(t, c.Add(events[0]))
+	require.ErrorContains(t, c.Add(events[2]), "event 3 follows event 1")
+}
+
+func TestHashSeparatesFields(t *testing.T) {
+	a := &pb.AuditEvent{Actor: "ab", Session: "c", CreatedAt: timestamppb.New(time.Unix(0, 0))}
+	b := &pb.AuditEvent{Actor: "a", Session: "bc", CreatedAt: timestamppb.New(time.Unix(0, 0))}
+
+	require.NotEqual(t, Hash(key, a), Hash(key, b))
+}
@@ -1,10 +1,16 @@
 package auth
 
 import (
+	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
+	"sync"
+	"time"
 )
 
 const (
@@ -12,6 +18,35 @@ const (
 	tokenKey = "Ce45L1mMzQw5w09z"
 )
 
+// keys sign new tokens with the first key and accept tokens signed with any of them.
+var keys = struct {
+	sync.RWMutex
+	list [][]byte
+}{list: [][]byte{[]byte(tokenKey)}}
+
+// SetKeys replaces the key tokens are signed with, the built-in one when it
+// is empty, and the previous keys whose tokens are still accepted.
+func SetKeys(key string, previous []string) {
+	list := [][]byte{[]byte(key)}
+	if key == "" {
+		list[0] = []byte(tokenKey)
+	}
+	for _, k := range previous {
+		list = append(list, []byte(k))
+	}
+
+	keys.Lock()
+	defer keys.Unlock()
+	keys.list = list
+}
+
+func currentKeys() [][]byte {
+	keys.RLock()
+	defer keys.RUnlock()
+
+	return keys.list
+}
+
 func HashPass(password string) string {
 	h := sha1.New()
 	h.Write([]byte(password))
@@ -20,30 +55,68 @@ func HashPass(password string) string {
 }
 
 type claims struct {
-	jwt.MapClaims
+	jwt.StandardClaims
 	Login string `json:"login"`
 }
 
-func GenerateToken(login string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+// GenerateToken issues a token that expires after lifetime, or never with a zero lifetime.
+func GenerateToken(login string, lifetime time.Duration) (string, error) {
+	c := claims{
 		Login: login,
-	})
+	}
+	if lifetime != 0 {
+		c.ExpiresAt = time.Now().Add(lifetime).Unix()
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
 
-	signedToken, err := token.SignedString([]byte(tokenKey))
+	signedToken, err := token.SignedString(currentKeys()[0])
 	if err != nil {
 		return "", err
 	}
 	return signedToken, nil
 }
 
+// GenerateRefreshToken returns a random refresh token and the hash it is
+// stored by.
+func GenerateRefreshToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hash a refresh token is stored by.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func ParseToken(rawToken string) (string, error) {
+	var err error
+	for _, key := range currentKeys() {
+		var login string
+		login, err = parseToken(rawToken, key)
+		if err == nil {
+			return login, nil
+		}
+	}
+
+	return "", err
+}
+
+func parseToken(rawToken string, key []byte) (string, error) {
 	token, err := jwt.ParseWithClaims(rawToken, &claims{}, func(token *jwt.Token) (interface{}, error) {
 
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("wrong signing method")
 		}
 
-		return []byte(tokenKey), nil
+		return key, nil
 	})
 	if err != nil {
 		return "", err
@@ -3,6 +3,7 @@ package auth
 import (
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestHashPass(t *testing.T) {
@@ -37,9 +38,10 @@ func TestHashPass(t *testing.T) {
 
 func TestGenerateToken(t *testing.T) {
 	tests := []struct {
-		name    string
-		login   string
-		wantErr bool
+		name     string
+		login    string
+		lifetime time.Duration
+		wantErr  bool
 	}{
 		{
 			name:    "alphas",
@@ -56,12 +58,28 @@ func TestGenerateToken(t *testing.T) {
 			login:   "example@company.com",
 			wantErr: false,
 		},
+		{
+			name:     "expiring",
+			login:    "Login",
+			lifetime: time.Hour,
+			wantErr:  false,
+		},
+		{
+			name:     "expired",
+			login:    "Login",
+			lifetime: -time.Minute,
+			wantErr:  true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateToken(tt.login)
+			token, err := GenerateToken(tt.login, tt.lifetime)
 			require.NoError(t, err)
 			actual, err := ParseToken(token)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
 			require.NoError(t, err)
 			require.Equal(t, tt.login, actual)
 		})
@@ -100,3 +118,39 @@ func TestParseToken(t *testing.T) {
 		})
 	}
 }
+
+func TestSetKeys(t *testing.T) {
+	t.Cleanup(func() { SetKeys("", nil) })
+
+	old, err := GenerateToken("Login", 0)
+	require.NoError(t, err)
+
+	SetKeys("new key", []string{tokenKey})
+	rotated, err := GenerateToken("Login", 0)
+	require.NoError(t, err)
+	require.NotEqual(t, old, rotated)
+
+	for _, token := range []string{old, rotated} {
+		login, err := ParseToken(token)
+		require.NoError(t, err)
+		require.Equal(t, "Login", login)
+	}
+
+	SetKeys("new key", nil)
+	_, err = ParseToken(old)
+	require.Error(t, err)
+	_, err = ParseToken(rotated)
+	require.NoError(t, err)
+}
+
+func TestGenerateRefreshToken(t *testing.T) {
+	token, hash, err := GenerateRefreshToken()
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotEqual(t, token, hash)
+	require.Equal(t, hash, HashRefreshToken(token))
+
+	other, _, err := GenerateRefreshToken()
+	require.NoError(t, err)
+	require.NotEqual(t, token, other)
+}
@@ -0,0 +1,88 @@
+package broker
+
+import (
+	pb "praktikum-gophkeeper/proto"
+	"sync"
+)
+
+// bufferSize is the number of changes a subscriber may fall behind before it is dropped.
+const bufferSize = 64
+
+// Broker fans changes out to all subscriptions of the changed items' owner.
+type Broker struct {
+	mu            sync.Mutex
+	subscriptions map[string]map[*Subscription]struct{}
+}
+
+func New() *Broker {
+	return &Broker{
+		subscriptions: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription receives changes of a single user.
+// C is closed when the subscription is closed or falls too far behind,
+// in which case missed changes have to be loaded from the database.
+type Subscription struct {
+	C <-chan *pb.Change
+
+	c      chan *pb.Change
+	user   string
+	broker *Broker
+	closed bool
+}
+
+func (b *Broker) Subscribe(user string) *Subscription {
+	c := make(chan *pb.Change, bufferSize)
+	sub := &Subscription{
+		C:      c,
+		c:      c,
+		user:   user,
+		broker: b,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscriptions[user] == nil {
+		b.subscriptions[user] = map[*Subscription]struct{}{}
+	}
+	b.subscriptions[user][sub] = struct{}{}
+
+	return sub
+}
+
+func (b *Broker) Publish(user string, change *pb.Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscriptions[user] {
+		select {
+		case sub.c <- change:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
+
+// remove must be called with b.mu held.
+func (b *Broker) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+
+	sub.closed = true
+	close(sub.c)
+
+	delete(b.subscriptions[sub.user], sub)
+	if len(b.subscriptions[sub.user]) == 0 {
+		delete(b.subscriptions, sub.user)
+	}
+}
@@ -0,0 +1,50 @@
+package broker
+
+import (
+	"github.com/stretchr/testify/require"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	b := New()
+
+	first := b.Subscribe("user")
+	second := b.Subscribe("user")
+	other := b.Subscribe("other")
+
+	b.Publish("user", &pb.Change{Seq: 1})
+
+	require.Equal(t, int64(1), (<-first.C).Seq)
+	require.Equal(t, int64(1), (<-second.C).Seq)
+	require.Empty(t, other.C)
+
+	first.Close()
+	first.Close()
+	_, ok := <-first.C
+	require.False(t, ok)
+
+	b.Publish("user", &pb.Change{Seq: 2})
+	require.Equal(t, int64(2), (<-second.C).Seq)
+
+	second.Close()
+	other.Close()
+	require.Empty(t, b.subscriptions)
+}
+
+func TestBrokerSlowSubscriber(t *testing.T) {
+	b := New()
+	sub := b.Subscribe("user")
+
+	for i := 0; i <= bufferSize; i++ {
+		b.Publish("user", &pb.Change{Seq: int64(i + 1)})
+	}
+
+	received := 0
+	for range sub.C {
+		received++
+	}
+
+	require.Equal(t, bufferSize, received)
+	require.Empty(t, b.subscriptions)
+}
@@ -0,0 +1,385 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/scrypt"
+	"google.golang.org/protobuf/proto"
+	pb "praktikum-gophkeeper/proto"
+	"time"
+)
+
+var (
+	ErrWrongPassword = errors.New("wrong master password")
+	ErrNotFound      = errors.New("item not found in cache")
+	ErrNoConflict    = errors.New("conflict not found in cache")
+)
+
+var (
+	metaBucket      = []byte("meta")
+	itemsBucket     = []byte("items")
+	pendingBucket   = []byte("pending")
+	conflictsBucket = []byte("conflicts")
+
+	saltKey  = []byte("salt")
+	checkKey = []byte("check")
+	seqKey   = []byte("seq")
+)
+
+// checkValue is encrypted into the cache when it is created,
+// so that a wrong master password is detected on open.
+var checkValue = []byte("gophkeeper")
+
+const (
+	saltSize = 16
+	keySize  = 32
+)
+
+// Cache is a local copy of the vault stored in a bbolt file. Items and pending
+// operations are encrypted with AES-GCM using a key derived from the master password.
+type Cache struct {
+	db   *bolt.DB
+	aead cipher.AEAD
+}
+
+func Open(path string, masterPassword []byte) (*Cache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		db: db,
+	}
+
+	err = c.init(masterPassword)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+func (c *Cache) init(masterPassword []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{itemsBucket, pendingBucket, conflictsBucket} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		salt := meta.Get(saltKey)
+		if salt != nil {
+			err = c.setKey(masterPassword, salt)
+			if err != nil {
+				return err
+			}
+
+			check, err := c.decrypt(checkKey, meta.Get(checkKey))
+			if err != nil || !bytes.Equal(check, checkValue) {
+				return ErrWrongPassword
+			}
+
+			return nil
+		}
+
+		salt = make([]byte, saltSize)
+		_, err = rand.Read(salt)
+		if err != nil {
+			return err
+		}
+
+		err = c.setKey(masterPassword, salt)
+		if err != nil {
+			return err
+		}
+
+		check, err := c.encrypt(checkKey, checkValue)
+		if err != nil {
+			return err
+		}
+
+		err = meta.Put(saltKey, salt)
+		if err != nil {
+			return err
+		}
+
+		return meta.Put(checkKey, check)
+	})
+}
+
+func (c *Cache) setKey(masterPassword, salt []byte) error {
+	key, err := scrypt.Key(masterPassword, salt, 1<<15, 8, 1, keySize)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	c.aead, err = cipher.NewGCM(block)
+	return err
+}
+
+// encrypt seals value with a random nonce. The bucket key is used as additional data,
+// so an encrypted value can't be moved to another key unnoticed.
+func (c *Cache) encrypt(key, value []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, value, key), nil
+}
+
+func (c *Cache) decrypt(key, value []byte) ([]byte, error) {
+	if len(value) < c.aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	nonce, sealed := value[:c.aead.NonceSize()], value[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, sealed, key)
+}
+
+func (c *Cache) put(bucket *bolt.Bucket, key []byte, msg proto.Message) error {
+	plain, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	value, err := c.encrypt(key, plain)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(key, value)
+}
+
+func (c *Cache) get(key, value []byte, msg proto.Message) error {
+	plain, err := c.decrypt(key, value)
+	if err != nil {
+		return fmt.Errorf("couldn't decrypt cache entry %q: %w", key, err)
+	}
+
+	return proto.Unmarshal(plain, msg)
+}
+
+func itemKey(itemType pb.ItemType, id string) []byte {
+	return []byte(fmt.Sprintf("%d/%s", itemType, id))
+}
+
+// Seq returns the sequence number of the last change applied to the cache.
+func (c *Cache) Seq() (int64, error) {
+	var seq int64
+	err := c.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(metaBucket).Get(seqKey)
+		if value != nil {
+			seq = int64(binary.BigEndian.Uint64(value))
+		}
+
+		return nil
+	})
+
+	return seq, err
+}
+
+// Apply stores changes received from the server and moves the sequence number to seq.
+// Deleted and purged items are removed from the cache.
+func (c *Cache) Apply(changes []*pb.Change, seq int64) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		items := tx.Bucket(itemsBucket)
+		for _, change := range changes {
+			key := itemKey(change.GetType(), change.GetId())
+
+			var err error
+			switch change.GetOperation() {
+			case pb.Operation_OPERATION_DELETE, pb.Operation_OPERATION_PURGE:
+				err = items.Delete(key)
+			default:
+				err = c.put(items, key, change)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(seq))
+		return tx.Bucket(metaBucket).Put(seqKey, value)
+	})
+}
+
+// Item returns the cached server version of an item.
+func (c *Cache) Item(itemType pb.ItemType, id string) (*pb.Change, error) {
+	change := &pb.Change{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		key := itemKey(itemType, id)
+		value := tx.Bucket(itemsBucket).Get(key)
+		if value == nil {
+			return ErrNotFound
+		}
+
+		return c.get(key, value, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// Items returns cached server versions of all items of the type.
+func (c *Cache) Items(itemType pb.ItemType) ([]*pb.Change, error) {
+	var changes []*pb.Change
+	err := c.db.View(func(tx *bolt.Tx) error {
+		prefix := itemKey(itemType, "")
+		cursor := tx.Bucket(itemsBucket).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			change := &pb.Change{}
+			err := c.get(key, value, change)
+			if err != nil {
+				return err
+			}
+
+			changes = append(changes, change)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// Enqueue appends an operation to the queue of operations waiting to be replayed.
+func (c *Cache) Enqueue(op *pb.PendingOperation) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(pendingBucket)
+
+		seq, err := pending.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		op.Seq = seq
+		return c.put(pending, sequenceKey(seq), op)
+	})
+}
+
+// Pending returns queued operations in the order they were made.
+func (c *Cache) Pending() ([]*pb.PendingOperation, error) {
+	var ops []*pb.PendingOperation
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).ForEach(func(key, value []byte) error {
+			op := &pb.PendingOperation{}
+			err := c.get(key, value, op)
+			if err != nil {
+				return err
+			}
+
+			ops = append(ops, op)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+// Dequeue removes a replayed operation from the queue.
+func (c *Cache) Dequeue(seq uint64) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Delete(sequenceKey(seq))
+	})
+}
+
+// AddConflict stores a conflict to be resolved manually.
+func (c *Cache) AddConflict(conflict *pb.Conflict) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		conflicts := tx.Bucket(conflictsBucket)
+
+		seq, err := conflicts.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		conflict.Seq = seq
+		return c.put(conflicts, sequenceKey(seq), conflict)
+	})
+}
+
+// Conflicts returns unresolved conflicts in the order they were found.
+func (c *Cache) Conflicts() ([]*pb.Conflict, error) {
+	var conflicts []*pb.Conflict
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(conflictsBucket).ForEach(func(key, value []byte) error {
+			conflict := &pb.Conflict{}
+			err := c.get(key, value, conflict)
+			if err != nil {
+				return err
+			}
+
+			conflicts = append(conflicts, conflict)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+func (c *Cache) Conflict(seq uint64) (*pb.Conflict, error) {
+	conflict := &pb.Conflict{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		key := sequenceKey(seq)
+		value := tx.Bucket(conflictsBucket).Get(key)
+		if value == nil {
+			return ErrNoConflict
+		}
+
+		return c.get(key, value, conflict)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conflict, nil
+}
+
+func (c *Cache) RemoveConflict(seq uint64) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(conflictsBucket).Delete(sequenceKey(seq))
+	})
+}
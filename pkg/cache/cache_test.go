@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"path/filepath"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.db")
+
+	c, err := Open(path, []byte("master"))
+	require.NoError(t, err)
+
+	text := &pb.Change{
+		Seq:       1,
+		Type:      pb.ItemType_ITEM_TYPE_TEXT,
+		Id:        "a",
+		Operation: pb.Operation_OPERATION_CREATE,
+		Item:      &pb.Change_Text{Text: &pb.Text{Id: "a", Title: "note", Text: "secret"}},
+	}
+	password := &pb.Change{
+		Seq:       2,
+		Type:      pb.ItemType_ITEM_TYPE_PASSWORD,
+		Id:        "b",
+		Operation: pb.Operation_OPERATION_CREATE,
+		Item:      &pb.Change_Password{Password: &pb.Password{Id: "b", Website: "site"}},
+	}
+	require.NoError(t, c.Apply([]*pb.Change{text, password}, 2))
+
+	seq, err := c.Seq()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), seq)
+
+	texts, err := c.Items(pb.ItemType_ITEM_TYPE_TEXT)
+	require.NoError(t, err)
+	require.Len(t, texts, 1)
+	require.True(t, proto.Equal(text, texts[0]))
+
+	require.NoError(t, c.Enqueue(&pb.PendingOperation{Operation: pb.Operation_OPERATION_UPDATE, Item: text}))
+	require.NoError(t, c.Enqueue(&pb.PendingOperation{Operation: pb.Operation_OPERATION_DELETE, Item: password}))
+	require.NoError(t, c.Close())
+
+	_, err = Open(path, []byte("wrong"))
+	require.ErrorIs(t, err, ErrWrongPassword)
+
+	c, err = Open(path, []byte("master"))
+	require.NoError(t, err)
+	defer c.Close()
+
+	ops, err := c.Pending()
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	require.Equal(t, pb.Operation_OPERATION_UPDATE, ops[0].Operation)
+	require.Equal(t, pb.Operation_OPERATION_DELETE, ops[1].Operation)
+
+	require.NoError(t, c.Dequeue(ops[0].Seq))
+	ops, err = c.Pending()
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+
+	deleted := &pb.Change{Seq: 3, Type: pb.ItemType_ITEM_TYPE_TEXT, Id: "a", Operation: pb.Operation_OPERATION_DELETE}
+	require.NoError(t, c.Apply([]*pb.Change{deleted}, 3))
+
+	_, err = c.Item(pb.ItemType_ITEM_TYPE_TEXT, "a")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	item, err := c.Item(pb.ItemType_ITEM_TYPE_PASSWORD, "b")
+	require.NoError(t, err)
+	require.Equal(t, "site", item.GetPassword().GetWebsite())
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"praktikum-gophkeeper/pkg/audit"
+	pb "praktikum-gophkeeper/proto"
+)
+
+// AuditEvents returns the audit events of the user, oldest first.
+func (c *Client) AuditEvents(ctx context.Context) ([]*pb.AuditEvent, error) {
+	var events []*pb.AuditEvent
+	var seq int64
+	for {
+		resp, err := c.keeper.ListAuditEvents(ctx, &pb.ListAuditEventsRequest{Since: seq})
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, resp.GetEvents()...)
+		seq = resp.GetSeq()
+		if !resp.GetHasMore() {
+			return events, nil
+		}
+	}
+}
+
+// VerifyAudit checks that the audit events of the user link up and that none
+// but the latest were deleted. It returns the number of events. Only the
+// server holds the key that tells whether events were altered.
+func VerifyAudit(events []*pb.AuditEvent) (int64, error) {
+	var chain audit.Chain
+	for _, e := range events {
+		err := chain.Add(e)
+		if err != nil {
+			return chain.Len(), err
+		}
+	}
+
+	return chain.Len(), nil
+}
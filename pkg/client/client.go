@@ -0,0 +1,278 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	pb "praktikum-gophkeeper/proto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = 100 * time.Millisecond
+	maxBackoff        = 2 * time.Second
+	// maxRetryAfter is the longest wait a rate limited call is retried after,
+	// longer waits are left to the caller.
+	maxRetryAfter = 5 * time.Second
+	// retryAfterTrailer tells in whole seconds when a rate limited call may
+	// be retried.
+	retryAfterTrailer = "retry-after"
+)
+
+// Config configures a Client. Zero values take the defaults.
+type Config struct {
+	Address string
+	// TLS is used for the connection when it is set.
+	TLS *tls.Config
+	// Token is the token of an earlier session.
+	Token string
+	// RefreshToken gets a new token when the server rejects Token.
+	RefreshToken string
+	// Timeout is the deadline of calls whose context has none.
+	Timeout time.Duration
+	// MaxRetries is the number of times a call is repeated while the server is unavailable.
+	MaxRetries int
+	// Backoff is the delay before the first retry, which doubles with every next one.
+	Backoff time.Duration
+	// DialOptions are added to the options of the connection.
+	DialOptions []grpc.DialOption
+}
+
+// Client talks to the Authorization and GophKeeper services. It attaches the
+// session token to every call and gets a new one with the refresh token when
+// the server rejects it.
+type Client struct {
+	config Config
+	conn   *grpc.ClientConn
+	auth   pb.AuthorizationClient
+	keeper pb.GophKeeperClient
+
+	mu           sync.RWMutex
+	token        string
+	refreshToken string
+	// refreshMu lets a single call use the refresh token, which is replaced
+	// every time it is used.
+	refreshMu sync.Mutex
+}
+
+func New(config Config) (*Client, error) {
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.Backoff == 0 {
+		config.Backoff = defaultBackoff
+	}
+
+	c := &Client{
+		config:       config,
+		token:        config.Token,
+		refreshToken: config.RefreshToken,
+	}
+
+	creds := insecure.NewCredentials()
+	if config.TLS != nil {
+		creds = credentials.NewTLS(config.TLS)
+	}
+
+	// Every attempt carries the trace context of the caller, if there is one,
+	// so that the server's spans join its trace.
+	propagators := otelgrpc.WithPropagators(propagation.TraceContext{})
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(c.unaryInterceptor, otelgrpc.UnaryClientInterceptor(propagators)),
+		grpc.WithChainStreamInterceptor(c.streamInterceptor, otelgrpc.StreamClientInterceptor(propagators)),
+	}, config.DialOptions...)
+
+	conn, err := grpc.Dial(config.Address, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.conn = conn
+	c.auth = pb.NewAuthorizationClient(conn)
+	c.keeper = pb.NewGophKeeperClient(conn)
+
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// GophKeeper returns the underlying service client, which shares the token,
+// retries and deadlines of c.
+func (c *Client) GophKeeper() pb.GophKeeperClient {
+	return c.keeper
+}
+
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.token
+}
+
+// RefreshToken returns the refresh token of the session, which changes
+// whenever the token is refreshed.
+func (c *Client) RefreshToken() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.refreshToken
+}
+
+func (c *Client) Register(ctx context.Context, login, password string) error {
+	user := &pb.User{Login: login, Password: password}
+	resp, err := c.auth.RegisterUser(ctx, &pb.RegisterUserRequest{User: user})
+	if err != nil {
+		return err
+	}
+
+	c.setSession(resp.GetToken(), resp.GetRefreshToken())
+	return nil
+}
+
+func (c *Client) Login(ctx context.Context, login, password string) error {
+	user := &pb.User{Login: login, Password: password}
+	resp, err := c.auth.LoginUser(ctx, &pb.LoginUserRequest{User: user})
+	if err != nil {
+		return err
+	}
+
+	c.setSession(resp.GetToken(), resp.GetRefreshToken())
+	return nil
+}
+
+func (c *Client) setSession(token, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+	c.refreshToken = refreshToken
+}
+
+// refresh replaces the rejected token using the refresh token. It reports
+// whether there is a new token, which another call may have got already.
+func (c *Client) refresh(ctx context.Context, rejected string) bool {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if c.Token() != rejected {
+		return true
+	}
+
+	refreshToken := c.RefreshToken()
+	if refreshToken == "" {
+		return false
+	}
+
+	resp, err := c.auth.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: refreshToken})
+	if err != nil {
+		return false
+	}
+
+	c.setSession(resp.GetToken(), resp.GetRefreshToken())
+	return true
+}
+
+func (c *Client) withToken(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func isAuthMethod(method string) bool {
+	return strings.HasPrefix(method, "/gophkeeper.Authorization/")
+}
+
+// unaryInterceptor applies the default deadline, retries calls while the
+// server is unavailable or shortly after they were rate limited, and
+// refreshes a rejected token once.
+func (c *Client) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	backoff := c.config.Backoff
+	refreshed := false
+
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if _, ok := ctx.Deadline(); !ok {
+			callCtx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		}
+
+		var trailer metadata.MD
+		token := c.Token()
+		err := invoker(c.withToken(callCtx, token), method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+		cancel()
+
+		switch status.Code(err) {
+		case codes.ResourceExhausted:
+			wait, ok := retryAfter(trailer)
+			if ok && wait <= maxRetryAfter && attempt < c.config.MaxRetries {
+				select {
+				case <-ctx.Done():
+					return mapError(status.FromContextError(ctx.Err()).Err())
+				case <-time.After(wait):
+				}
+				continue
+			}
+		case codes.Unavailable:
+			if attempt < c.config.MaxRetries {
+				select {
+				case <-ctx.Done():
+					return mapError(status.FromContextError(ctx.Err()).Err())
+				case <-time.After(backoff):
+				}
+
+				backoff *= 2
+				if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+				continue
+			}
+		case codes.Unauthenticated:
+			if !refreshed && !isAuthMethod(method) && c.refresh(ctx, token) {
+				refreshed = true
+				continue
+			}
+		}
+
+		return mapError(err)
+	}
+}
+
+// retryAfter returns the wait the server asked for in the trailer of a rate
+// limited call.
+func retryAfter(trailer metadata.MD) (time.Duration, bool) {
+	values := trailer.Get(retryAfterTrailer)
+	if len(values) == 0 {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(values[0])
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// streamInterceptor attaches the token to streams, which have no default deadline.
+func (c *Client) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(c.withToken(ctx, c.Token()), desc, cc, method, opts...)
+	return stream, mapError(err)
+}
@@ -0,0 +1,298 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/tlsconfig"
+	pb "praktikum-gophkeeper/proto"
+	"slices"
+	"testing"
+	"time"
+)
+
+type fakeAuth struct {
+	pb.UnimplementedAuthorizationServer
+	logins    int
+	refreshes int
+}
+
+func (s *fakeAuth) LoginUser(_ context.Context, in *pb.LoginUserRequest) (*pb.LoginUserResponse, error) {
+	if in.GetUser().GetPassword() != "secret" {
+		return nil, status.Error(codes.InvalidArgument, "Invalid login or password.")
+	}
+
+	s.logins++
+	return &pb.LoginUserResponse{Token: "token", RefreshToken: "refresh 0"}, nil
+}
+
+func (s *fakeAuth) RefreshToken(_ context.Context, in *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	if in.GetRefreshToken() != fmt.Sprintf("refresh %d", s.refreshes) {
+		return nil, status.Error(codes.Unauthenticated, "Invalid refresh token")
+	}
+
+	s.refreshes++
+	return &pb.RefreshTokenResponse{Token: "token", RefreshToken: fmt.Sprintf("refresh %d", s.refreshes)}, nil
+}
+
+type fakeKeeper struct {
+	pb.UnimplementedGophKeeperServer
+	unavailable int
+	// limited calls are rate limited with a retry-after trailer of retryAfter.
+	limited    int
+	retryAfter string
+	// lost calls of AddBinary add the binary, but fail as if their response was lost.
+	lost     int
+	binaries []*pb.Binary
+}
+
+func (s *fakeKeeper) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) == 0 || values[0] != "Bearer token" {
+		return status.Error(codes.Unauthenticated, "Invalid token")
+	}
+
+	return nil
+}
+
+func (s *fakeKeeper) GetBinary(ctx context.Context, in *pb.GetBinaryRequest) (*pb.GetBinaryResponse, error) {
+	if s.unavailable > 0 {
+		s.unavailable--
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	if s.limited > 0 {
+		s.limited--
+		grpc.SetTrailer(ctx, metadata.Pairs(retryAfterTrailer, s.retryAfter))
+		return nil, status.Error(codes.ResourceExhausted, "Too many reads")
+	}
+
+	err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.GetBinaryResponse{}
+	for _, binary := range s.binaries {
+		if ids := in.GetFilter().GetIds(); len(ids) == 0 || slices.Contains(ids, binary.GetId()) {
+			resp.Binaries = append(resp.Binaries, binary)
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *fakeKeeper) AddBinary(ctx context.Context, in *pb.AddBinaryRequest) (*pb.AddBinaryResponse, error) {
+	err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	binary := in.GetBinary()
+	for _, b := range s.binaries {
+		if b.GetId() == binary.GetId() {
+			return nil, status.Error(codes.AlreadyExists, "Binary already exists")
+		}
+	}
+	s.binaries = append(s.binaries, binary)
+
+	if s.lost > 0 {
+		s.lost--
+		return nil, status.Error(codes.Unavailable, "connection reset")
+	}
+
+	return &pb.AddBinaryResponse{Binary: binary}, nil
+}
+
+func newTestClient(t *testing.T, config Config, opts ...grpc.ServerOption) (*Client, *fakeAuth, *fakeKeeper) {
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(opts...)
+	auth, keeper := &fakeAuth{}, &fakeKeeper{}
+	pb.RegisterAuthorizationServer(srv, auth)
+	pb.RegisterGophKeeperServer(srv, keeper)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	config.Address = "bufnet"
+	config.Backoff = time.Millisecond
+	config.DialOptions = []grpc.DialOption{
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+	}
+
+	c, err := New(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	return c, auth, keeper
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c, auth, keeper := newTestClient(t, Config{})
+
+	_, err := c.Binaries().List(ctx)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	err = c.Login(ctx, "user", "wrong")
+	require.ErrorIs(t, err, ErrInvalidArgument)
+
+	require.NoError(t, c.Login(ctx, "user", "secret"))
+	require.Equal(t, "token", c.Token())
+
+	// The retry of an upload whose response was lost doesn't add it twice.
+	keeper.lost = 1
+	binary, err := c.Binaries().Upload(ctx, "file", bytes.NewBufferString("content"))
+	require.NoError(t, err)
+	require.NotEmpty(t, binary.GetId())
+	require.Len(t, keeper.binaries, 1)
+
+	keeper.unavailable = 2
+	var content bytes.Buffer
+	require.NoError(t, c.Binaries().Download(ctx, binary.GetId(), &content))
+	require.Equal(t, "content", content.String())
+
+	keeper.unavailable = defaultMaxRetries + 1
+	_, err = c.Binaries().List(ctx)
+	require.ErrorIs(t, err, ErrUnavailable)
+
+	_, err = c.Binaries().Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// A rejected token is refreshed with the refresh token, which is replaced.
+	c.setSession("expired", c.RefreshToken())
+	_, err = c.Binaries().List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, auth.logins)
+	require.Equal(t, 1, auth.refreshes)
+	require.Equal(t, "token", c.Token())
+	require.Equal(t, "refresh 1", c.RefreshToken())
+
+	// A used refresh token isn't accepted again.
+	c.setSession("expired", "refresh 0")
+	_, err = c.Binaries().List(ctx)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		limited    int
+		retryAfter string
+		wantErr    error
+	}{
+		{name: "short wait", limited: 2, retryAfter: "0"},
+		{name: "long wait", limited: 1, retryAfter: "60", wantErr: ErrResourceExhausted},
+		{name: "no wait", limited: 1, retryAfter: "soon", wantErr: ErrResourceExhausted},
+		{name: "retries exhausted", limited: defaultMaxRetries + 1, retryAfter: "0", wantErr: ErrResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, _, keeper := newTestClient(t, Config{})
+			require.NoError(t, c.Login(ctx, "user", "secret"))
+
+			keeper.limited, keeper.retryAfter = tt.limited, tt.retryAfter
+			_, err := c.Binaries().List(ctx)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	serverOpts, err := tlsconfig.Dev(dir, []string{"localhost"})
+	require.NoError(t, err)
+	caFile := filepath.Join(dir, tlsconfig.DevCAFile)
+
+	tests := []struct {
+		name       string
+		clientAuth bool
+		wantErr    error
+	}{
+		{
+			name: "TLS",
+		},
+		{
+			name:       "client certificate required",
+			clientAuth: true,
+			wantErr:    ErrUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := serverOpts
+			if tt.clientAuth {
+				opts.CAFile = caFile
+			}
+			serverTLS, err := tlsconfig.Server(opts)
+			require.NoError(t, err)
+
+			clientTLS, err := tlsconfig.Client(tlsconfig.Options{CAFile: caFile})
+			require.NoError(t, err)
+			clientTLS.ServerName = "localhost"
+
+			c, _, _ := newTestClient(t, Config{TLS: clientTLS, MaxRetries: 1}, grpc.Creds(credentials.NewTLS(serverTLS)))
+			err = c.Login(ctx, "user", "secret")
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestClientTracePropagation(t *testing.T) {
+	var traceparent []string
+	record := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		traceparent = md.Get("traceparent")
+		return handler(ctx, req)
+	}
+	c, _, _ := newTestClient(t, Config{}, grpc.UnaryInterceptor(record))
+
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	require.NoError(t, c.Login(ctx, "user", "secret"))
+	require.Len(t, traceparent, 1)
+	require.Contains(t, traceparent[0], traceID.String())
+
+	require.NoError(t, c.Login(context.Background(), "user", "secret"))
+	require.Empty(t, traceparent)
+}
+
+func TestMapError(t *testing.T) {
+	require.NoError(t, mapError(nil))
+
+	plain := errors.New("plain")
+	require.Equal(t, plain, mapError(plain))
+
+	err := mapError(status.Error(codes.DeadlineExceeded, "slow"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, "slow", err.Error())
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrInvalidArgument    = errors.New("invalid argument")
+	ErrFailedPrecondition = errors.New("failed precondition")
+	ErrUnauthenticated    = errors.New("unauthenticated")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrResourceExhausted  = errors.New("resource exhausted")
+	ErrUnavailable        = errors.New("server is unavailable")
+)
+
+var codeErrors = map[codes.Code]error{
+	codes.NotFound:           ErrNotFound,
+	codes.AlreadyExists:      ErrAlreadyExists,
+	codes.InvalidArgument:    ErrInvalidArgument,
+	codes.FailedPrecondition: ErrFailedPrecondition,
+	codes.Unauthenticated:    ErrUnauthenticated,
+	codes.PermissionDenied:   ErrPermissionDenied,
+	codes.ResourceExhausted:  ErrResourceExhausted,
+	codes.Unavailable:        ErrUnavailable,
+	codes.DeadlineExceeded:   context.DeadlineExceeded,
+	codes.Canceled:           context.Canceled,
+}
+
+// Error is a call the server failed. It matches the package error of its
+// status code with errors.Is, and status.Code still reports the code.
+type Error struct {
+	status *status.Status
+	err    error
+}
+
+func (e *Error) Error() string {
+	return e.status.Message()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func (e *Error) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// mapError wraps gRPC status errors into Error.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	return &Error{
+		status: st,
+		err:    codeErrors[st.Code()],
+	}
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	pb "praktikum-gophkeeper/proto"
+)
+
+type item interface {
+	proto.Message
+	GetId() string
+}
+
+// itemAPI binds Items to the calls of a single item type.
+type itemAPI[T item] struct {
+	add    func(ctx context.Context, client pb.GophKeeperClient, item T) (T, error)
+	find   func(ctx context.Context, client pb.GophKeeperClient, key string, filter *pb.Filter) ([]T, error)
+	update func(ctx context.Context, client pb.GophKeeperClient, id string, item T) error
+	delete func(ctx context.Context, client pb.GophKeeperClient, id string) error
+}
+
+// Items manages items of one type.
+type Items[T item] struct {
+	client pb.GophKeeperClient
+	api    itemAPI[T]
+}
+
+type (
+	Passwords = Items[*pb.Password]
+	Texts     = Items[*pb.Text]
+	Cards     = Items[*pb.Payment]
+)
+
+// Binaries manages binaries, whose content can also be moved from and to streams.
+type Binaries struct {
+	*Items[*pb.Binary]
+}
+
+// List returns all items.
+func (s *Items[T]) List(ctx context.Context) ([]T, error) {
+	return s.api.find(ctx, s.client, "", nil)
+}
+
+// Find returns items with the title (website for passwords, name for cards)
+// matching the filter. Either may be empty.
+func (s *Items[T]) Find(ctx context.Context, title string, filter *pb.Filter) ([]T, error) {
+	return s.api.find(ctx, s.client, title, filter)
+}
+
+// Get returns the item with the id.
+func (s *Items[T]) Get(ctx context.Context, id string) (T, error) {
+	var zero T
+
+	items, err := s.api.find(ctx, s.client, "", &pb.Filter{Ids: []string{id}})
+	if err != nil {
+		return zero, err
+	}
+
+	for _, item := range items {
+		if item.GetId() == id {
+			return item, nil
+		}
+	}
+
+	return zero, ErrNotFound
+}
+
+// Add creates an item and returns it with the fields set by the server. An
+// item without an id is sent with a new one, so that a call retried after its
+// response was lost finds the item it created instead of adding it twice.
+func (s *Items[T]) Add(ctx context.Context, item T) (T, error) {
+	if item.GetId() != "" {
+		return s.api.add(ctx, s.client, item)
+	}
+
+	id := uuid.NewString()
+	added, err := s.api.add(ctx, s.client, withID(item, id))
+	if errors.Is(err, ErrAlreadyExists) {
+		return s.Get(ctx, id)
+	}
+
+	return added, err
+}
+
+// withID returns a copy of the item with the id.
+func withID[T item](item T, id string) T {
+	clone := proto.Clone(item).(T)
+	m := clone.ProtoReflect()
+	m.Set(m.Descriptor().Fields().ByName("id"), protoreflect.ValueOfString(id))
+
+	return clone
+}
+
+func (s *Items[T]) Update(ctx context.Context, id string, item T) error {
+	return s.api.update(ctx, s.client, id, item)
+}
+
+// Delete moves an item to trash.
+func (s *Items[T]) Delete(ctx context.Context, id string) error {
+	return s.api.delete(ctx, s.client, id)
+}
+
+// Download writes the content of a binary to w.
+func (s Binaries) Download(ctx context.Context, id string, w io.Writer) error {
+	binary, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(binary.GetFile())
+	return err
+}
+
+// Upload adds a binary with the content read from r.
+func (s Binaries) Upload(ctx context.Context, title string, r io.Reader) (*pb.Binary, error) {
+	var content bytes.Buffer
+	_, err := content.ReadFrom(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Add(ctx, &pb.Binary{Title: title, File: content.Bytes()})
+}
+
+func (c *Client) Passwords() *Passwords {
+	return &Passwords{
+		client: c.keeper,
+		api: itemAPI[*pb.Password]{
+			add: func(ctx context.Context, client pb.GophKeeperClient, item *pb.Password) (*pb.Password, error) {
+				resp, err := client.AddPassword(ctx, &pb.AddPasswordRequest{Password: item})
+				return resp.GetPassword(), err
+			},
+			find: func(ctx context.Context, client pb.GophKeeperClient, key string, filter *pb.Filter) ([]*pb.Password, error) {
+				resp, err := client.GetPassword(ctx, &pb.GetPasswordRequest{Website: key, Filter: filter})
+				return resp.GetPasswords(), err
+			},
+			update: func(ctx context.Context, client pb.GophKeeperClient, id string, item *pb.Password) error {
+				_, err := client.UpdatePassword(ctx, &pb.UpdatePasswordRequest{Id: id, Password: item})
+				return err
+			},
+			delete: func(ctx context.Context, client pb.GophKeeperClient, id string) error {
+				_, err := client.DeletePassword(ctx, &pb.DeletePasswordRequest{Id: id})
+				return err
+			},
+		},
+	}
+}
+
+func (c *Client) Texts() *Texts {
+	return &Texts{
+		client: c.keeper,
+		api: itemAPI[*pb.Text]{
+			add: func(ctx context.Context, client pb.GophKeeperClient, item *pb.Text) (*pb.Text, error) {
+				resp, err := client.AddText(ctx, &pb.AddTextRequest{Text: item})
+				return resp.GetText(), err
+			},
+			find: func(ctx context.Context, client pb.GophKeeperClient, key string, filter *pb.Filter) ([]*pb.Text, error) {
+				resp, err := client.GetText(ctx, &pb.GetTextRequest{Title: key, Filter: filter})
+				return resp.GetTexts(), err
+			},
+			update: func(ctx context.Context, client pb.GophKeeperClient, id string, item *pb.Text) error {
+				_, err := client.UpdateText(ctx, &pb.UpdateTextRequest{Id: id, Text: item})
+				return err
+			},
+			delete: func(ctx context.Context, client pb.GophKeeperClient, id string) error {
+				_, err := client.DeleteText(ctx, &pb.DeleteTextRequest{Id: id})
+				return err
+			},
+		},
+	}
+}
+
+func (c *Client) Binaries() Binaries {
+	return Binaries{&Items[*pb.Binary]{
+		client: c.keeper,
+		api: itemAPI[*pb.Binary]{
+			add: func(ctx context.Context, client pb.GophKeeperClient, item *pb.Binary) (*pb.Binary, error) {
+				resp, err := client.AddBinary(ctx, &pb.AddBinaryRequest{Binary: item})
+				return resp.GetBinary(), err
+			},
+			find: func(ctx context.Context, client pb.GophKeeperClient, key string, filter *pb.Filter) ([]*pb.Binary, error) {
+				resp, err := client.GetBinary(ctx, &pb.GetBinaryRequest{Title: key, Filter: filter})
+				return resp.GetBinaries(), err
+			},
+			update: func(ctx context.Context, client pb.GophKeeperClient, id string, item *pb.Binary) error {
+				_, err := client.UpdateBinary(ctx, &pb.UpdateBinaryRequest{Id: id, Binary: item})
+				return err
+			},
+			delete: func(ctx context.Context, client pb.GophKeeperClient, id string) error {
+				_, err := client.DeleteBinary(ctx, &pb.DeleteBinaryRequest{Id: id})
+				return err
+			},
+		},
+	}}
+}
+
+func (c *Client) Cards() *Cards {
+	return &Cards{
+		client: c.keeper,
+		api: itemAPI[*pb.Payment]{
+			add: func(ctx context.Context, client pb.GophKeeperClient, item *pb.Payment) (*pb.Payment, error) {
+				resp, err := client.AddPayment(ctx, &pb.AddPaymentRequest{Payment: item})
+				return resp.GetPayment(), err
+			},
+			find: func(ctx context.Context, client pb.GophKeeperClient, key string, filter *pb.Filter) ([]*pb.Payment, error) {
+				resp, err := client.GetPayment(ctx, &pb.GetPaymentRequest{Name: key, Filter: filter})
+				return resp.GetPayments(), err
+			},
+			update: func(ctx context.Context, client pb.GophKeeperClient, id string, item *pb.Payment) error {
+				_, err := client.UpdatePayment(ctx, &pb.UpdatePaymentRequest{Id: id, Payment: item})
+				return err
+			},
+			delete: func(ctx context.Context, client pb.GophKeeperClient, id string) error {
+				_, err := client.DeletePayment(ctx, &pb.DeletePaymentRequest{Id: id})
+				return err
+			},
+		},
+	}
+}
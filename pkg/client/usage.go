@@ -0,0 +1,12 @@
+package client
+
+import (
+	"context"
+	pb "praktikum-gophkeeper/proto"
+)
+
+// Usage returns what the items of the user take and the quota they take it
+// from.
+func (c *Client) Usage(ctx context.Context) (*pb.GetUsageResponse, error) {
+	return c.keeper.GetUsage(ctx, &pb.GetUsageRequest{})
+}
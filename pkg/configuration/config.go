@@ -0,0 +1,514 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/logging"
+	"praktikum-gophkeeper/pkg/tlsconfig"
+	"praktikum-gophkeeper/pkg/tracing"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of the server. Every setting takes its value
+// from, in increasing priority, the defaults, the configuration file, the
+// environment variable in its env tag and the flag in its flag tag. Settings
+// tagged with reload can change without a restart, see Server.Reload, and
+// ones tagged with secret are redacted.
+type Config struct {
+	Address   string    `yaml:"address" json:"address" env:"RUN_ADDRESS" flag:"a"`
+	DSN       string    `yaml:"dsn" json:"dsn" env:"DSN" flag:"d"`
+	Database  Database  `yaml:"database" json:"database"`
+	Tokens    Tokens    `yaml:"tokens" json:"tokens"`
+	Trash     Trash     `yaml:"trash" json:"trash"`
+	History   History   `yaml:"history" json:"history"`
+	TLS       TLS       `yaml:"tls" json:"tls"`
+	Limits    Limits    `yaml:"limits" json:"limits"`
+	RateLimit RateLimit `yaml:"rate_limit" json:"rate_limit"`
+	Quota     Quota     `yaml:"quota" json:"quota"`
+	Audit     Audit     `yaml:"audit" json:"audit"`
+	Log       Log       `yaml:"log" json:"log"`
+	Health    Health    `yaml:"health" json:"health"`
+	Metrics   Metrics   `yaml:"metrics" json:"metrics"`
+	Tracing   Tracing   `yaml:"tracing" json:"tracing"`
+	Features  Features  `yaml:"features" json:"features"`
+}
+
+// Database sizes the connection pool.
+type Database struct {
+	MaxConns        int32    `yaml:"max_conns" json:"max_conns" env:"DB_MAX_CONNS"`
+	MinConns        int32    `yaml:"min_conns" json:"min_conns" env:"DB_MIN_CONNS"`
+	MaxConnLifetime Duration `yaml:"max_conn_lifetime" json:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+	MaxConnIdleTime Duration `yaml:"max_conn_idle_time" json:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+}
+
+type Tokens struct {
+	// Lifetime of issued tokens, zero issues tokens that don't expire.
+	Lifetime Duration `yaml:"lifetime" json:"lifetime" env:"TOKEN_LIFETIME" reload:"true"`
+	// RefreshLifetime of issued refresh tokens, which get new tokens once
+	// each, zero issues refresh tokens that don't expire.
+	RefreshLifetime Duration `yaml:"refresh_lifetime" json:"refresh_lifetime" env:"TOKEN_REFRESH_LIFETIME" reload:"true"`
+	// Secret signs tokens, a built-in key when empty.
+	Secret string `yaml:"secret" json:"secret" env:"TOKEN_SECRET" secret:"true" reload:"true"`
+	// PreviousSecrets still verify tokens after the secret was rotated.
+	PreviousSecrets []string `yaml:"previous_secrets" json:"previous_secrets" env:"TOKEN_PREVIOUS_SECRETS" secret:"true" reload:"true"`
+}
+
+type Trash struct {
+	Retention     Duration `yaml:"retention" json:"retention" env:"TRASH_RETENTION" flag:"r"`
+	PurgeInterval Duration `yaml:"purge_interval" json:"purge_interval" env:"TRASH_PURGE_INTERVAL"`
+}
+
+// History bounds the previous versions of items kept for users.
+type History struct {
+	// MaxDepth is the largest history depth users can choose.
+	MaxDepth uint32 `yaml:"max_depth" json:"max_depth" env:"HISTORY_MAX_DEPTH" reload:"true"`
+}
+
+// TLS is disabled without a certificate or a development directory. The
+// files are reloaded when they change, turning TLS on or off needs a restart.
+type TLS struct {
+	Cert       string `yaml:"cert" json:"cert" env:"TLS_CERT" flag:"tls-cert" reload:"true"`
+	Key        string `yaml:"key" json:"key" env:"TLS_KEY" flag:"tls-key" reload:"true"`
+	ClientCA   string `yaml:"client_ca" json:"client_ca" env:"TLS_CLIENT_CA" flag:"tls-client-ca" reload:"true"`
+	MinVersion string `yaml:"min_version" json:"min_version" env:"TLS_MIN_VERSION" flag:"tls-min-version" reload:"true"`
+	Ciphers    string `yaml:"ciphers" json:"ciphers" env:"TLS_CIPHERS" flag:"tls-ciphers" reload:"true"`
+	DevDir     string `yaml:"dev_dir" json:"dev_dir" env:"TLS_DEV_DIR" flag:"tls-dev" reload:"true"`
+}
+
+type Limits struct {
+	// MaxMessageSize is the largest request in bytes, which bounds the size of binaries.
+	MaxMessageSize       int    `yaml:"max_message_size" json:"max_message_size" env:"MAX_MESSAGE_SIZE"`
+	MaxConcurrentStreams uint32 `yaml:"max_concurrent_streams" json:"max_concurrent_streams" env:"MAX_CONCURRENT_STREAMS"`
+}
+
+// RateLimit limits the calls of every user by class with token buckets:
+// bursts of calls go through at once, then calls at the rate per second. A
+// zero rate doesn't limit calls. Authorization calls are limited by address.
+type RateLimit struct {
+	ReadsPerSecond   float64 `yaml:"reads_per_second" json:"reads_per_second" env:"RATE_LIMIT_READS" reload:"true"`
+	ReadsBurst       int     `yaml:"reads_burst" json:"reads_burst" env:"RATE_LIMIT_READS_BURST" reload:"true"`
+	WritesPerSecond  float64 `yaml:"writes_per_second" json:"writes_per_second" env:"RATE_LIMIT_WRITES" reload:"true"`
+	WritesBurst      int     `yaml:"writes_burst" json:"writes_burst" env:"RATE_LIMIT_WRITES_BURST" reload:"true"`
+	UploadsPerSecond float64 `yaml:"uploads_per_second" json:"uploads_per_second" env:"RATE_LIMIT_UPLOADS" reload:"true"`
+	UploadsBurst     int     `yaml:"uploads_burst" json:"uploads_burst" env:"RATE_LIMIT_UPLOADS_BURST" reload:"true"`
+	AuthPerSecond    float64 `yaml:"auth_per_second" json:"auth_per_second" env:"RATE_LIMIT_AUTH" reload:"true"`
+	AuthBurst        int     `yaml:"auth_burst" json:"auth_burst" env:"RATE_LIMIT_AUTH_BURST" reload:"true"`
+	// MaxConcurrent calls are handled at once, more are shed. Zero doesn't
+	// limit them.
+	MaxConcurrent int `yaml:"max_concurrent" json:"max_concurrent" env:"MAX_CONCURRENT_CALLS" reload:"true"`
+}
+
+// Quota is the default quota of users, the server's -set-quota flag gives a
+// user a quota of its own. Trashed items count until they are purged. Zero
+// limits don't limit anything.
+type Quota struct {
+	// Items is the maximum number of items of every type.
+	Items int64 `yaml:"items" json:"items" env:"QUOTA_ITEMS" reload:"true"`
+	// Bytes is the maximum size of all items and their previous versions.
+	Bytes int64 `yaml:"bytes" json:"bytes" env:"QUOTA_BYTES" reload:"true"`
+}
+
+// Audit keys the hashes of audit events with a secret kept out of the
+// database, so that whoever can write the database can't rewrite the log.
+// Events recorded before the secret changed no longer verify.
+type Audit struct {
+	Secret string `yaml:"secret" json:"secret" env:"AUDIT_SECRET" secret:"true"`
+}
+
+type Log struct {
+	// Output is a file the log is appended to, standard error when empty. It
+	// is reopened on reload, after it was rotated.
+	Output string `yaml:"output" json:"output" env:"LOG_OUTPUT" reload:"true"`
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" json:"level" env:"LOG_LEVEL" flag:"log-level" reload:"true"`
+	// Format is text or json.
+	Format string `yaml:"format" json:"format" env:"LOG_FORMAT" flag:"log-format"`
+}
+
+// Health reports the server as serving while the database answers pings.
+type Health struct {
+	// Address of the HTTP listener of /healthz and /readyz, none when empty.
+	Address  string   `yaml:"address" json:"address" env:"HEALTH_ADDRESS" flag:"health-address"`
+	Interval Duration `yaml:"interval" json:"interval" env:"HEALTH_INTERVAL"`
+	Timeout  Duration `yaml:"timeout" json:"timeout" env:"HEALTH_TIMEOUT"`
+}
+
+// Metrics are served in the Prometheus format.
+type Metrics struct {
+	// Address of the HTTP listener, none when empty. It can be the one of
+	// the health checks.
+	Address string `yaml:"address" json:"address" env:"METRICS_ADDRESS" flag:"metrics-address"`
+	Path    string `yaml:"path" json:"path" env:"METRICS_PATH"`
+	// StoredInterval is how often the size of the stored items is measured.
+	StoredInterval Duration `yaml:"stored_interval" json:"stored_interval" env:"METRICS_STORED_INTERVAL"`
+}
+
+// Tracing exports OpenTelemetry spans of calls and database queries.
+type Tracing struct {
+	// Exporter is none, otlp or stdout.
+	Exporter string `yaml:"exporter" json:"exporter" env:"TRACING_EXPORTER" flag:"tracing"`
+	// Endpoint is the host:port of the OTLP gRPC collector, the one of
+	// OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317 when empty.
+	Endpoint string `yaml:"endpoint" json:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure bool   `yaml:"insecure" json:"insecure" env:"TRACING_INSECURE"`
+	// File the stdout exporter appends to, standard output when empty.
+	File string `yaml:"file" json:"file" env:"TRACING_FILE"`
+	// SampleRatio of the traces started by the server, the ones started by
+	// clients follow their decision.
+	SampleRatio float64 `yaml:"sample_ratio" json:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+type Features struct {
+	Registration bool `yaml:"registration" json:"registration" env:"FEATURE_REGISTRATION" reload:"true"`
+	Watch        bool `yaml:"watch" json:"watch" env:"FEATURE_WATCH"`
+	Purge        bool `yaml:"purge" json:"purge" env:"FEATURE_PURGE"`
+}
+
+// Duration is a time.Duration written like 1h30m in files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func Defaults() Config {
+	return Config{
+		Address: ":8080",
+		Database: Database{
+			MaxConns:        10,
+			MinConns:        1,
+			MaxConnLifetime: Duration(time.Hour),
+			MaxConnIdleTime: Duration(30 * time.Minute),
+		},
+		Tokens: Tokens{
+			RefreshLifetime: Duration(defaultRefreshLifetime),
+		},
+		Trash: Trash{
+			Retention:     Duration(defaultRetention),
+			PurgeInterval: Duration(time.Hour),
+		},
+		History: History{
+			MaxDepth: 100,
+		},
+		Limits: Limits{
+			MaxMessageSize:       4 << 20,
+			MaxConcurrentStreams: 100,
+		},
+		RateLimit: RateLimit{
+			ReadsPerSecond:   20,
+			ReadsBurst:       50,
+			WritesPerSecond:  5,
+			WritesBurst:      20,
+			UploadsPerSecond: 0.5,
+			UploadsBurst:     5,
+			AuthPerSecond:    1,
+			AuthBurst:        10,
+			MaxConcurrent:    200,
+		},
+		Quota: Quota{
+			Items: 10000,
+			Bytes: 1 << 30,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: logging.FormatText,
+		},
+		Health: Health{
+			Interval: Duration(10 * time.Second),
+			Timeout:  Duration(2 * time.Second),
+		},
+		Metrics: Metrics{
+			Path:           "/metrics",
+			StoredInterval: Duration(time.Minute),
+		},
+		Tracing: Tracing{
+			Exporter:    tracing.ExporterNone,
+			SampleRatio: 1,
+		},
+		Features: Features{
+			Registration: true,
+			Watch:        true,
+			Purge:        true,
+		},
+	}
+}
+
+// Load builds the configuration from the file at path, which may be empty,
+// the environment and the flags set in flags, which must be parsed. It
+// reports every invalid setting at once.
+func Load(path string, flags *flag.FlagSet) (Config, error) {
+	config := Defaults()
+
+	if path != "" {
+		err := readFile(path, &config)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []error
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	walk(reflect.ValueOf(&config).Elem(), "", func(v reflect.Value, name string, field reflect.StructField) {
+		if env := field.Tag.Get("env"); env != "" {
+			if value, ok := os.LookupEnv(env); ok && value != "" {
+				err := setValue(v, value)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s (%s): %w", name, env, err))
+				}
+			}
+		}
+
+		if fl := field.Tag.Get("flag"); fl != "" && set[fl] {
+			err := setValue(v, flags.Lookup(fl).Value.String())
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s (-%s): %w", name, fl, err))
+			}
+		}
+	})
+
+	errs = append(errs, config.validate()...)
+	if len(errs) > 0 {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	return config, nil
+}
+
+// readFile reads a YAML file, or a JSON one with a .json extension. Unknown
+// settings are refused to catch typos.
+func readFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read configuration file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// walk calls visit with every setting and its name in the file.
+func walk(v reflect.Value, prefix string, visit func(v reflect.Value, name string, field reflect.StructField)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := prefix + strings.Split(field.Tag.Get("yaml"), ",")[0]
+
+		if field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), name+".", visit)
+			continue
+		}
+
+		visit(v.Field(i), name, field)
+	}
+}
+
+func setValue(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("expected true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("expected an integer")
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		var values []string
+		for _, value := range strings.Split(s, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		v.Set(reflect.ValueOf(values))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.New("expected a number")
+		}
+		v.SetFloat(f)
+	case reflect.Uint32:
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return errors.New("expected a non-negative integer")
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
+
+func (c Config) validate() []error {
+	var errs []error
+	check := func(ok bool, name, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(c.Address)
+	check(err == nil, "address", "expected host:port, got %q", c.Address)
+	check(c.DSN != "", "dsn", "is required")
+
+	check(c.Database.MaxConns > 0, "database.max_conns", "must be positive")
+	check(c.Database.MinConns >= 0 && c.Database.MinConns <= c.Database.MaxConns,
+		"database.min_conns", "must be between 0 and database.max_conns")
+	check(c.Database.MaxConnLifetime >= 0, "database.max_conn_lifetime", "can't be negative")
+	check(c.Database.MaxConnIdleTime >= 0, "database.max_conn_idle_time", "can't be negative")
+
+	check(c.Tokens.Lifetime >= 0, "tokens.lifetime", "can't be negative")
+	check(c.Tokens.RefreshLifetime >= 0, "tokens.refresh_lifetime", "can't be negative")
+
+	check(c.Trash.Retention > 0, "trash.retention", "must be positive")
+	check(c.Trash.PurgeInterval > 0, "trash.purge_interval", "must be positive")
+
+	// Depths are stored as INTEGER.
+	check(c.History.MaxDepth <= math.MaxInt32, "history.max_depth", "can't be larger than %d", math.MaxInt32)
+
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls", "cert and key must be set together")
+	check(c.TLS.ClientCA == "" || c.TLS.Cert != "" || c.TLS.DevDir != "",
+		"tls.client_ca", "requires TLS, set cert and key or dev_dir")
+	_, err = tlsconfig.ParseVersion(c.TLS.MinVersion)
+	check(err == nil, "tls.min_version", "%v", err)
+	_, err = tlsconfig.ParseCipherSuites(c.TLS.Ciphers)
+	check(err == nil, "tls.ciphers", "%v", err)
+
+	check(c.Limits.MaxMessageSize > 0, "limits.max_message_size", "must be positive")
+	check(c.Limits.MaxConcurrentStreams > 0, "limits.max_concurrent_streams", "must be positive")
+
+	for _, rate := range []struct {
+		name      string
+		perSecond float64
+		burst     int
+	}{
+		{"reads", c.RateLimit.ReadsPerSecond, c.RateLimit.ReadsBurst},
+		{"writes", c.RateLimit.WritesPerSecond, c.RateLimit.WritesBurst},
+		{"uploads", c.RateLimit.UploadsPerSecond, c.RateLimit.UploadsBurst},
+		{"auth", c.RateLimit.AuthPerSecond, c.RateLimit.AuthBurst},
+	} {
+		check(rate.perSecond >= 0, "rate_limit."+rate.name+"_per_second", "can't be negative")
+		check(rate.perSecond == 0 || rate.burst > 0, "rate_limit."+rate.name+"_burst", "must be positive")
+	}
+	check(c.RateLimit.MaxConcurrent >= 0, "rate_limit.max_concurrent", "can't be negative")
+
+	check(c.Quota.Items >= 0, "quota.items", "can't be negative")
+	check(c.Quota.Bytes >= 0, "quota.bytes", "can't be negative")
+
+	check(c.Audit.Secret != "", "audit.secret", "is required")
+
+	_, err = logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level", "expected debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == logging.FormatText || c.Log.Format == logging.FormatJSON,
+		"log.format", "expected text or json, got %q", c.Log.Format)
+
+	if c.Health.Address != "" {
+		_, _, err = net.SplitHostPort(c.Health.Address)
+		check(err == nil, "health.address", "expected host:port, got %q", c.Health.Address)
+	}
+	check(c.Health.Interval > 0, "health.interval", "must be positive")
+	check(c.Health.Timeout > 0, "health.timeout", "must be positive")
+
+	if c.Metrics.Address != "" {
+		_, _, err = net.SplitHostPort(c.Metrics.Address)
+		check(err == nil, "metrics.address", "expected host:port, got %q", c.Metrics.Address)
+	}
+	check(strings.HasPrefix(c.Metrics.Path, "/"), "metrics.path", "must start with /")
+	check(c.Metrics.Path != "/healthz" && c.Metrics.Path != "/readyz", "metrics.path", "is taken by health checks")
+	check(c.Metrics.StoredInterval > 0, "metrics.stored_interval", "must be positive")
+
+	check(c.Tracing.Exporter == tracing.ExporterNone || c.Tracing.Exporter == tracing.ExporterOTLP || c.Tracing.Exporter == tracing.ExporterStdout,
+		"tracing.exporter", "expected none, otlp or stdout, got %q", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1")
+
+	return errs
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|[^\s&]+)`)
+
+const redacted = "REDACTED"
+
+// Redacted returns the configuration with secrets hidden.
+func (c Config) Redacted() Config {
+	walk(reflect.ValueOf(&c).Elem(), "", func(v reflect.Value, _ string, field reflect.StructField) {
+		if field.Tag.Get("secret") == "" || v.IsZero() {
+			return
+		}
+
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString(redacted)
+		case reflect.Slice:
+			v.Set(reflect.ValueOf([]string{redacted}))
+		}
+	})
+
+	u, err := url.Parse(c.DSN)
+	if err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		c.DSN = u.String()
+	}
+	c.DSN = dsnPassword.ReplaceAllString(c.DSN, "${1}"+redacted)
+
+	return c
+}
+
+// YAML formats the configuration like the configuration file.
+func (c Config) YAML() (string, error) {
+	data, err := yaml.Marshal(c)
+	return string(data), err
+}
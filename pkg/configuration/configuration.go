@@ -2,72 +2,290 @@ package configuration
 
 import (
 	"context"
-	"errors"
+	"crypto/tls"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
-	"os"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/auth"
+	"praktikum-gophkeeper/pkg/health"
+	"praktikum-gophkeeper/pkg/logging"
+	"praktikum-gophkeeper/pkg/metrics"
+	"praktikum-gophkeeper/pkg/ratelimit"
 	"praktikum-gophkeeper/pkg/service"
+	"praktikum-gophkeeper/pkg/storage"
+	"praktikum-gophkeeper/pkg/tlsconfig"
+	"praktikum-gophkeeper/pkg/tracing"
 	pb "praktikum-gophkeeper/proto"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	envAddress = "RUN_ADDRESS"
-	envDSN     = "DSN"
+	defaultRetention       = 30 * 24 * time.Hour
+	defaultRefreshLifetime = 30 * 24 * time.Hour
 )
 
 type Server struct {
-	Address string
-	DSN     string
-	DB      *pgx.Conn
-	Server  *grpc.Server
+	Config Config
+	// TLS is nil when the server accepts plaintext connections.
+	TLS        *tls.Config
+	DB         *pgxpool.Pool
+	Server     *grpc.Server
+	Auth       *service.AuthServer
+	GophKeeper *service.GophKeeperServer
+	Health     *health.Checker
+
+	// disabled and tls are replaced on reload.
+	disabled     atomic.Pointer[methods]
+	tls          atomic.Pointer[tls.Config]
+	limiter      *ratelimit.Limiter
+	defaultQuota *storage.DefaultQuota
 }
 
-func NewServer(flAddress, flDSN *string) (Server, error) {
-	address, err := parseStringVar(flAddress, envAddress)
+func NewServer(config Config) (*Server, error) {
+	s := &Server{Config: config}
+
+	tlsConfig, err := newTLSConfig(config.Address, config.TLS)
 	if err != nil {
-		return Server{}, err
+		return nil, err
+	}
+	if tlsConfig != nil {
+		s.tls.Store(tlsConfig)
+		s.TLS = &tls.Config{GetConfigForClient: s.tlsForClient}
 	}
 
-	dsn, err := parseStringVar(flDSN, envDSN)
+	poolConfig, err := pgxpool.ParseConfig(config.DSN)
 	if err != nil {
-		return Server{}, err
+		return nil, err
 	}
+	poolConfig.MaxConns = config.Database.MaxConns
+	poolConfig.MinConns = config.Database.MinConns
+	poolConfig.MaxConnLifetime = time.Duration(config.Database.MaxConnLifetime)
+	poolConfig.MaxConnIdleTime = time.Duration(config.Database.MaxConnIdleTime)
+	poolConfig.ConnConfig.Tracer = queryTracers{tracing.QueryTracer{}, metrics.QueryTracer{}}
 
-	conn, err := pgx.Connect(context.Background(), dsn)
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
-		return Server{}, err
+		return nil, err
 	}
 
-	srv := grpc.NewServer()
+	s.DB = pool
 
-	authServer, err := service.NewAuthServer(conn)
+	err = metrics.RegisterPool(pool)
 	if err != nil {
-		return Server{}, err
+		return nil, err
 	}
-	pb.RegisterAuthorizationServer(srv, authServer)
 
-	gophkeeperServer, err := service.NewGophKeeperServer(conn)
+	auth.SetKeys(config.Tokens.Secret, config.Tokens.PreviousSecrets)
+	disabled := disabledMethods(config.Features)
+	s.disabled.Store(&disabled)
+	s.limiter = ratelimit.New(config.RateLimit.rates(), config.RateLimit.MaxConcurrent)
+	s.defaultQuota = storage.NewDefaultQuota(config.Quota.quota())
+
+	s.Auth, err = service.NewAuthServer(pool, time.Duration(config.Tokens.Lifetime), time.Duration(config.Tokens.RefreshLifetime))
 	if err != nil {
-		return Server{}, err
+		return nil, err
 	}
-	pb.RegisterGophKeeperServer(srv, gophkeeperServer)
 
-	return Server{
-		Address: address,
-		DSN:     dsn,
-		DB:      conn,
-		Server:  srv,
-	}, nil
+	s.GophKeeper, err = service.NewGophKeeperServer(pool, s.defaultQuota, []byte(config.Audit.Secret))
+	if err != nil {
+		return nil, err
+	}
+	s.GophKeeper.SetMaxHistoryDepth(config.History.MaxDepth)
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			otelgrpc.UnaryServerInterceptor(),
+			logging.UnaryInterceptor,
+			metrics.UnaryInterceptor,
+			s.limiter.ShedUnaryInterceptor,
+			s.unaryInterceptor,
+			service.AuthUnaryInterceptor,
+			s.limiter.UnaryInterceptor,
+			s.GophKeeper.AuditUnaryInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			otelgrpc.StreamServerInterceptor(),
+			logging.StreamInterceptor,
+			metrics.StreamInterceptor,
+			s.streamInterceptor,
+			service.AuthStreamInterceptor,
+			s.limiter.StreamInterceptor,
+			s.GophKeeper.AuditStreamInterceptor,
+		),
+		grpc.MaxRecvMsgSize(config.Limits.MaxMessageSize),
+		grpc.MaxConcurrentStreams(config.Limits.MaxConcurrentStreams),
+	}
+	if s.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.TLS)))
+	}
+	s.Server = grpc.NewServer(opts...)
+
+	pb.RegisterAuthorizationServer(s.Server, s.Auth)
+	pb.RegisterGophKeeperServer(s.Server, s.GophKeeper)
+
+	s.Health = health.New(pool.Ping, pb.Authorization_ServiceDesc.ServiceName, pb.GophKeeper_ServiceDesc.ServiceName)
+	healthpb.RegisterHealthServer(s.Server, s.Health.Server())
+
+	return s, nil
 }
 
-func parseStringVar(flag *string, envName string) (string, error) {
-	if *flag != "" {
-		return *flag, nil
+// HTTPServers returns the HTTP listeners of the health checks and the
+// metrics, one for every address.
+func (s *Server) HTTPServers() []*http.Server {
+	var servers []*http.Server
+	muxes := map[string]*http.ServeMux{}
+	mux := func(address string) *http.ServeMux {
+		if muxes[address] == nil {
+			muxes[address] = http.NewServeMux()
+			servers = append(servers, &http.Server{
+				Addr:              address,
+				Handler:           muxes[address],
+				ReadHeaderTimeout: 5 * time.Second,
+			})
+		}
+
+		return muxes[address]
 	}
 
-	value := os.Getenv(envName)
-	if value == "" {
-		return "", errors.New("not enough parameters to run service")
+	if s.Config.Health.Address != "" {
+		handler := s.Health.Handler()
+		mux(s.Config.Health.Address).Handle("/healthz", handler)
+		mux(s.Config.Health.Address).Handle("/readyz", handler)
 	}
-	return value, nil
+	if s.Config.Metrics.Address != "" {
+		mux(s.Config.Metrics.Address).Handle(s.Config.Metrics.Path, metrics.Handler())
+	}
+
+	return servers
+}
+
+// tlsForClient hands connections to the TLS configuration in effect when
+// they are accepted.
+func (s *Server) tlsForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	config := s.tls.Load()
+	if config.GetConfigForClient != nil {
+		return config.GetConfigForClient(hello)
+	}
+
+	return config, nil
+}
+
+// queryTracers passes queries to every tracer in turn.
+type queryTracers []pgx.QueryTracer
+
+func (t queryTracers) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, tracer := range t {
+		ctx = tracer.TraceQueryStart(ctx, conn, data)
+	}
+
+	return ctx
+}
+
+func (t queryTracers) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for _, tracer := range t {
+		tracer.TraceQueryEnd(ctx, conn, data)
+	}
+}
+
+// rates returns the limits of every class of calls.
+func (c RateLimit) rates() map[ratelimit.Class]ratelimit.Rate {
+	return map[ratelimit.Class]ratelimit.Rate{
+		ratelimit.Reads:   {PerSecond: c.ReadsPerSecond, Burst: c.ReadsBurst},
+		ratelimit.Writes:  {PerSecond: c.WritesPerSecond, Burst: c.WritesBurst},
+		ratelimit.Uploads: {PerSecond: c.UploadsPerSecond, Burst: c.UploadsBurst},
+		ratelimit.Auth:    {PerSecond: c.AuthPerSecond, Burst: c.AuthBurst},
+	}
+}
+
+func (c Quota) quota() storage.Quota {
+	return storage.Quota{Items: c.Items, Bytes: c.Bytes}
+}
+
+// methods maps the methods turned off by feature toggles to their error.
+type methods map[string]error
+
+func disabledMethods(features Features) methods {
+	disabled := methods{}
+	if !features.Registration {
+		disabled[pb.Authorization_RegisterUser_FullMethodName] = status.Error(codes.PermissionDenied, "Registration is disabled")
+	}
+	if !features.Watch {
+		disabled[pb.GophKeeper_Watch_FullMethodName] = status.Error(codes.Unimplemented, "Watch is disabled")
+	}
+
+	return disabled
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err, ok := (*s.disabled.Load())[info.FullMethod]; ok {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err, ok := (*s.disabled.Load())[info.FullMethod]; ok {
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+// newTLSConfig returns nil without a certificate or a development directory.
+func newTLSConfig(address string, config TLS) (*tls.Config, error) {
+	opts := tlsconfig.Options{
+		CertFile: config.Cert,
+		KeyFile:  config.Key,
+		CAFile:   config.ClientCA,
+	}
+
+	if opts.CertFile == "" && config.DevDir != "" {
+		dev, err := tlsconfig.Dev(config.DevDir, devHosts(address))
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Warn("Using development certificates", "ca", filepath.Join(config.DevDir, tlsconfig.DevCAFile))
+		opts.CertFile, opts.KeyFile = dev.CertFile, dev.KeyFile
+	}
+	if opts.CertFile == "" {
+		return nil, nil
+	}
+
+	var err error
+	opts.MinVersion, err = tlsconfig.ParseVersion(config.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.CipherSuites, err = tlsconfig.ParseCipherSuites(config.Ciphers)
+	if err != nil {
+		return nil, err
+	}
+
+	return tlsconfig.Server(opts)
+}
+
+// devHosts are the names of development certificates, the host of the
+// address and the local ones.
+func devHosts(address string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	host, _, err := net.SplitHostPort(address)
+	if err == nil && host != "" && host != "localhost" && host != "127.0.0.1" && host != "::1" {
+		hosts = append(hosts, host)
+	}
+
+	return hosts
 }
@@ -0,0 +1,146 @@
+package configuration
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"log/slog"
+	"praktikum-gophkeeper/pkg/auth"
+	"praktikum-gophkeeper/pkg/logging"
+	"reflect"
+	"time"
+)
+
+// change is a setting that differs between two configurations.
+type change struct {
+	name     string
+	from, to string
+	reload   bool
+}
+
+// attrs describe the change in the log. Secrets look the same once redacted,
+// so only their names are logged.
+func (c change) attrs() []any {
+	if c.from == c.to {
+		return []any{"setting", c.name}
+	}
+
+	return []any{"setting", c.name, "from", c.from, "to", c.to}
+}
+
+// fields returns the settings of the configuration in the order walk visits
+// them.
+func fields(c *Config) []reflect.Value {
+	var values []reflect.Value
+	walk(reflect.ValueOf(c).Elem(), "", func(v reflect.Value, _ string, _ reflect.StructField) {
+		values = append(values, v)
+	})
+
+	return values
+}
+
+// diff returns the settings that differ, with secrets redacted.
+func diff(old, new Config) []change {
+	oldRedacted, newRedacted := old.Redacted(), new.Redacted()
+	oldValues, oldShown, newShown := fields(&old), fields(&oldRedacted), fields(&newRedacted)
+
+	var changes []change
+	i := 0
+	walk(reflect.ValueOf(&new).Elem(), "", func(v reflect.Value, name string, field reflect.StructField) {
+		defer func() { i++ }()
+		if reflect.DeepEqual(oldValues[i].Interface(), v.Interface()) {
+			return
+		}
+
+		changes = append(changes, change{
+			name:   name,
+			from:   format(oldShown[i]),
+			to:     format(newShown[i]),
+			reload: field.Tag.Get("reload") != "",
+		})
+	})
+
+	return changes
+}
+
+func format(v reflect.Value) string {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Reload applies the settings of the configuration that can change while the
+// server runs and logs what changed. The rest need a restart and keep their
+// values. Calls in flight finish with the settings they started with.
+func (s *Server) Reload(config Config) {
+	for _, c := range diff(s.Config, config) {
+		if !c.reload {
+			slog.Warn("Setting not changed, requires a restart", c.attrs()...)
+		}
+	}
+
+	next := s.Config
+	nextValues, values := fields(&next), fields(&config)
+	i := 0
+	walk(reflect.ValueOf(&config).Elem(), "", func(_ reflect.Value, _ string, field reflect.StructField) {
+		if field.Tag.Get("reload") != "" {
+			nextValues[i].Set(values[i])
+		}
+		i++
+	})
+
+	if next.TLS != s.Config.TLS {
+		err := s.reloadTLS(next)
+		if err != nil {
+			slog.Error("TLS settings not changed", "error", err)
+			next.TLS = s.Config.TLS
+		}
+	}
+
+	// The file is reopened even when its path is the same, after it was rotated.
+	err := logging.Output.Open(next.Log.Output)
+	if err != nil {
+		slog.Error("Log output not changed", "error", err)
+		next.Log.Output = s.Config.Log.Output
+	}
+	level, _ := logging.ParseLevel(next.Log.Level)
+	logging.Level.Set(level)
+
+	auth.SetKeys(next.Tokens.Secret, next.Tokens.PreviousSecrets)
+	s.Auth.SetTokenLifetime(time.Duration(next.Tokens.Lifetime))
+	s.Auth.SetRefreshLifetime(time.Duration(next.Tokens.RefreshLifetime))
+	disabled := disabledMethods(next.Features)
+	s.disabled.Store(&disabled)
+	s.limiter.Set(next.RateLimit.rates(), next.RateLimit.MaxConcurrent)
+	s.defaultQuota.Set(next.Quota.quota())
+	s.GophKeeper.SetMaxHistoryDepth(next.History.MaxDepth)
+
+	changes := diff(s.Config, next)
+	for _, c := range changes {
+		slog.Info("Setting changed", c.attrs()...)
+	}
+	if len(changes) == 0 {
+		slog.Info("No setting changed")
+	}
+
+	s.Config = next
+}
+
+func (s *Server) reloadTLS(next Config) error {
+	tlsConfig, err := newTLSConfig(next.Address, next.TLS)
+	if err != nil {
+		return err
+	}
+	if (tlsConfig == nil) != (s.TLS == nil) {
+		return errors.New("turning TLS on or off requires a restart")
+	}
+	if tlsConfig != nil {
+		s.tls.Store(tlsConfig)
+	}
+
+	return nil
+}
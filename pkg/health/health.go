@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Checker reports the services as serving while the database answers pings,
+// through the standard gRPC health service and over HTTP.
+type Checker struct {
+	server   *health.Server
+	ping     func(context.Context) error
+	services []string
+}
+
+// New returns a checker of the services, and of the server as a whole under
+// the empty name. They aren't serving until the first ping succeeds.
+func New(ping func(context.Context) error, services ...string) *Checker {
+	c := &Checker{
+		server:   health.NewServer(),
+		ping:     ping,
+		services: append([]string{""}, services...),
+	}
+	c.set(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return c
+}
+
+// Server is the gRPC health service.
+func (c *Checker) Server() healthpb.HealthServer {
+	return c.server
+}
+
+func (c *Checker) set(status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range c.services {
+		c.server.SetServingStatus(service, status)
+	}
+}
+
+// Run pings the database every interval until the context is done.
+func (c *Checker) Run(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Only changes are logged.
+	serving, first := false, true
+	for {
+		err := c.check(ctx, timeout)
+		switch {
+		case ctx.Err() != nil:
+		case err != nil && (serving || first):
+			slog.Error("Database isn't reachable, not serving", "error", err)
+		case err == nil && !serving:
+			slog.Info("Database is reachable, serving")
+		}
+		serving, first = err == nil, false
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := c.ping(ctx)
+	if err != nil {
+		c.set(healthpb.HealthCheckResponse_NOT_SERVING)
+		return err
+	}
+
+	c.set(healthpb.HealthCheckResponse_SERVING)
+	return nil
+}
+
+// Shutdown reports every service as not serving for good, so that balancers
+// stop sending calls while the server stops.
+func (c *Checker) Shutdown() {
+	c.server.Shutdown()
+}
+
+// Handler serves /healthz, which succeeds while the process runs, and
+// /readyz, which succeeds while the server is serving.
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := c.server.Check(r.Context(), &healthpb.HealthCheckRequest{})
+		if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+			http.Error(w, "not serving", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+
+	return mux
+}
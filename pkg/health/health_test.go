@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	var down atomic.Bool
+	c := New(func(context.Context) error {
+		if down.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, "gophkeeper.GophKeeper")
+
+	handler := c.Handler()
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	status := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := c.Server().Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+
+	tests := []struct {
+		name   string
+		check  func()
+		status healthpb.HealthCheckResponse_ServingStatus
+		ready  int
+	}{
+		{
+			name:   "before the first ping",
+			check:  func() {},
+			status: healthpb.HealthCheckResponse_NOT_SERVING,
+			ready:  http.StatusServiceUnavailable,
+		},
+		{
+			name:   "database reachable",
+			check:  func() { require.NoError(t, c.check(context.Background(), time.Second)) },
+			status: healthpb.HealthCheckResponse_SERVING,
+			ready:  http.StatusOK,
+		},
+		{
+			name: "database unreachable",
+			check: func() {
+				down.Store(true)
+				require.Error(t, c.check(context.Background(), time.Second))
+			},
+			status: healthpb.HealthCheckResponse_NOT_SERVING,
+			ready:  http.StatusServiceUnavailable,
+		},
+		{
+			name: "shutdown",
+			check: func() {
+				down.Store(false)
+				c.Shutdown()
+				require.NoError(t, c.check(context.Background(), time.Second))
+			},
+			status: healthpb.HealthCheckResponse_NOT_SERVING,
+			ready:  http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check()
+
+			require.Equal(t, tt.status, status(""))
+			require.Equal(t, tt.status, status("gophkeeper.GophKeeper"))
+			require.Equal(t, tt.ready, get("/readyz"))
+			require.Equal(t, http.StatusOK, get("/healthz"))
+		})
+	}
+}
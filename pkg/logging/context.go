@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"sync"
+)
+
+type requestKey struct{}
+
+// request is the call a record is logged for.
+type request struct {
+	id string
+
+	mu    sync.Mutex
+	login string
+}
+
+func withRequest(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey{}, &request{id: id})
+}
+
+func requestFrom(ctx context.Context) *request {
+	if ctx == nil {
+		return nil
+	}
+
+	r, _ := ctx.Value(requestKey{}).(*request)
+	return r
+}
+
+// RequestID returns the id of the call, empty outside of calls.
+func RequestID(ctx context.Context) string {
+	r := requestFrom(ctx)
+	if r == nil {
+		return ""
+	}
+
+	return r.id
+}
+
+// SetLogin attaches the authenticated login to the records of the call,
+// including the ones of interceptors that run before authentication.
+func SetLogin(ctx context.Context, login string) {
+	r := requestFrom(ctx)
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.login = login
+}
+
+func (r *request) getLogin() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.login
+}
@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"log/slog"
+	pb "praktikum-gophkeeper/proto"
+	"reflect"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// sensitive messages are never logged, not even as a part of other messages.
+var sensitive = map[protoreflect.FullName]bool{
+	(&pb.Password{}).ProtoReflect().Descriptor().FullName(): true,
+	(&pb.Payment{}).ProtoReflect().Descriptor().FullName():  true,
+	(&pb.User{}).ProtoReflect().Descriptor().FullName():     true,
+}
+
+// sensitiveKeys are attributes whose values are redacted whatever they are.
+var sensitiveKeys = map[string]bool{
+	"password":        true,
+	"master_password": true,
+	"token":           true,
+	"refresh_token":   true,
+	"pin":             true,
+}
+
+var protoMessage = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// handler adds the request to records and redacts secrets from them.
+type handler struct {
+	slog.Handler
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	record := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	if req := requestFrom(ctx); req != nil {
+		record.AddAttrs(slog.String("request_id", req.id))
+		if login := req.getLogin(); login != "" {
+			record.AddAttrs(slog.String("login", login))
+		}
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		record.AddAttrs(redact(a))
+		return true
+	})
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redactedAttrs[i] = redact(a)
+	}
+
+	return handler{h.Handler.WithAttrs(redactedAttrs)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{h.Handler.WithGroup(name)}
+}
+
+// redact replaces sensitive messages, and values that hold any messages, with
+// REDACTED. Other messages are logged without their sensitive fields.
+func redact(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		a.Value = slog.StringValue(redacted)
+		return a
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		attrs := make([]slog.Attr, len(group))
+		for i, attr := range group {
+			attrs[i] = redact(attr)
+		}
+		a.Value = slog.GroupValue(attrs...)
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+		case proto.Message:
+			a.Value = messageValue(v)
+		default:
+			if holdsMessage(reflect.ValueOf(v), 0) {
+				a.Value = slog.StringValue(redacted)
+			}
+		}
+	}
+
+	return a
+}
+
+func messageValue(m proto.Message) slog.Value {
+	if m == nil || !m.ProtoReflect().IsValid() {
+		return slog.StringValue("<nil>")
+	}
+	if sensitive[m.ProtoReflect().Descriptor().FullName()] {
+		return slog.StringValue(redacted)
+	}
+
+	m = proto.Clone(m)
+	clearSensitive(m.ProtoReflect())
+	return slog.StringValue(prototext.MarshalOptions{}.Format(m))
+}
+
+// clearSensitive clears the fields of the message that hold sensitive ones.
+func clearSensitive(m protoreflect.Message) {
+	var cleared []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				break
+			}
+			if sensitive[fd.MapValue().Message().FullName()] {
+				cleared = append(cleared, fd)
+				break
+			}
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				clearSensitive(v.Message())
+				return true
+			})
+		case fd.Message() == nil:
+		case sensitive[fd.Message().FullName()]:
+			cleared = append(cleared, fd)
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				clearSensitive(v.List().Get(i).Message())
+			}
+		default:
+			clearSensitive(v.Message())
+		}
+
+		return true
+	})
+
+	for _, fd := range cleared {
+		m.Clear(fd)
+	}
+}
+
+// holdsMessage tells whether a value which isn't a message holds messages,
+// which would be logged with all their fields.
+func holdsMessage(v reflect.Value, depth int) bool {
+	if !v.IsValid() || depth > 8 {
+		return false
+	}
+	if v.Type().Implements(protoMessage) || reflect.PointerTo(v.Type()).Implements(protoMessage) {
+		return true
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return !v.IsNil() && holdsMessage(v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if holdsMessage(v.Index(i), depth+1) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if holdsMessage(iter.Value(), depth+1) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if holdsMessage(v.Field(i), depth+1) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+// RequestIDHeader carries the id of a call in its response metadata. A
+// client may choose the id by sending it in the request metadata.
+const RequestIDHeader = "x-request-id"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func requestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get(RequestIDHeader); len(ids) > 0 && validRequestID.MatchString(ids[0]) {
+		return ids[0]
+	}
+
+	return uuid.NewString()
+}
+
+// UnaryInterceptor gives every call an id for its records, returns it in the
+// response metadata and logs the outcome of the call.
+func UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	id := requestID(ctx)
+	ctx = withRequest(ctx, id)
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, start, err)
+
+	return resp, err
+}
+
+// StreamInterceptor is UnaryInterceptor for streaming calls.
+func StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id := requestID(ss.Context())
+	ctx := withRequest(ss.Context(), id)
+	ss.SetHeader(metadata.Pairs(RequestIDHeader, id))
+
+	start := time.Now()
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	logCall(ctx, info.FullMethod, start, err)
+
+	return err
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// logCall logs failures of the server as errors and the rest as information.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("status", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+
+	slog.LogAttrs(ctx, level, "Call", attrs...)
+}
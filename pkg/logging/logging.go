@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Formats of log lines.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	// Level of logged records, it can change while the server runs.
+	Level = new(slog.LevelVar)
+	// Output is where the log is written.
+	Output = &Writer{out: os.Stderr}
+)
+
+// Setup makes the default logger, which the log package writes through as
+// well, write records in the format to Output. Records carry the request
+// they were logged for and never contain secrets.
+func Setup(format string) error {
+	opts := &slog.HandlerOptions{Level: Level}
+
+	var h slog.Handler
+	switch format {
+	case FormatText, "":
+		h = slog.NewTextHandler(Output, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(Output, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	slog.SetDefault(slog.New(handler{h}))
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// Writer is a log output that can be replaced while the server runs.
+type Writer struct {
+	mu   sync.Mutex
+	out  io.Writer
+	file *os.File
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.out.Write(p)
+}
+
+// Open appends the log to the file, standard error when the path is empty,
+// and closes the file written before. Opening the same path again picks up
+// a rotated file.
+func (w *Writer) Open(path string) error {
+	var out io.Writer = os.Stderr
+	var file *os.File
+	if path != "" {
+		var err error
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return err
+		}
+		out = file
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.out, w.file = out, file
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+func newLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(handler{slog.NewJSONHandler(buf, nil)})
+}
+
+func TestRedact(t *testing.T) {
+	password := &pb.Password{Website: "example.com", Login: "user", Password: "hunter2"}
+	payment := &pb.Payment{Name: "card", Number: "4111111111111111", Code: "123"}
+	user := &pb.User{Login: "user", Password: "hunter2"}
+
+	tests := []struct {
+		name string
+		attr slog.Attr
+		want []string
+	}{
+		{
+			name: "password",
+			attr: slog.Any("value", password),
+			want: []string{redacted},
+		},
+		{
+			name: "payment",
+			attr: slog.Any("value", payment),
+			want: []string{redacted},
+		},
+		{
+			name: "user",
+			attr: slog.Any("value", user),
+			want: []string{redacted},
+		},
+		{
+			name: "request holding a user",
+			attr: slog.Any("value", &pb.LoginUserRequest{User: user}),
+		},
+		{
+			name: "response holding passwords",
+			attr: slog.Any("value", &pb.GetPasswordResponse{Passwords: []*pb.Password{password}}),
+		},
+		{
+			name: "change holding a payment",
+			attr: slog.Any("value", &pb.Change{Seq: 7, Id: "id", Item: &pb.Change_Payment{Payment: payment}}),
+			want: []string{"seq:7", `id:\"id\"`},
+		},
+		{
+			name: "slice of passwords",
+			attr: slog.Any("value", []*pb.Password{password}),
+			want: []string{redacted},
+		},
+		{
+			name: "struct holding a user",
+			attr: slog.Any("value", struct{ User *pb.User }{user}),
+			want: []string{redacted},
+		},
+		{
+			name: "group",
+			attr: slog.Group("value", slog.Any("user", user)),
+			want: []string{redacted},
+		},
+		{
+			name: "sensitive key",
+			attr: slog.String("password", "hunter2"),
+			want: []string{redacted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			newLogger(&buf).Info("message", tt.attr)
+
+			logged := buf.String()
+			for _, secret := range []string{"hunter2", "4111111111111111", `"123"`} {
+				require.NotContains(t, logged, secret)
+			}
+			for _, want := range tt.want {
+				require.Contains(t, logged, want)
+			}
+		})
+	}
+}
+
+func TestWithAttrsRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	newLogger(&buf).With("user", &pb.User{Password: "hunter2"}).Info("message")
+
+	require.NotContains(t, buf.String(), "hunter2")
+}
+
+func TestHandlerAddsRequest(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf)
+
+	ctx := withRequest(context.Background(), "request")
+	SetLogin(ctx, "user")
+	logger.InfoContext(ctx, "message")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "request", record["request_id"])
+	require.Equal(t, "user", record["login"])
+
+	buf.Reset()
+	logger.InfoContext(context.Background(), "message")
+	require.NotContains(t, buf.String(), "request_id")
+}
+
+type transportStream struct {
+	header metadata.MD
+}
+
+func (s *transportStream) Method() string { return "/gophkeeper.GophKeeper/GetPassword" }
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+func (s *transportStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+func (s *transportStream) SetTrailer(metadata.MD) error    { return nil }
+
+func TestUnaryInterceptor(t *testing.T) {
+	tests := []struct {
+		name   string
+		md     metadata.MD
+		err    error
+		wantID string
+		want   string
+	}{
+		{
+			name:   "client id",
+			md:     metadata.Pairs(RequestIDHeader, "client-id.1"),
+			wantID: "client-id.1",
+			want:   `"level":"INFO"`,
+		},
+		{
+			name: "invalid client id",
+			md:   metadata.Pairs(RequestIDHeader, "bad id\n"),
+			want: `"level":"INFO"`,
+		},
+		{
+			name: "generated id",
+			md:   metadata.MD{},
+			err:  status.Error(codes.NotFound, "Not found"),
+			want: `"status":"NotFound"`,
+		},
+		{
+			name: "server failure",
+			md:   metadata.MD{},
+			err:  errors.New("failure"),
+			want: `"level":"ERROR"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(newLogger(&buf))
+
+			stream := &transportStream{}
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+			info := &grpc.UnaryServerInfo{FullMethod: stream.Method()}
+
+			var id string
+			_, err := UnaryInterceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+				id = RequestID(ctx)
+				return nil, tt.err
+			})
+			require.Equal(t, tt.err, err)
+
+			require.NotEmpty(t, id)
+			if tt.wantID != "" {
+				require.Equal(t, tt.wantID, id)
+			}
+			require.Equal(t, []string{id}, stream.header.Get(RequestIDHeader))
+			require.Contains(t, buf.String(), `"request_id":"`+id+`"`)
+			require.Contains(t, buf.String(), tt.want)
+		})
+	}
+}
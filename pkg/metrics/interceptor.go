@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// UnaryInterceptor records the count, status code and duration of calls.
+func UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observe(info.FullMethod, start, err)
+
+	return resp, err
+}
+
+// StreamInterceptor is UnaryInterceptor for streaming calls.
+func StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observe(info.FullMethod, start, err)
+
+	return err
+}
+
+func observe(method string, start time.Time, err error) {
+	rpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	rpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
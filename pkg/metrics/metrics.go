@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+	pb "praktikum-gophkeeper/proto"
+	"strings"
+	"time"
+)
+
+const namespace = "gophkeeper"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "requests_total",
+		Help:      "Calls handled by method and status code.",
+	}, []string{"method", "code"})
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "duration_seconds",
+		Help:      "Time calls took by method, until the end of the stream for streaming ones.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "query_duration_seconds",
+		Help:      "Time database queries took by table and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"table", "operation"})
+	storedBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "stored_bytes",
+		Help:      "Size of the stored items by type, trashed ones included.",
+	}, []string{"type"})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Logins by result, success or failure.",
+	}, []string{"result"})
+	registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "registrations_total",
+		Help:      "Registered users.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		rpcRequests, rpcDuration, queryDuration, storedBytes, logins, registrations,
+	)
+}
+
+// Handler serves the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Login counts a login.
+func Login(ok bool) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+
+	logins.WithLabelValues(result).Inc()
+}
+
+// Registration counts a registered user.
+func Registration() {
+	registrations.Inc()
+}
+
+// RegisterPool exports the usage of the connection pool.
+func RegisterPool(pool *pgxpool.Pool) error {
+	gauge := func(name, help string, value func(*pgxpool.Stat) int32) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			return float64(value(pool.Stat()))
+		})
+	}
+
+	for _, c := range []prometheus.Collector{
+		gauge("acquired_conns", "Connections in use.", (*pgxpool.Stat).AcquiredConns),
+		gauge("idle_conns", "Idle connections.", (*pgxpool.Stat).IdleConns),
+		gauge("total_conns", "Open connections.", (*pgxpool.Stat).TotalConns),
+		gauge("max_conns", "Maximum size of the pool.", (*pgxpool.Stat).MaxConns),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db_pool",
+			Name:      "empty_acquire_total",
+			Help:      "Acquires that waited for a connection.",
+		}, func() float64 {
+			return float64(pool.Stat().EmptyAcquireCount())
+		}),
+	} {
+		err := registry.Register(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunStoredBytes updates the stored bytes every interval until the context is
+// done. Summing up the items is too slow to do on every scrape.
+func RunStoredBytes(ctx context.Context, interval time.Duration, stored func(context.Context) (map[pb.ItemType]int64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sizes, err := stored(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Couldn't measure stored items", "error", err)
+		}
+		for itemType, size := range sizes {
+			storedBytes.WithLabelValues(typeLabel(itemType)).Set(float64(size))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func typeLabel(itemType pb.ItemType) string {
+	return strings.ToLower(strings.TrimPrefix(itemType.String(), "ITEM_TYPE_"))
+}
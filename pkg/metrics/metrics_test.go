@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnaryInterceptor(t *testing.T) {
+	const method = "/gophkeeper.GophKeeper/GetText"
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+
+	_, err := UnaryInterceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+	_, err = UnaryInterceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.NotFound, "Text not found")
+	})
+	require.Error(t, err)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(rpcRequests.WithLabelValues(method, "OK")))
+	require.Equal(t, 1.0, testutil.ToFloat64(rpcRequests.WithLabelValues(method, "NotFound")))
+
+	Login(true)
+	Login(false)
+	Login(false)
+	require.Equal(t, 2.0, testutil.ToFloat64(logins.WithLabelValues("failure")))
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `gophkeeper_rpc_requests_total{code="NotFound",method="/gophkeeper.GophKeeper/GetText"} 1`)
+	require.Contains(t, rec.Body.String(), `gophkeeper_auth_logins_total{result="success"} 1`)
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"praktikum-gophkeeper/pkg/storage"
+	"time"
+)
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	at               time.Time
+	table, operation string
+}
+
+// QueryTracer records the duration of database queries by the table and the
+// operation it finds in their SQL.
+type QueryTracer struct{}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	table, operation := storage.DescribeQuery(data.SQL)
+	return context.WithValue(ctx, queryStartKey{}, queryStart{at: time.Now(), table: table, operation: operation})
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+
+	queryDuration.WithLabelValues(start.table, start.operation).Observe(time.Since(start.at).Seconds())
+}
@@ -0,0 +1,279 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"praktikum-gophkeeper/pkg/cache"
+	"praktikum-gophkeeper/pkg/protofield"
+	pb "praktikum-gophkeeper/proto"
+)
+
+var (
+	ErrUnresolved = errors.New("conflict can't be resolved with this strategy")
+	// ErrConflict means that a change conflicts with the server version of its
+	// item and was stored to be resolved manually.
+	ErrConflict = errors.New("item was changed on the server, the change is kept as a conflict")
+)
+
+// changedOnServer is the reason of a conflict with an item changed on the server.
+const changedOnServer = "item was changed on the server"
+
+// Strategy decides what happens to a queued operation when its item was
+// changed on the server since the operation was made.
+type Strategy int
+
+const (
+	// Manual keeps conflicts until they are resolved with Resolve.
+	Manual Strategy = iota
+	// ServerWins drops the local change.
+	ServerWins
+	// ClientWins overwrites the server version, restoring the item if it was deleted.
+	ClientWins
+	// LastWriterWins keeps the change made last. Deletions on the server carry
+	// no time, so the local change wins over them.
+	LastWriterWins
+	// KeepBoth keeps the server version and adds the local one as a copy.
+	KeepBoth
+	// Merge combines fields changed on either side. It applies to passwords and
+	// payment cards only and fails when both sides changed the same field.
+	Merge
+)
+
+var strategyNames = map[Strategy]string{
+	Manual:         "manual",
+	ServerWins:     "server",
+	ClientWins:     "client",
+	LastWriterWins: "latest",
+	KeepBoth:       "both",
+	Merge:          "merge",
+}
+
+func (s Strategy) String() string {
+	return strategyNames[s]
+}
+
+func ParseStrategy(name string) (Strategy, error) {
+	for strategy, strategyName := range strategyNames {
+		if strategyName == name {
+			return strategy, nil
+		}
+	}
+
+	return Manual, fmt.Errorf("unknown conflict resolution strategy %q", name)
+}
+
+// copySuffix marks the title of an item added by KeepBoth.
+const copySuffix = " (conflicted copy)"
+
+// Resolve settles a conflict stored during replay. The item is compared
+// with its latest server version, which is pulled first.
+func (v *Vault) Resolve(ctx context.Context, seq uint64, strategy Strategy) error {
+	conflict, err := v.cache.Conflict(seq)
+	if err != nil {
+		return err
+	}
+
+	conflict.Current, err = v.serverVersion(ctx, conflict.GetOperation().GetItem())
+	if err != nil {
+		return err
+	}
+
+	resolved, err := v.resolve(ctx, conflict, strategy)
+	if err != nil {
+		return err
+	}
+	if !resolved {
+		return ErrUnresolved
+	}
+
+	err = v.cache.RemoveConflict(seq)
+	if err != nil {
+		return err
+	}
+
+	return v.Pull(ctx)
+}
+
+// serverVersion pulls changes and returns the latest server version of the
+// item, nil when it was deleted.
+func (v *Vault) serverVersion(ctx context.Context, item *pb.Change) (*pb.Change, error) {
+	err := v.Pull(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := v.cache.Item(item.GetType(), item.GetId())
+	if errors.Is(err, cache.ErrNotFound) {
+		return nil, nil
+	}
+
+	return current, err
+}
+
+// resolve applies the strategy to a conflict. It returns false when the
+// conflict has to be resolved manually.
+func (v *Vault) resolve(ctx context.Context, conflict *pb.Conflict, strategy Strategy) (bool, error) {
+	op, current := conflict.GetOperation(), conflict.GetCurrent()
+
+	switch strategy {
+	case ServerWins:
+		return true, nil
+	case ClientWins:
+		return true, v.overwrite(ctx, op, current)
+	case LastWriterWins:
+		if current != nil && UpdatedAt(current).AsTime().After(op.GetCreatedAt().AsTime()) {
+			return true, nil
+		}
+
+		return true, v.overwrite(ctx, op, current)
+	case KeepBoth:
+		return true, v.keepBoth(ctx, op, current)
+	case Merge:
+		if op.GetOperation() != pb.Operation_OPERATION_UPDATE || current == nil || op.GetBase() == nil {
+			return false, nil
+		}
+
+		merged, ok := mergeItems(op.GetBase(), op.GetItem(), current)
+		if !ok {
+			return false, nil
+		}
+
+		return true, push(ctx, v.client, &pb.PendingOperation{
+			Operation: pb.Operation_OPERATION_UPDATE,
+			Item:      merged,
+		})
+	default:
+		return false, nil
+	}
+}
+
+// overwrite applies the operation regardless of the server version.
+// An item deleted on the server is restored first, or created again once purged.
+func (v *Vault) overwrite(ctx context.Context, op *pb.PendingOperation, current *pb.Change) error {
+	op = unconditional(op)
+	if current != nil || op.GetOperation() != pb.Operation_OPERATION_UPDATE {
+		return push(ctx, v.client, op)
+	}
+
+	item := op.GetItem()
+	_, err := v.client.RestoreItem(ctx, &pb.RestoreItemRequest{Type: item.GetType(), Id: item.GetId()})
+	switch status.Code(err) {
+	case codes.OK:
+		return push(ctx, v.client, op)
+	case codes.NotFound:
+		return push(ctx, v.client, &pb.PendingOperation{
+			Operation: pb.Operation_OPERATION_CREATE,
+			Item:      item,
+		})
+	default:
+		return err
+	}
+}
+
+// keepBoth adds the local version of an updated item as a new item.
+// A local delete of an item changed on the server is dropped.
+func (v *Vault) keepBoth(ctx context.Context, op *pb.PendingOperation, current *pb.Change) error {
+	if op.GetOperation() != pb.Operation_OPERATION_UPDATE {
+		return nil
+	}
+
+	item := proto.Clone(op.GetItem()).(*pb.Change)
+	setID(item, uuid.NewString())
+	if current != nil {
+		setTitle(item, Title(item)+copySuffix)
+	}
+
+	return push(ctx, v.client, &pb.PendingOperation{
+		Operation: pb.Operation_OPERATION_CREATE,
+		Item:      item,
+	})
+}
+
+// mergeSkipped holds fields maintained by the server, which are never merged.
+var mergeSkipped = map[protoreflect.Name]bool{
+	"id":           true,
+	"created_at":   true,
+	"updated_at":   true,
+	"last_used_at": true,
+}
+
+// ChangedFields returns the names of the fields whose values differ between
+// two versions of an item, except the ones maintained by the server. There
+// are none when either carries no item, as deletions don't.
+func ChangedFields(older, newer *pb.Change) []string {
+	a, b := message(older), message(newer)
+	if a == nil || b == nil || a.ProtoReflect().Descriptor() != b.ProtoReflect().Descriptor() {
+		return nil
+	}
+
+	var changed []string
+	fields := a.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if mergeSkipped[fd.Name()] {
+			continue
+		}
+		if !proto.Equal(protofield.Only(a.ProtoReflect(), fd), protofield.Only(b.ProtoReflect(), fd)) {
+			changed = append(changed, string(fd.Name()))
+		}
+	}
+
+	return changed
+}
+
+// mergeItems makes a three-way merge of a password or payment card: a field
+// changed on one side only takes that side's value. It fails when a field
+// was changed differently on both sides.
+func mergeItems(base, local, remote *pb.Change) (*pb.Change, bool) {
+	var b, l, r proto.Message
+	switch local.GetItem().(type) {
+	case *pb.Change_Password:
+		b, l, r = base.GetPassword(), local.GetPassword(), remote.GetPassword()
+	case *pb.Change_Payment:
+		b, l, r = base.GetPayment(), local.GetPayment(), remote.GetPayment()
+	default:
+		return nil, false
+	}
+
+	merged := proto.Clone(remote).(*pb.Change)
+	m := proto.Clone(r).ProtoReflect()
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if mergeSkipped[fd.Name()] {
+			continue
+		}
+
+		baseField := protofield.Only(b.ProtoReflect(), fd)
+		localField := protofield.Only(l.ProtoReflect(), fd)
+		remoteField := protofield.Only(r.ProtoReflect(), fd)
+
+		switch {
+		case proto.Equal(localField, baseField), proto.Equal(localField, remoteField):
+			// The remote value is kept.
+		case proto.Equal(remoteField, baseField):
+			if l.ProtoReflect().Has(fd) {
+				m.Set(fd, l.ProtoReflect().Get(fd))
+			} else {
+				m.Clear(fd)
+			}
+		default:
+			return nil, false
+		}
+	}
+
+	switch x := m.Interface().(type) {
+	case *pb.Password:
+		merged.Item = &pb.Change_Password{Password: x}
+	case *pb.Payment:
+		merged.Item = &pb.Change_Payment{Payment: x}
+	}
+
+	return merged, true
+}
@@ -0,0 +1,96 @@
+package offline
+
+import (
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+func password(website, login, secret string) *pb.Change {
+	return &pb.Change{
+		Type: pb.ItemType_ITEM_TYPE_PASSWORD,
+		Id:   "a",
+		Item: &pb.Change_Password{Password: &pb.Password{
+			Id:       "a",
+			Website:  website,
+			Login:    login,
+			Password: secret,
+		}},
+	}
+}
+
+func TestMergeItems(t *testing.T) {
+	base := password("site", "login", "secret")
+
+	tests := []struct {
+		name   string
+		local  *pb.Change
+		remote *pb.Change
+		want   *pb.Change
+	}{
+		{
+			name:   "different fields",
+			local:  password("site", "login", "new secret"),
+			remote: password("site", "new login", "secret"),
+			want:   password("site", "new login", "new secret"),
+		},
+		{
+			name:   "same change",
+			local:  password("new site", "login", "secret"),
+			remote: password("new site", "login", "secret"),
+			want:   password("new site", "login", "secret"),
+		},
+		{
+			name:   "same field",
+			local:  password("site", "login", "local secret"),
+			remote: password("site", "login", "remote secret"),
+		},
+		{
+			name: "text",
+			local: &pb.Change{
+				Type: pb.ItemType_ITEM_TYPE_TEXT,
+				Item: &pb.Change_Text{Text: &pb.Text{Title: "a"}},
+			},
+			remote: &pb.Change{
+				Type: pb.ItemType_ITEM_TYPE_TEXT,
+				Item: &pb.Change_Text{Text: &pb.Text{Title: "b"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, ok := mergeItems(base, tt.local, tt.remote)
+			if tt.want == nil {
+				require.False(t, ok)
+				return
+			}
+
+			require.True(t, ok)
+			require.True(t, proto.Equal(tt.want, merged), merged.String())
+		})
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for strategy, name := range strategyNames {
+		parsed, err := ParseStrategy(name)
+		require.NoError(t, err)
+		require.Equal(t, strategy, parsed)
+	}
+
+	_, err := ParseStrategy("unknown")
+	require.Error(t, err)
+}
+
+func TestChangedFields(t *testing.T) {
+	older := password("site", "login", "secret")
+	newer := password("site", "new login", "new secret")
+	newer.GetPassword().UpdatedAt = timestamppb.Now()
+
+	require.Equal(t, []string{"login", "password"}, ChangedFields(older, newer))
+	require.Empty(t, ChangedFields(older, older))
+	require.Empty(t, ChangedFields(older, &pb.Change{Type: pb.ItemType_ITEM_TYPE_PASSWORD, Id: "a"}))
+}
@@ -0,0 +1,284 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"praktikum-gophkeeper/pkg/cache"
+	pb "praktikum-gophkeeper/proto"
+)
+
+// Store keeps the items pulled from the server and the operations queued for
+// it. It is either a cache.Cache or the cache a client agent has open.
+type Store interface {
+	Seq() (int64, error)
+	Apply(changes []*pb.Change, seq int64) error
+	// Item returns cache.ErrNotFound when the item isn't stored.
+	Item(itemType pb.ItemType, id string) (*pb.Change, error)
+	Items(itemType pb.ItemType) ([]*pb.Change, error)
+	Enqueue(op *pb.PendingOperation) error
+	Pending() ([]*pb.PendingOperation, error)
+	Dequeue(seq uint64) error
+	AddConflict(conflict *pb.Conflict) error
+	Conflicts() ([]*pb.Conflict, error)
+	// Conflict returns cache.ErrNoConflict when the conflict isn't stored.
+	Conflict(seq uint64) (*pb.Conflict, error)
+	RemoveConflict(seq uint64) error
+}
+
+// Vault serves items from the local cache and keeps it in sync with the server.
+// Changes made while the server is unreachable are queued and replayed later.
+type Vault struct {
+	client   pb.GophKeeperClient
+	cache    Store
+	strategy Strategy
+}
+
+func New(client pb.GophKeeperClient, cache Store, strategy Strategy) *Vault {
+	return &Vault{
+		client:   client,
+		cache:    cache,
+		strategy: strategy,
+	}
+}
+
+// IsOffline reports whether err means that the server couldn't be reached.
+func IsOffline(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pull loads changes made since the last pull into the cache.
+func (v *Vault) Pull(ctx context.Context) error {
+	seq, err := v.cache.Seq()
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := v.client.Sync(ctx, &pb.SyncRequest{Since: seq})
+		if err != nil {
+			return err
+		}
+
+		err = v.cache.Apply(resp.GetChanges(), resp.GetSeq())
+		if err != nil {
+			return err
+		}
+
+		seq = resp.GetSeq()
+		if !resp.GetHasMore() {
+			return nil
+		}
+	}
+}
+
+// List returns items of the type with queued changes applied. Items come
+// from the cache, which is refreshed first unless the server is unreachable.
+func (v *Vault) List(ctx context.Context, itemType pb.ItemType) ([]*pb.Change, error) {
+	err := v.Pull(ctx)
+	if err != nil && !IsOffline(err) {
+		return nil, err
+	}
+
+	items, err := v.cache.Items(itemType)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := v.cache.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	return applyPending(items, pending, itemType), nil
+}
+
+// Get returns a single item from List.
+func (v *Vault) Get(ctx context.Context, itemType pb.ItemType, id string) (*pb.Change, error) {
+	items, err := v.List(ctx, itemType)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item.GetId() == id {
+			return item, nil
+		}
+	}
+
+	return nil, cache.ErrNotFound
+}
+
+// applyPending overlays queued operations on cached items.
+func applyPending(items []*pb.Change, pending []*pb.PendingOperation, itemType pb.ItemType) []*pb.Change {
+	index := map[string]int{}
+	for i, item := range items {
+		index[item.GetId()] = i
+	}
+
+	for _, op := range pending {
+		item := op.GetItem()
+		if item.GetType() != itemType {
+			continue
+		}
+
+		i, ok := index[item.GetId()]
+		switch {
+		case op.GetOperation() == pb.Operation_OPERATION_DELETE:
+			if ok {
+				items[i] = nil
+				delete(index, item.GetId())
+			}
+		case ok:
+			items[i] = item
+		default:
+			index[item.GetId()] = len(items)
+			items = append(items, item)
+		}
+	}
+
+	result := make([]*pb.Change, 0, len(index))
+	for _, item := range items {
+		if item != nil {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// Add creates an item. The id is generated on the client when it isn't set,
+// so that a queued item keeps its id once it reaches the server.
+// The returned flag reports whether the operation was queued.
+func (v *Vault) Add(ctx context.Context, item *pb.Change) (bool, error) {
+	if item.GetId() == "" {
+		setID(item, uuid.NewString())
+	}
+
+	return v.write(ctx, &pb.PendingOperation{
+		Operation: pb.Operation_OPERATION_CREATE,
+		Item:      item,
+	})
+}
+
+// Update replaces an item. The returned flag reports whether the operation was queued.
+func (v *Vault) Update(ctx context.Context, item *pb.Change) (bool, error) {
+	return v.write(ctx, &pb.PendingOperation{
+		Operation: pb.Operation_OPERATION_UPDATE,
+		Item:      item,
+	})
+}
+
+// Delete moves an item to trash. The returned flag reports whether the operation was queued.
+func (v *Vault) Delete(ctx context.Context, itemType pb.ItemType, id string) (bool, error) {
+	return v.write(ctx, &pb.PendingOperation{
+		Operation: pb.Operation_OPERATION_DELETE,
+		Item: &pb.Change{
+			Type: itemType,
+			Id:   id,
+		},
+	})
+}
+
+// write sends an operation to the server or queues it when the server is unreachable.
+// Operations are also queued while older ones wait, so that they are replayed in order.
+// An update of an item changed on the server since it was read is settled with
+// the vault's strategy; ErrConflict is returned when it has to be resolved manually.
+func (v *Vault) write(ctx context.Context, op *pb.PendingOperation) (bool, error) {
+	item := op.GetItem()
+	item.Operation = op.GetOperation()
+	op.CreatedAt = timestamppb.Now()
+
+	if op.GetOperation() != pb.Operation_OPERATION_CREATE {
+		base, err := v.cache.Item(item.GetType(), item.GetId())
+		switch {
+		case err == nil:
+			op.Base = base
+		case !errors.Is(err, cache.ErrNotFound):
+			return false, err
+		}
+	}
+
+	pending, err := v.cache.Pending()
+	if err != nil {
+		return false, err
+	}
+
+	if len(pending) == 0 {
+		err = v.send(ctx, op)
+		if !IsOffline(err) {
+			return false, err
+		}
+	}
+
+	return true, v.cache.Enqueue(op)
+}
+
+// send applies an operation on the server and pulls its result.
+func (v *Vault) send(ctx context.Context, op *pb.PendingOperation) error {
+	// The cache may have pulled a newer version than the one edited.
+	edited := UpdatedAt(op.GetItem())
+	if op.GetBase() != nil && edited != nil && !proto.Equal(edited, UpdatedAt(op.GetBase())) {
+		return v.settle(ctx, unconditional(op))
+	}
+
+	err := push(ctx, v.client, op)
+	if status.Code(err) == codes.FailedPrecondition {
+		return v.settle(ctx, op)
+	}
+	if err != nil {
+		return err
+	}
+
+	return v.pullAfterWrite(ctx)
+}
+
+// pullAfterWrite pulls the result of a change. The change is made already,
+// so the server becoming unreachable isn't an error.
+func (v *Vault) pullAfterWrite(ctx context.Context) error {
+	err := v.Pull(ctx)
+	if IsOffline(err) {
+		return nil
+	}
+
+	return err
+}
+
+// settle resolves an operation refused because its item was changed on the
+// server with the vault's strategy, or stores it as a conflict.
+func (v *Vault) settle(ctx context.Context, op *pb.PendingOperation) error {
+	current, err := v.serverVersion(ctx, op.GetItem())
+	if err != nil {
+		return err
+	}
+
+	conflict := &pb.Conflict{
+		Operation: op,
+		Current:   current,
+		Reason:    changedOnServer,
+	}
+
+	resolved, err := v.resolve(ctx, conflict, v.strategy)
+	if err != nil {
+		return err
+	}
+	if !resolved {
+		err = v.cache.AddConflict(conflict)
+		if err != nil {
+			return err
+		}
+
+		return ErrConflict
+	}
+
+	return v.pullAfterWrite(ctx)
+}
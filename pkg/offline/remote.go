@@ -0,0 +1,150 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	pb "praktikum-gophkeeper/proto"
+)
+
+// push sends a queued operation to the server. An update with a base fails
+// with FailedPrecondition when the item was changed on the server since then.
+func push(ctx context.Context, client pb.GophKeeperClient, op *pb.PendingOperation) error {
+	item := op.GetItem()
+	id := item.GetId()
+	base := UpdatedAt(op.GetBase())
+
+	var err error
+	switch op.GetOperation() {
+	case pb.Operation_OPERATION_CREATE:
+		switch x := item.GetItem().(type) {
+		case *pb.Change_Password:
+			_, err = client.AddPassword(ctx, &pb.AddPasswordRequest{Password: x.Password})
+		case *pb.Change_Text:
+			_, err = client.AddText(ctx, &pb.AddTextRequest{Text: x.Text})
+		case *pb.Change_Binary:
+			_, err = client.AddBinary(ctx, &pb.AddBinaryRequest{Binary: x.Binary})
+		case *pb.Change_Payment:
+			_, err = client.AddPayment(ctx, &pb.AddPaymentRequest{Payment: x.Payment})
+		default:
+			err = errors.New("operation has no item")
+		}
+	case pb.Operation_OPERATION_UPDATE:
+		switch x := item.GetItem().(type) {
+		case *pb.Change_Password:
+			_, err = client.UpdatePassword(ctx, &pb.UpdatePasswordRequest{Password: x.Password, Id: id, BaseUpdatedAt: base})
+		case *pb.Change_Text:
+			_, err = client.UpdateText(ctx, &pb.UpdateTextRequest{Text: x.Text, Id: id, BaseUpdatedAt: base})
+		case *pb.Change_Binary:
+			_, err = client.UpdateBinary(ctx, &pb.UpdateBinaryRequest{Binary: x.Binary, Id: id, BaseUpdatedAt: base})
+		case *pb.Change_Payment:
+			_, err = client.UpdatePayment(ctx, &pb.UpdatePaymentRequest{Payment: x.Payment, Id: id, BaseUpdatedAt: base})
+		default:
+			err = errors.New("operation has no item")
+		}
+	case pb.Operation_OPERATION_DELETE:
+		switch item.GetType() {
+		case pb.ItemType_ITEM_TYPE_PASSWORD:
+			_, err = client.DeletePassword(ctx, &pb.DeletePasswordRequest{Id: id})
+		case pb.ItemType_ITEM_TYPE_TEXT:
+			_, err = client.DeleteText(ctx, &pb.DeleteTextRequest{Id: id})
+		case pb.ItemType_ITEM_TYPE_BINARY:
+			_, err = client.DeleteBinary(ctx, &pb.DeleteBinaryRequest{Id: id})
+		case pb.ItemType_ITEM_TYPE_PAYMENT:
+			_, err = client.DeletePayment(ctx, &pb.DeletePaymentRequest{Id: id})
+		default:
+			err = fmt.Errorf("unknown item type %v", item.GetType())
+		}
+	default:
+		err = fmt.Errorf("unsupported operation %v", op.GetOperation())
+	}
+
+	return err
+}
+
+// unconditional returns a copy of the operation without its base, which
+// applies it whatever the server version is.
+func unconditional(op *pb.PendingOperation) *pb.PendingOperation {
+	op = proto.Clone(op).(*pb.PendingOperation)
+	op.Base = nil
+	return op
+}
+
+// setID sets the id of the item carried by change as well as of change itself.
+func setID(change *pb.Change, id string) {
+	change.Id = id
+
+	switch x := change.GetItem().(type) {
+	case *pb.Change_Password:
+		x.Password.Id = id
+	case *pb.Change_Text:
+		x.Text.Id = id
+	case *pb.Change_Binary:
+		x.Binary.Id = id
+	case *pb.Change_Payment:
+		x.Payment.Id = id
+	}
+}
+
+// UpdatedAt returns the modification time of the item carried by change.
+func UpdatedAt(change *pb.Change) *timestamppb.Timestamp {
+	switch x := change.GetItem().(type) {
+	case *pb.Change_Password:
+		return x.Password.GetUpdatedAt()
+	case *pb.Change_Text:
+		return x.Text.GetUpdatedAt()
+	case *pb.Change_Binary:
+		return x.Binary.GetUpdatedAt()
+	case *pb.Change_Payment:
+		return x.Payment.GetUpdatedAt()
+	default:
+		return nil
+	}
+}
+
+// Title returns the title, website or card name of the item carried by change.
+func Title(change *pb.Change) string {
+	switch x := change.GetItem().(type) {
+	case *pb.Change_Password:
+		return x.Password.GetWebsite()
+	case *pb.Change_Text:
+		return x.Text.GetTitle()
+	case *pb.Change_Binary:
+		return x.Binary.GetTitle()
+	case *pb.Change_Payment:
+		return x.Payment.GetName()
+	default:
+		return ""
+	}
+}
+
+// message returns the item carried by change, nil when it carries none.
+func message(change *pb.Change) proto.Message {
+	switch x := change.GetItem().(type) {
+	case *pb.Change_Password:
+		return x.Password
+	case *pb.Change_Text:
+		return x.Text
+	case *pb.Change_Binary:
+		return x.Binary
+	case *pb.Change_Payment:
+		return x.Payment
+	default:
+		return nil
+	}
+}
+
+func setTitle(change *pb.Change, title string) {
+	switch x := change.GetItem().(type) {
+	case *pb.Change_Password:
+		x.Password.Website = title
+	case *pb.Change_Text:
+		x.Text.Title = title
+	case *pb.Change_Binary:
+		x.Binary.Title = title
+	case *pb.Change_Payment:
+		x.Payment.Name = title
+	}
+}
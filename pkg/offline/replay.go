@@ -0,0 +1,167 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"praktikum-gophkeeper/pkg/cache"
+	pb "praktikum-gophkeeper/proto"
+)
+
+// Rejection is a queued operation the server refused.
+type Rejection struct {
+	Operation *pb.PendingOperation
+	Reason    string
+}
+
+// Report describes the outcome of replaying queued operations.
+type Report struct {
+	Applied int
+	// Resolved is the number of conflicts settled by the vault's strategy.
+	Resolved int
+	// Conflicts are stored until they are resolved manually.
+	Conflicts []*pb.Conflict
+	Rejected  []Rejection
+	// Pending is the number of operations left in the queue because the server became unreachable.
+	Pending int
+}
+
+// Sync pulls changes from the server, replays queued operations and pulls their results.
+func (v *Vault) Sync(ctx context.Context) (*Report, error) {
+	err := v.Pull(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := v.replay(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	if report.Applied > 0 || report.Resolved > 0 {
+		err = v.Pull(ctx)
+	}
+
+	return report, err
+}
+
+// replay sends queued operations to the server in order. An update or delete
+// conflicts when the server version differs from the one it was made against,
+// whether the cache shows it or the server refuses the update; such conflicts
+// are settled with the vault's strategy or stored.
+func (v *Vault) replay(ctx context.Context) (*Report, error) {
+	pending, err := v.cache.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	// touched holds items changed by this replay; the cache doesn't know about those changes yet.
+	touched := map[string]bool{}
+	for i, op := range pending {
+		item := op.GetItem()
+		key := item.GetType().String() + "/" + item.GetId()
+
+		current, err := v.cache.Item(item.GetType(), item.GetId())
+		if errors.Is(err, cache.ErrNotFound) {
+			current = nil
+		} else if err != nil {
+			return report, err
+		}
+
+		reason, apply := "", true
+		if !touched[key] {
+			reason, apply = check(op, current)
+		}
+
+		if reason == "" && apply {
+			pushed := op
+			if touched[key] {
+				// The base predates the change replayed before.
+				pushed = unconditional(op)
+			}
+
+			err = push(ctx, v.client, pushed)
+			if status.Code(err) == codes.FailedPrecondition {
+				reason = changedOnServer
+				current, err = v.serverVersion(ctx, item)
+				if err != nil && !IsOffline(err) {
+					return report, err
+				}
+			}
+		}
+
+		resolved := true
+		if reason != "" && err == nil {
+			conflict := &pb.Conflict{
+				Operation: op,
+				Current:   current,
+				Reason:    reason,
+			}
+
+			resolved, err = v.resolve(ctx, conflict, v.strategy)
+			if err == nil && !resolved {
+				err = v.cache.AddConflict(conflict)
+				if err != nil {
+					return report, err
+				}
+
+				report.Conflicts = append(report.Conflicts, conflict)
+			}
+		}
+
+		if IsOffline(err) {
+			report.Pending = len(pending) - i
+			return report, err
+		}
+
+		switch {
+		case err != nil:
+			report.Rejected = append(report.Rejected, Rejection{
+				Operation: op,
+				Reason:    status.Convert(err).Message(),
+			})
+		case reason == "":
+			report.Applied++
+			touched[key] = true
+		case resolved:
+			report.Resolved++
+			touched[key] = true
+		}
+
+		err = v.cache.Dequeue(op.GetSeq())
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// check compares a queued operation with the current server version of its item.
+// It returns why the operation conflicts, or whether it still has to be sent
+// when it doesn't.
+func check(op *pb.PendingOperation, current *pb.Change) (string, bool) {
+	switch op.GetOperation() {
+	case pb.Operation_OPERATION_CREATE:
+		// The item is already on the server when an earlier replay was interrupted.
+		return "", current == nil
+	case pb.Operation_OPERATION_DELETE:
+		if current == nil {
+			return "", false
+		}
+	default:
+		if current == nil {
+			return "item was deleted on the server", false
+		}
+	}
+
+	// Items created offline have no base; the server version comes from the replayed create.
+	if op.GetBase() != nil && !proto.Equal(UpdatedAt(current), UpdatedAt(op.GetBase())) {
+		return changedOnServer, false
+	}
+
+	return "", true
+}
@@ -0,0 +1,265 @@
+package offline
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"path/filepath"
+	"praktikum-gophkeeper/pkg/cache"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+	"time"
+)
+
+type fakeClient struct {
+	pb.GophKeeperClient
+
+	offline bool
+	changes []*pb.Change
+	// late is a change made on the server right after the next sync.
+	late  *pb.Change
+	calls []string
+}
+
+func (c *fakeClient) Sync(_ context.Context, in *pb.SyncRequest, _ ...grpc.CallOption) (*pb.SyncResponse, error) {
+	if c.offline {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+
+	resp := &pb.SyncResponse{Seq: in.GetSince()}
+	for _, change := range c.changes {
+		if change.GetSeq() > in.GetSince() {
+			resp.Changes = append(resp.Changes, change)
+			resp.Seq = change.GetSeq()
+		}
+	}
+
+	if c.late != nil {
+		c.changes = append(c.changes, c.late)
+		c.late = nil
+	}
+
+	return resp, nil
+}
+
+// updatedAt returns the modification time of the latest server version of an item.
+func (c *fakeClient) updatedAt(id string) *timestamppb.Timestamp {
+	var updatedAt *timestamppb.Timestamp
+	for _, change := range c.changes {
+		if change.GetId() == id {
+			updatedAt = UpdatedAt(change)
+		}
+	}
+
+	return updatedAt
+}
+
+func (c *fakeClient) AddText(_ context.Context, in *pb.AddTextRequest, _ ...grpc.CallOption) (*pb.AddTextResponse, error) {
+	if c.offline {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+
+	c.calls = append(c.calls, "add "+in.GetText().GetId())
+	return &pb.AddTextResponse{Text: in.GetText()}, nil
+}
+
+func (c *fakeClient) UpdateText(_ context.Context, in *pb.UpdateTextRequest, _ ...grpc.CallOption) (*pb.UpdateTextResponse, error) {
+	if c.offline {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+
+	if in.GetBaseUpdatedAt() != nil && !proto.Equal(in.GetBaseUpdatedAt(), c.updatedAt(in.GetId())) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Text %s was changed", in.GetId())
+	}
+
+	c.calls = append(c.calls, "update "+in.GetId())
+	return &pb.UpdateTextResponse{}, nil
+}
+
+func text(seq int64, id, title string, updatedAt time.Time) *pb.Change {
+	return &pb.Change{
+		Seq:       seq,
+		Type:      pb.ItemType_ITEM_TYPE_TEXT,
+		Id:        id,
+		Operation: pb.Operation_OPERATION_UPDATE,
+		Item: &pb.Change_Text{Text: &pb.Text{
+			Id:        id,
+			Title:     title,
+			UpdatedAt: timestamppb.New(updatedAt),
+		}},
+	}
+}
+
+func TestReplay(t *testing.T) {
+	c, err := cache.Open(filepath.Join(t.TempDir(), "vault.db"), []byte("master"))
+	require.NoError(t, err)
+	defer c.Close()
+
+	created := time.Now().Add(-time.Hour)
+	client := &fakeClient{
+		changes: []*pb.Change{
+			text(1, "a", "a", created),
+			text(2, "b", "b", created),
+		},
+	}
+	v := New(client, c, Manual)
+	ctx := context.Background()
+
+	_, err = v.Sync(ctx)
+	require.NoError(t, err)
+
+	client.offline = true
+
+	queued, err := v.Update(ctx, text(0, "a", "a local", time.Time{}))
+	require.NoError(t, err)
+	require.True(t, queued)
+
+	_, err = v.Update(ctx, text(0, "b", "b local", time.Time{}))
+	require.NoError(t, err)
+
+	_, err = v.Add(ctx, text(0, "c", "c", time.Time{}))
+	require.NoError(t, err)
+
+	_, err = v.Update(ctx, text(0, "c", "c local", time.Time{}))
+	require.NoError(t, err)
+
+	items, err := v.List(ctx, pb.ItemType_ITEM_TYPE_TEXT)
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	require.Equal(t, "a local", items[0].GetText().GetTitle())
+	require.Equal(t, "c local", items[2].GetText().GetTitle())
+
+	_, err = v.Sync(ctx)
+	require.True(t, IsOffline(err))
+
+	client.offline = false
+	client.changes = append(client.changes, text(3, "b", "b remote", time.Now()))
+
+	report, err := v.Sync(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Applied)
+	require.Empty(t, report.Rejected)
+	require.Len(t, report.Conflicts, 1)
+	require.Equal(t, "b", report.Conflicts[0].GetOperation().GetItem().GetId())
+	require.Equal(t, "b remote", report.Conflicts[0].GetCurrent().GetText().GetTitle())
+	require.Equal(t, []string{"update a", "add c", "update c"}, client.calls)
+
+	pending, err := c.Pending()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	seq := report.Conflicts[0].GetSeq()
+	require.ErrorIs(t, v.Resolve(ctx, seq, Merge), ErrUnresolved)
+	require.NoError(t, v.Resolve(ctx, seq, ClientWins))
+	require.Equal(t, "update b", client.calls[len(client.calls)-1])
+
+	conflicts, err := c.Conflicts()
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+}
+
+func TestUpdateChangedOnServer(t *testing.T) {
+	ctx := context.Background()
+	created := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		strategy Strategy
+		// synced means that the vault pulled the remote change before the update was made.
+		synced    bool
+		wantErr   error
+		wantCalls []string
+	}{
+		{
+			name:     "manual",
+			strategy: Manual,
+			wantErr:  ErrConflict,
+		},
+		{
+			name:     "server wins",
+			strategy: ServerWins,
+		},
+		{
+			name:      "client wins",
+			strategy:  ClientWins,
+			wantCalls: []string{"update a"},
+		},
+		{
+			name:     "edited before pull",
+			strategy: Manual,
+			synced:   true,
+			wantErr:  ErrConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := cache.Open(filepath.Join(t.TempDir(), "vault.db"), []byte("master"))
+			require.NoError(t, err)
+			defer c.Close()
+
+			client := &fakeClient{changes: []*pb.Change{text(1, "a", "a", created)}}
+			v := New(client, c, tt.strategy)
+
+			item, err := v.Get(ctx, pb.ItemType_ITEM_TYPE_TEXT, "a")
+			require.NoError(t, err)
+
+			client.changes = append(client.changes, text(2, "a", "a remote", time.Now()))
+			if tt.synced {
+				require.NoError(t, v.Pull(ctx))
+			}
+
+			item = proto.Clone(item).(*pb.Change)
+			item.GetText().Title = "a local"
+			queued, err := v.Update(ctx, item)
+			require.ErrorIs(t, err, tt.wantErr)
+			require.False(t, queued)
+			require.Equal(t, tt.wantCalls, client.calls)
+
+			conflicts, err := c.Conflicts()
+			require.NoError(t, err)
+			if tt.wantErr == nil {
+				require.Empty(t, conflicts)
+				return
+			}
+
+			require.Len(t, conflicts, 1)
+			require.Equal(t, "a remote", conflicts[0].GetCurrent().GetText().GetTitle())
+		})
+	}
+}
+
+func TestReplayChangedOnServer(t *testing.T) {
+	c, err := cache.Open(filepath.Join(t.TempDir(), "vault.db"), []byte("master"))
+	require.NoError(t, err)
+	defer c.Close()
+
+	created := time.Now().Add(-time.Hour)
+	client := &fakeClient{changes: []*pb.Change{text(1, "a", "a", created)}}
+	v := New(client, c, Manual)
+	ctx := context.Background()
+
+	item, err := v.Get(ctx, pb.ItemType_ITEM_TYPE_TEXT, "a")
+	require.NoError(t, err)
+
+	client.offline = true
+	item = proto.Clone(item).(*pb.Change)
+	item.GetText().Title = "a local"
+	queued, err := v.Update(ctx, item)
+	require.NoError(t, err)
+	require.True(t, queued)
+
+	client.offline = false
+	client.late = text(2, "a", "a remote", time.Now())
+
+	report, err := v.Sync(ctx)
+	require.NoError(t, err)
+	require.Zero(t, report.Applied)
+	require.Empty(t, report.Rejected)
+	require.Len(t, report.Conflicts, 1)
+	require.Equal(t, "a remote", report.Conflicts[0].GetCurrent().GetText().GetTitle())
+	require.Empty(t, client.calls)
+}
@@ -0,0 +1,18 @@
+// Package protofield compares messages field by field.
+package protofield
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Only returns a message of the type of m with only the field fd of m set,
+// which proto.Equal compares as the value of the field.
+func Only(m protoreflect.Message, fd protoreflect.FieldDescriptor) proto.Message {
+	field := m.New()
+	if m.Has(fd) {
+		field.Set(fd, m.Get(fd))
+	}
+
+	return field.Interface()
+}
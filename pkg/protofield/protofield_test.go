@@ -0,0 +1,55 @@
+package protofield
+
+import (
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+func TestOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  proto.Message
+		field string
+		equal bool
+	}{
+		{
+			name:  "same value",
+			a:     &pb.Password{Website: "example.com", Password: "old"},
+			b:     &pb.Password{Website: "example.com", Password: "new"},
+			field: "website",
+			equal: true,
+		},
+		{
+			name:  "different value",
+			a:     &pb.Password{Website: "example.com", Password: "old"},
+			b:     &pb.Password{Website: "example.com", Password: "new"},
+			field: "password",
+			equal: false,
+		},
+		{
+			name:  "unset on one side",
+			a:     &pb.Binary{File: []byte{1}},
+			b:     &pb.Binary{},
+			field: "file",
+			equal: false,
+		},
+		{
+			name:  "unset on both sides",
+			a:     &pb.Text{Title: "a"},
+			b:     &pb.Text{Title: "b"},
+			field: "text",
+			equal: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := tt.a.ProtoReflect(), tt.b.ProtoReflect()
+			fd := a.Descriptor().Fields().ByName(protoreflect.Name(tt.field))
+			require.NotNil(t, fd)
+			require.Equal(t, tt.equal, proto.Equal(Only(a, fd), Only(b, fd)))
+		})
+	}
+}
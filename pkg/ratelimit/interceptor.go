@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"math"
+	"net"
+	pb "praktikum-gophkeeper/proto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryAfterTrailer tells in whole seconds when a limited call may be retried.
+const RetryAfterTrailer = "retry-after"
+
+var (
+	authPrefix   = "/" + pb.Authorization_ServiceDesc.ServiceName + "/"
+	keeperPrefix = "/" + pb.GophKeeper_ServiceDesc.ServiceName + "/"
+
+	uploads = map[string]bool{
+		pb.GophKeeper_AddBinary_FullMethodName:    true,
+		pb.GophKeeper_UpdateBinary_FullMethodName: true,
+	}
+	// writePrefixes start the names of the methods which change the vault,
+	// the rest of them read it.
+	writePrefixes = []string{"Add", "Update", "Delete", "Restore", "Purge", "Revert", "Set", "Create", "Rename", "Move"}
+)
+
+// classify returns the class of the method, none for methods which aren't
+// limited, such as health checks.
+func classify(method string) (Class, bool) {
+	switch {
+	case strings.HasPrefix(method, authPrefix):
+		return Auth, true
+	case !strings.HasPrefix(method, keeperPrefix):
+		return "", false
+	case uploads[method]:
+		return Uploads, true
+	}
+
+	name := strings.TrimPrefix(method, keeperPrefix)
+	for _, prefix := range writePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return Writes, true
+		}
+	}
+
+	return Reads, true
+}
+
+// key returns the login the call was authenticated with, which
+// service.AuthUnaryInterceptor puts into the context, or the address of the
+// caller for authorization calls.
+func key(ctx context.Context, class Class) string {
+	if class != Auth {
+		login, _ := ctx.Value("login").(string)
+		return login
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// limit returns the error of a call over its limit and the trailer that
+// goes with it, nil when the call is allowed.
+func (l *Limiter) limit(ctx context.Context, method string) (metadata.MD, error) {
+	class, ok := classify(method)
+	if !ok {
+		return nil, nil
+	}
+
+	allowed, wait := l.Allow(class, key(ctx, class))
+	if allowed {
+		return nil, nil
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	trailer := metadata.Pairs(RetryAfterTrailer, strconv.Itoa(seconds))
+
+	return trailer, status.Errorf(codes.ResourceExhausted, "Too many %s, retry in %s", class, time.Duration(seconds)*time.Second)
+}
+
+// UnaryInterceptor rejects calls over the limit of their class. It must run
+// after service.AuthUnaryInterceptor.
+func (l *Limiter) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if trailer, err := l.limit(ctx, info.FullMethod); err != nil {
+		grpc.SetTrailer(ctx, trailer)
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// StreamInterceptor is UnaryInterceptor for streaming calls, which take a
+// token when they start.
+func (l *Limiter) StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if trailer, err := l.limit(ss.Context(), info.FullMethod); err != nil {
+		ss.SetTrailer(trailer)
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+// ShedUnaryInterceptor rejects calls while too many are in flight, before
+// they take any work. Clients retry Unavailable calls with a backoff.
+// Streams aren't counted, as they stay open while idle.
+func (l *Limiter) ShedUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if _, ok := classify(info.FullMethod); !ok {
+		return handler(ctx, req)
+	}
+	if !l.Acquire() {
+		return nil, status.Error(codes.Unavailable, "Server is overloaded")
+	}
+	defer l.Release()
+
+	return handler(ctx, req)
+}
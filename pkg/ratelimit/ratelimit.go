@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Class groups methods which share a limit.
+type Class string
+
+const (
+	Reads   Class = "reads"
+	Writes  Class = "writes"
+	Uploads Class = "uploads"
+	// Auth calls are limited by address, as their callers aren't
+	// authenticated yet.
+	Auth Class = "auth"
+)
+
+// Rate lets Burst calls through at once and PerSecond calls a second after
+// that. A zero PerSecond doesn't limit calls.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// sweepInterval is how often idle buckets are dropped.
+const sweepInterval = time.Minute
+
+type bucketKey struct {
+	class Class
+	key   string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket for every class and key, and counts the calls
+// in flight. Its limits can change while it's used.
+type Limiter struct {
+	mu      sync.Mutex
+	rates   map[Class]Rate
+	buckets map[bucketKey]*bucket
+	swept   time.Time
+	now     func() time.Time
+
+	inFlight    atomic.Int64
+	maxInFlight atomic.Int64
+}
+
+// New returns a limiter of the classes in rates that sheds calls beyond
+// maxConcurrent in flight, zero for no limit.
+func New(rates map[Class]Rate, maxConcurrent int) *Limiter {
+	l := &Limiter{
+		buckets: map[bucketKey]*bucket{},
+		now:     time.Now,
+	}
+	l.Set(rates, maxConcurrent)
+	l.swept = l.now()
+
+	return l
+}
+
+// Set changes the limits. Buckets keep their tokens up to the new bursts.
+func (l *Limiter) Set(rates map[Class]Rate, maxConcurrent int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rates = rates
+	l.maxInFlight.Store(int64(maxConcurrent))
+}
+
+// Allow takes a token from the bucket of the key in the class. When there is
+// none it tells how long until there is one.
+func (l *Limiter) Allow(class Class, key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate := l.rates[class]
+	if rate.PerSecond <= 0 {
+		return true, 0
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	k := bucketKey{class, key}
+	b := l.buckets[k]
+	if b == nil {
+		b = &bucket{tokens: float64(rate.Burst), last: now}
+		l.buckets[k] = b
+	}
+	b.refill(rate, now)
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate.PerSecond * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+func (b *bucket) refill(rate Rate, now time.Time) {
+	b.tokens = math.Min(float64(rate.Burst), b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond)
+	b.last = now
+}
+
+// sweep drops full buckets, which are the same as new ones, so that keys
+// which stopped calling don't take memory.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+
+	for k, b := range l.buckets {
+		rate := l.rates[k.class]
+		b.refill(rate, now)
+		if rate.PerSecond <= 0 || b.tokens >= float64(rate.Burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Acquire counts a call in flight unless there are too many already. Every
+// acquired call has to be released.
+func (l *Limiter) Acquire() bool {
+	n := l.inFlight.Add(1)
+	if max := l.maxInFlight.Load(); max > 0 && n > max {
+		l.inFlight.Add(-1)
+		return false
+	}
+
+	return true
+}
+
+func (l *Limiter) Release() {
+	l.inFlight.Add(-1)
+}
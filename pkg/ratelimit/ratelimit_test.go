@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newLimiter(rates map[Class]Rate, maxConcurrent int) (*Limiter, *clock) {
+	c := &clock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(rates, maxConcurrent)
+	l.now = c.Now
+	l.swept = c.now
+
+	return l, c
+}
+
+func TestAllow(t *testing.T) {
+	l, c := newLimiter(map[Class]Rate{Reads: {PerSecond: 2, Burst: 3}}, 0)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow(Reads, "user")
+		require.True(t, ok, "call %d of the burst", i)
+	}
+	ok, wait := l.Allow(Reads, "user")
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	// Other keys and classes have buckets of their own.
+	ok, _ = l.Allow(Reads, "other")
+	require.True(t, ok)
+	ok, _ = l.Allow(Writes, "user")
+	require.True(t, ok, "a class without a rate isn't limited")
+
+	c.now = c.now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow(Reads, "user")
+	require.True(t, ok)
+	ok, _ = l.Allow(Reads, "user")
+	require.False(t, ok)
+
+	// Idle buckets are full again, and dropped.
+	c.now = c.now.Add(sweepInterval)
+	ok, _ = l.Allow(Reads, "other")
+	require.True(t, ok)
+	require.Len(t, l.buckets, 1)
+
+	l.Set(map[Class]Rate{}, 0)
+	for i := 0; i < 10; i++ {
+		ok, _ = l.Allow(Reads, "user")
+		require.True(t, ok)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		method string
+		want   Class
+		ok     bool
+	}{
+		{pb.Authorization_LoginUser_FullMethodName, Auth, true},
+		{pb.GophKeeper_GetBinary_FullMethodName, Reads, true},
+		{pb.GophKeeper_Sync_FullMethodName, Reads, true},
+		{pb.GophKeeper_ListTrash_FullMethodName, Reads, true},
+		{pb.GophKeeper_AddPassword_FullMethodName, Writes, true},
+		{pb.GophKeeper_DeleteFolder_FullMethodName, Writes, true},
+		{pb.GophKeeper_SetHistoryDepth_FullMethodName, Writes, true},
+		{pb.GophKeeper_AddBinary_FullMethodName, Uploads, true},
+		{pb.GophKeeper_UpdateBinary_FullMethodName, Uploads, true},
+		{"/grpc.health.v1.Health/Check", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			class, ok := classify(tt.method)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.want, class)
+		})
+	}
+}
+
+type transportStream struct {
+	trailer metadata.MD
+}
+
+func (s *transportStream) Method() string                  { return "" }
+func (s *transportStream) SetHeader(md metadata.MD) error  { return nil }
+func (s *transportStream) SendHeader(md metadata.MD) error { return nil }
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	l, _ := newLimiter(map[Class]Rate{
+		Uploads: {PerSecond: 0.1, Burst: 1},
+		Auth:    {PerSecond: 1, Burst: 1},
+	}, 0)
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	call := func(ctx context.Context, method string) (*transportStream, error) {
+		stream := &transportStream{}
+		ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+		_, err := l.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return stream, err
+	}
+
+	user := context.WithValue(context.Background(), "login", "user")
+	_, err := call(user, pb.GophKeeper_AddBinary_FullMethodName)
+	require.NoError(t, err)
+
+	stream, err := call(user, pb.GophKeeper_AddBinary_FullMethodName)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, []string{"10"}, stream.trailer.Get(RetryAfterTrailer))
+
+	_, err = call(context.WithValue(context.Background(), "login", "other"), pb.GophKeeper_AddBinary_FullMethodName)
+	require.NoError(t, err)
+
+	// Authorization calls are limited by address, whatever the port.
+	from := func(port int) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: port}})
+	}
+	_, err = call(from(1000), pb.Authorization_LoginUser_FullMethodName)
+	require.NoError(t, err)
+	stream, err = call(from(2000), pb.Authorization_LoginUser_FullMethodName)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, []string{"1"}, stream.trailer.Get(RetryAfterTrailer))
+}
+
+func TestShedUnaryInterceptor(t *testing.T) {
+	l, _ := newLimiter(nil, 1)
+	info := &grpc.UnaryServerInfo{FullMethod: pb.GophKeeper_GetPassword_FullMethodName}
+
+	_, err := l.ShedUnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		// The call in flight takes the only slot.
+		_, err := l.ShedUnaryInterceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+			return nil, nil
+		})
+		require.Equal(t, codes.Unavailable, status.Code(err))
+
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	// The slot is released when the call ends.
+	_, err = l.ShedUnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
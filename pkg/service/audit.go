@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"log/slog"
+	"net"
+	"praktikum-gophkeeper/pkg/audit"
+	"praktikum-gophkeeper/pkg/auth"
+	pb "praktikum-gophkeeper/proto"
+	"strings"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type auditRepository interface {
+	Record(ctx context.Context, event *pb.AuditEvent) error
+	Since(ctx context.Context, actor string, seq int64, limit uint32) (events []*pb.AuditEvent, err error)
+}
+
+type auditedMethod struct {
+	action pb.AuditAction
+	// itemType is taken from the request when it is unspecified.
+	itemType pb.ItemType
+}
+
+// auditedMethods are the calls an audit event is recorded for: every
+// authorization call and every call that reads or changes items.
+var auditedMethods = map[string]auditedMethod{
+	pb.Authorization_RegisterUser_FullMethodName: {action: pb.AuditAction_AUDIT_ACTION_REGISTER},
+	pb.Authorization_LoginUser_FullMethodName:    {action: pb.AuditAction_AUDIT_ACTION_LOGIN},
+	pb.Authorization_RefreshToken_FullMethodName: {action: pb.AuditAction_AUDIT_ACTION_REFRESH},
+
+	pb.GophKeeper_AddPassword_FullMethodName:    {pb.AuditAction_AUDIT_ACTION_ADD, pb.ItemType_ITEM_TYPE_PASSWORD},
+	pb.GophKeeper_GetPassword_FullMethodName:    {pb.AuditAction_AUDIT_ACTION_GET, pb.ItemType_ITEM_TYPE_PASSWORD},
+	pb.GophKeeper_UpdatePassword_FullMethodName: {pb.AuditAction_AUDIT_ACTION_UPDATE, pb.ItemType_ITEM_TYPE_PASSWORD},
+	pb.GophKeeper_DeletePassword_FullMethodName: {pb.AuditAction_AUDIT_ACTION_DELETE, pb.ItemType_ITEM_TYPE_PASSWORD},
+
+	pb.GophKeeper_AddText_FullMethodName:    {pb.AuditAction_AUDIT_ACTION_ADD, pb.ItemType_ITEM_TYPE_TEXT},
+	pb.GophKeeper_GetText_FullMethodName:    {pb.AuditAction_AUDIT_ACTION_GET, pb.ItemType_ITEM_TYPE_TEXT},
+	pb.GophKeeper_UpdateText_FullMethodName: {pb.AuditAction_AUDIT_ACTION_UPDATE, pb.ItemType_ITEM_TYPE_TEXT},
+	pb.GophKeeper_DeleteText_FullMethodName: {pb.AuditAction_AUDIT_ACTION_DELETE, pb.ItemType_ITEM_TYPE_TEXT},
+
+	pb.GophKeeper_AddBinary_FullMethodName:    {pb.AuditAction_AUDIT_ACTION_ADD, pb.ItemType_ITEM_TYPE_BINARY},
+	pb.GophKeeper_GetBinary_FullMethodName:    {pb.AuditAction_AUDIT_ACTION_GET, pb.ItemType_ITEM_TYPE_BINARY},
+	pb.GophKeeper_UpdateBinary_FullMethodName: {pb.AuditAction_AUDIT_ACTION_UPDATE, pb.ItemType_ITEM_TYPE_BINARY},
+	pb.GophKeeper_DeleteBinary_FullMethodName: {pb.AuditAction_AUDIT_ACTION_DELETE, pb.ItemType_ITEM_TYPE_BINARY},
+
+	pb.GophKeeper_AddPayment_FullMethodName:    {pb.AuditAction_AUDIT_ACTION_ADD, pb.ItemType_ITEM_TYPE_PAYMENT},
+	pb.GophKeeper_GetPayment_FullMethodName:    {pb.AuditAction_AUDIT_ACTION_GET, pb.ItemType_ITEM_TYPE_PAYMENT},
+	pb.GophKeeper_UpdatePayment_FullMethodName: {pb.AuditAction_AUDIT_ACTION_UPDATE, pb.ItemType_ITEM_TYPE_PAYMENT},
+	pb.GophKeeper_DeletePayment_FullMethodName: {pb.AuditAction_AUDIT_ACTION_DELETE, pb.ItemType_ITEM_TYPE_PAYMENT},
+
+	pb.GophKeeper_ListTrash_FullMethodName:       {action: pb.AuditAction_AUDIT_ACTION_LIST_TRASH},
+	pb.GophKeeper_RestoreItem_FullMethodName:     {action: pb.AuditAction_AUDIT_ACTION_RESTORE},
+	pb.GophKeeper_PurgeItem_FullMethodName:       {action: pb.AuditAction_AUDIT_ACTION_PURGE},
+	pb.GophKeeper_GetItemHistory_FullMethodName:  {action: pb.AuditAction_AUDIT_ACTION_GET_HISTORY},
+	pb.GophKeeper_RevertItem_FullMethodName:      {action: pb.AuditAction_AUDIT_ACTION_REVERT},
+	pb.GophKeeper_SetHistoryDepth_FullMethodName: {action: pb.AuditAction_AUDIT_ACTION_SET_HISTORY_DEPTH},
+	pb.GophKeeper_MoveItem_FullMethodName:        {action: pb.AuditAction_AUDIT_ACTION_MOVE},
+	pb.GophKeeper_DeleteFolder_FullMethodName:    {action: pb.AuditAction_AUDIT_ACTION_DELETE_FOLDER},
+	pb.GophKeeper_Sync_FullMethodName:            {action: pb.AuditAction_AUDIT_ACTION_SYNC},
+	pb.GophKeeper_Watch_FullMethodName:           {action: pb.AuditAction_AUDIT_ACTION_WATCH},
+}
+
+// AuditUnaryInterceptor records an audit event for every audited call, failed
+// ones included. It must run after AuthUnaryInterceptor. A call isn't failed
+// when its event couldn't be recorded, as it has already been made.
+func (s *GophKeeperServer) AuditUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	method, ok := auditedMethods[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	resp, err := handler(ctx, req)
+	s.recordAudit(ctx, info.FullMethod, method, req, resp, err)
+
+	return resp, err
+}
+
+// AuditStreamInterceptor records an audit event for every audited stream once
+// it ends, like AuditUnaryInterceptor. It must run after AuthStreamInterceptor.
+func (s *GophKeeperServer) AuditStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	method, ok := auditedMethods[info.FullMethod]
+	if !ok {
+		return handler(srv, ss)
+	}
+
+	stream := &auditedStream{ServerStream: ss}
+	err := handler(srv, stream)
+	s.recordAudit(ss.Context(), info.FullMethod, method, stream.req, nil, err)
+
+	return err
+}
+
+// auditedStream keeps the request of a server streaming call.
+type auditedStream struct {
+	grpc.ServerStream
+	req any
+}
+
+func (s *auditedStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.req == nil {
+		s.req = m
+	}
+
+	return err
+}
+
+// recordAudit records the event of a call that has been made.
+func (s *GophKeeperServer) recordAudit(ctx context.Context, fullMethod string, method auditedMethod, req, resp any, err error) {
+	event := &pb.AuditEvent{
+		Session:  audit.Session(callToken(ctx)),
+		Ip:       peerIP(ctx),
+		Action:   method.action,
+		ItemType: method.itemType,
+		ItemIds:  itemIDs(req),
+		Outcome:  status.Code(err).String(),
+	}
+	if r, ok := req.(interface{ GetType() pb.ItemType }); ok && event.ItemType == pb.ItemType_ITEM_TYPE_UNSPECIFIED {
+		event.ItemType = r.GetType()
+	}
+	if login, ok := ctx.Value("login").(string); ok {
+		event.Actor = login
+	} else if r, ok := req.(interface{ GetUser() *pb.User }); ok {
+		event.Actor = r.GetUser().GetLogin()
+	}
+	if r, ok := resp.(interface{ GetToken() string }); ok && err == nil {
+		event.Session = audit.Session(r.GetToken())
+		// Refreshed tokens are the only trace of who refreshed them.
+		if event.Actor == "" {
+			event.Actor, _ = auth.ParseToken(r.GetToken())
+		}
+	}
+	if len(event.ItemIds) == 0 && err == nil {
+		event.ItemIds = itemIDs(resp)
+	}
+
+	// The event is recorded even when the client has gone away meanwhile.
+	recordErr := s.audit.Record(context.WithoutCancel(ctx), event)
+	if recordErr != nil {
+		slog.ErrorContext(ctx, "Couldn't record audit event", "method", fullMethod, "error", recordErr)
+	}
+}
+
+// callToken returns the token the call was made with, empty without one.
+func callToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(tokenHeader)
+	if len(values) == 0 || !strings.HasPrefix(values[0], tokenPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(values[0], tokenPrefix)
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// itemIDs returns the id of the message, or the ids of the items it holds,
+// which is how requests and responses of item calls carry them.
+func itemIDs(m any) []string {
+	msg, ok := m.(proto.Message)
+	if !ok || msg == nil || !msg.ProtoReflect().IsValid() {
+		return nil
+	}
+
+	r := msg.ProtoReflect()
+	if id := messageID(r); id != "" {
+		return []string{id}
+	}
+
+	var ids []string
+	r.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Message() == nil || fd.IsMap():
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				if id := messageID(v.List().Get(i).Message()); id != "" {
+					ids = append(ids, id)
+				}
+			}
+		default:
+			if id := messageID(v.Message()); id != "" {
+				ids = append(ids, id)
+			}
+		}
+
+		return true
+	})
+
+	return ids
+}
+
+func messageID(m protoreflect.Message) string {
+	fd := m.Descriptor().Fields().ByName("id")
+	if fd == nil || fd.Kind() != protoreflect.StringKind {
+		return ""
+	}
+
+	return m.Get(fd).String()
+}
+
+// ListAuditEvents returns the audit events of the user, oldest first.
+func (s *GophKeeperServer) ListAuditEvents(ctx context.Context, in *pb.ListAuditEventsRequest) (*pb.ListAuditEventsResponse, error) {
+	resp := &pb.ListAuditEventsResponse{Seq: in.Since}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	limit := in.Limit
+	if limit == 0 {
+		limit = defaultAuditLimit
+	} else if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	// One extra event tells whether there is another page.
+	events, err := s.audit.Since(ctx, login, in.Since, limit+1)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't get audit events from database")
+	}
+
+	if len(events) > int(limit) {
+		events = events[:limit]
+		resp.HasMore = true
+	}
+
+	resp.Events = events
+	if len(events) > 0 {
+		resp.Seq = events[len(events)-1].Seq
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"praktikum-gophkeeper/pkg/audit"
+	"praktikum-gophkeeper/pkg/auth"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+type fakeAudit struct {
+	events []*pb.AuditEvent
+}
+
+func (f *fakeAudit) Record(ctx context.Context, event *pb.AuditEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeAudit) Since(_ context.Context, _ string, _ int64, _ uint32) ([]*pb.AuditEvent, error) {
+	return f.events, nil
+}
+
+func TestAuditUnaryInterceptor(t *testing.T) {
+	refreshed, err := auth.GenerateToken("user", 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		method string
+		login  string
+		req    any
+		resp   any
+		err    error
+		// canceled calls are canceled by the client while they are handled.
+		canceled bool
+		want     *pb.AuditEvent
+	}{
+		{
+			name:   "login",
+			method: pb.Authorization_LoginUser_FullMethodName,
+			req:    &pb.LoginUserRequest{User: &pb.User{Login: "user", Password: "secret"}},
+			resp:   &pb.LoginUserResponse{Token: "issued"},
+			want: &pb.AuditEvent{
+				Actor:   "user",
+				Session: audit.Session("issued"),
+				Action:  pb.AuditAction_AUDIT_ACTION_LOGIN,
+				Outcome: "OK",
+			},
+		},
+		{
+			name:   "failed login",
+			method: pb.Authorization_LoginUser_FullMethodName,
+			req:    &pb.LoginUserRequest{User: &pb.User{Login: "user", Password: "wrong"}},
+			err:    status.Error(codes.InvalidArgument, "Invalid login or password."),
+			want: &pb.AuditEvent{
+				Actor:   "user",
+				Action:  pb.AuditAction_AUDIT_ACTION_LOGIN,
+				Outcome: "InvalidArgument",
+			},
+		},
+		{
+			name:   "added item",
+			method: pb.GophKeeper_AddPassword_FullMethodName,
+			login:  "user",
+			req:    &pb.AddPasswordRequest{Password: &pb.Password{Website: "example.com"}},
+			resp:   &pb.AddPasswordResponse{Password: &pb.Password{Id: "new"}},
+			want: &pb.AuditEvent{
+				Actor:    "user",
+				Session:  audit.Session("token"),
+				Action:   pb.AuditAction_AUDIT_ACTION_ADD,
+				ItemType: pb.ItemType_ITEM_TYPE_PASSWORD,
+				ItemIds:  []string{"new"},
+				Outcome:  "OK",
+			},
+		},
+		{
+			name:   "got items",
+			method: pb.GophKeeper_GetPayment_FullMethodName,
+			login:  "user",
+			req:    &pb.GetPaymentRequest{Filter: &pb.Filter{Tags: []string{"work"}}},
+			resp:   &pb.GetPaymentResponse{Payments: []*pb.Payment{{Id: "a"}, {Id: "b"}}},
+			want: &pb.AuditEvent{
+				Actor:    "user",
+				Session:  audit.Session("token"),
+				Action:   pb.AuditAction_AUDIT_ACTION_GET,
+				ItemType: pb.ItemType_ITEM_TYPE_PAYMENT,
+				ItemIds:  []string{"a", "b"},
+				Outcome:  "OK",
+			},
+		},
+		{
+			name:   "failed delete",
+			method: pb.GophKeeper_DeleteText_FullMethodName,
+			login:  "user",
+			req:    &pb.DeleteTextRequest{Id: "missing"},
+			err:    status.Error(codes.NotFound, "Text missing doesn't found"),
+			want: &pb.AuditEvent{
+				Actor:    "user",
+				Session:  audit.Session("token"),
+				Action:   pb.AuditAction_AUDIT_ACTION_DELETE,
+				ItemType: pb.ItemType_ITEM_TYPE_TEXT,
+				ItemIds:  []string{"missing"},
+				Outcome:  "NotFound",
+			},
+		},
+		{
+			name:     "canceled",
+			method:   pb.GophKeeper_DeleteText_FullMethodName,
+			login:    "user",
+			req:      &pb.DeleteTextRequest{Id: "gone"},
+			err:      status.Error(codes.Canceled, "context canceled"),
+			canceled: true,
+			want: &pb.AuditEvent{
+				Actor:    "user",
+				Session:  audit.Session("token"),
+				Action:   pb.AuditAction_AUDIT_ACTION_DELETE,
+				ItemType: pb.ItemType_ITEM_TYPE_TEXT,
+				ItemIds:  []string{"gone"},
+				Outcome:  "Canceled",
+			},
+		},
+		{
+			name:   "refreshed token",
+			method: pb.Authorization_RefreshToken_FullMethodName,
+			req:    &pb.RefreshTokenRequest{RefreshToken: "refresh"},
+			resp:   &pb.RefreshTokenResponse{Token: refreshed, RefreshToken: "next"},
+			want: &pb.AuditEvent{
+				Actor:   "user",
+				Session: audit.Session(refreshed),
+				Action:  pb.AuditAction_AUDIT_ACTION_REFRESH,
+				Outcome: "OK",
+			},
+		},
+		{
+			name:   "restored item",
+			method: pb.GophKeeper_RestoreItem_FullMethodName,
+			login:  "user",
+			req:    &pb.RestoreItemRequest{Type: pb.ItemType_ITEM_TYPE_BINARY, Id: "trashed"},
+			resp:   &pb.RestoreItemResponse{},
+			want: &pb.AuditEvent{
+				Actor:    "user",
+				Session:  audit.Session("token"),
+				Action:   pb.AuditAction_AUDIT_ACTION_RESTORE,
+				ItemType: pb.ItemType_ITEM_TYPE_BINARY,
+				ItemIds:  []string{"trashed"},
+				Outcome:  "OK",
+			},
+		},
+		{
+			name:   "not audited",
+			method: pb.GophKeeper_ListFolders_FullMethodName,
+			login:  "user",
+			req:    &pb.ListFoldersRequest{},
+			resp:   &pb.ListFoldersResponse{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAudit{}
+			s := &GophKeeperServer{audit: repo}
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tokenHeader, tokenPrefix+"token"))
+			if tt.login == "" {
+				ctx = context.Background()
+			} else {
+				ctx = context.WithValue(ctx, "login", tt.login)
+			}
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}})
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			info := &grpc.UnaryServerInfo{FullMethod: tt.method}
+
+			_, err := s.AuditUnaryInterceptor(ctx, tt.req, info, func(ctx context.Context, req any) (any, error) {
+				if tt.canceled {
+					cancel()
+				}
+				return tt.resp, tt.err
+			})
+			require.Equal(t, tt.err, err)
+
+			if tt.want == nil {
+				require.Empty(t, repo.events)
+				return
+			}
+			require.Len(t, repo.events, 1)
+			tt.want.Ip = "192.0.2.1"
+			require.Equal(t, tt.want.String(), repo.events[0].String())
+		})
+	}
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (f *fakeServerStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeServerStream) RecvMsg(m any) error {
+	m.(*pb.WatchRequest).Since = 7
+	return nil
+}
+
+func TestAuditStreamInterceptor(t *testing.T) {
+	repo := &fakeAudit{}
+	s := &GophKeeperServer{audit: repo}
+
+	ctx := context.WithValue(context.Background(), "login", "user")
+	ss := &fakeServerStream{ctx: ctx}
+	info := &grpc.StreamServerInfo{FullMethod: pb.GophKeeper_Watch_FullMethodName, IsServerStream: true}
+
+	err := s.AuditStreamInterceptor(nil, ss, info, func(_ any, stream grpc.ServerStream) error {
+		req := &pb.WatchRequest{}
+		require.NoError(t, stream.RecvMsg(req))
+		return status.Error(codes.Canceled, "context canceled")
+	})
+	require.Equal(t, codes.Canceled, status.Code(err))
+
+	require.Len(t, repo.events, 1)
+	want := &pb.AuditEvent{Actor: "user", Action: pb.AuditAction_AUDIT_ACTION_WATCH, Outcome: "Canceled"}
+	require.Equal(t, want.String(), repo.events[0].String())
+}
+
+// unauditedMethods don't read or change items or credentials, so no audit
+// events are recorded for them.
+var unauditedMethods = map[string]bool{
+	pb.GophKeeper_CreateFolder_FullMethodName: true,
+	pb.GophKeeper_RenameFolder_FullMethodName: true,
+	pb.GophKeeper_MoveFolder_FullMethodName:   true,
+	pb.GophKeeper_ListFolders_FullMethodName:  true,
+	// Reading the audit log itself would add an event on every page.
+	pb.GophKeeper_ListAuditEvents_FullMethodName: true,
+	pb.GophKeeper_GetUsage_FullMethodName:        true,
+}
+
+func TestEveryMethodAudited(t *testing.T) {
+	for _, desc := range []grpc.ServiceDesc{pb.Authorization_ServiceDesc, pb.GophKeeper_ServiceDesc} {
+		var names []string
+		for _, method := range desc.Methods {
+			names = append(names, method.MethodName)
+		}
+		for _, stream := range desc.Streams {
+			names = append(names, stream.StreamName)
+		}
+
+		for _, name := range names {
+			fullMethod := "/" + desc.ServiceName + "/" + name
+			_, audited := auditedMethods[fullMethod]
+			require.True(t, audited != unauditedMethods[fullMethod], "%s must be either audited or excluded", fullMethod)
+		}
+	}
+}
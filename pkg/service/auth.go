@@ -2,70 +2,153 @@ package service
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5"
+	"errors"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"praktikum-gophkeeper/pkg/auth"
+	"praktikum-gophkeeper/pkg/logging"
+	"praktikum-gophkeeper/pkg/metrics"
 	"praktikum-gophkeeper/pkg/storage"
 	pb "praktikum-gophkeeper/proto"
+	"sync/atomic"
+	"time"
 )
 
 type userRepository interface {
-	Add(user *pb.User) error
-	Get(login string) (*pb.User, error)
+	Add(ctx context.Context, user *pb.User) error
+	Get(ctx context.Context, login string) (*pb.User, error)
+}
+
+type refreshTokenRepository interface {
+	Add(ctx context.Context, user, hash string, expiresAt *time.Time) error
+	Take(ctx context.Context, hash string) (string, error)
 }
 
 type AuthServer struct {
 	pb.UnimplementedAuthorizationServer
-	user userRepository
+	user    userRepository
+	refresh refreshTokenRepository
+	// tokenLifetime and refreshLifetime are time.Durations that can change
+	// while the server runs.
+	tokenLifetime   atomic.Int64
+	refreshLifetime atomic.Int64
 }
 
-func NewAuthServer(conn *pgx.Conn) (*AuthServer, error) {
+func NewAuthServer(conn *pgxpool.Pool, tokenLifetime, refreshLifetime time.Duration) (*AuthServer, error) {
 	s, err := storage.NewUserStorage(conn)
 	if err != nil {
 		return nil, err
 	}
 
-	return &AuthServer{user: s}, nil
+	refresh, err := storage.NewRefreshTokenStorage(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &AuthServer{user: s, refresh: refresh}
+	server.SetTokenLifetime(tokenLifetime)
+	server.SetRefreshLifetime(refreshLifetime)
+	return server, nil
+}
+
+// SetTokenLifetime changes the lifetime of tokens issued from now on.
+func (s *AuthServer) SetTokenLifetime(lifetime time.Duration) {
+	s.tokenLifetime.Store(int64(lifetime))
+}
+
+// SetRefreshLifetime changes the lifetime of refresh tokens issued from now on.
+func (s *AuthServer) SetRefreshLifetime(lifetime time.Duration) {
+	s.refreshLifetime.Store(int64(lifetime))
+}
+
+// issueTokens returns a token of the user and a refresh token that gets the
+// next one.
+func (s *AuthServer) issueTokens(ctx context.Context, login string) (token, refreshToken string, err error) {
+	token, err = auth.GenerateToken(login, time.Duration(s.tokenLifetime.Load()))
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	var expiresAt *time.Time
+	if lifetime := time.Duration(s.refreshLifetime.Load()); lifetime != 0 {
+		t := time.Now().Add(lifetime)
+		expiresAt = &t
+	}
+
+	err = s.refresh.Add(ctx, login, hash, expiresAt)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, refreshToken, nil
 }
 
 func (s *AuthServer) RegisterUser(ctx context.Context, in *pb.RegisterUserRequest) (*pb.RegisterUserResponse, error) {
 	resp := &pb.RegisterUserResponse{}
 
-	if _, err := s.user.Get(in.User.Login); err == nil {
+	if _, err := s.user.Get(ctx, in.User.Login); err == nil {
 		return nil, status.Errorf(codes.AlreadyExists, `User with login "%s" already exist`, in.User.Login)
 	}
 
-	err := s.user.Add(in.User)
+	err := s.user.Add(ctx, in.User)
 	if err != nil {
 		return nil, err
 	}
+	metrics.Registration()
+	logging.SetLogin(ctx, in.User.Login)
 
-	token, err := auth.GenerateToken(in.User.Login)
+	resp.Token, resp.RefreshToken, err = s.issueTokens(ctx, in.User.Login)
 	if err != nil {
 		return nil, err
 	}
 
-	resp.Token = token
-
 	return resp, nil
 }
 
 func (s *AuthServer) LoginUser(ctx context.Context, in *pb.LoginUserRequest) (*pb.LoginUserResponse, error) {
 	resp := &pb.LoginUserResponse{}
 
-	if user, err := s.user.Get(in.User.Login); err != nil {
+	if user, err := s.user.Get(ctx, in.User.Login); err != nil {
+		metrics.Login(false)
 		return nil, err
 	} else if in.User.Password != user.Password {
+		metrics.Login(false)
 		return nil, status.Errorf(codes.InvalidArgument, "Invalid login or password.")
 	}
+	metrics.Login(true)
+	logging.SetLogin(ctx, in.User.Login)
 
-	token, err := auth.GenerateToken(in.User.Login)
+	var err error
+	resp.Token, resp.RefreshToken, err = s.issueTokens(ctx, in.User.Login)
 	if err != nil {
 		return nil, err
 	}
 
-	resp.Token = token
+	return resp, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token and refresh token.
+func (s *AuthServer) RefreshToken(ctx context.Context, in *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	resp := &pb.RefreshTokenResponse{}
+
+	login, err := s.refresh.Take(ctx, auth.HashRefreshToken(in.RefreshToken))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "Invalid refresh token")
+	} else if err != nil {
+		return nil, err
+	}
+	logging.SetLogin(ctx, login)
+
+	resp.Token, resp.RefreshToken, err = s.issueTokens(ctx, login)
+	if err != nil {
+		return nil, err
+	}
 
 	return resp, nil
 }
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"praktikum-gophkeeper/pkg/auth"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+	"time"
+)
+
+type fakeUsers struct {
+	users map[string]*pb.User
+}
+
+func (f *fakeUsers) Add(_ context.Context, user *pb.User) error {
+	f.users[user.Login] = user
+	return nil
+}
+
+func (f *fakeUsers) Get(_ context.Context, login string) (*pb.User, error) {
+	user, ok := f.users[login]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "User not found")
+	}
+
+	return user, nil
+}
+
+type fakeRefreshTokens struct {
+	owners  map[string]string
+	expires map[string]*time.Time
+}
+
+func (f *fakeRefreshTokens) Add(_ context.Context, user, hash string, expiresAt *time.Time) error {
+	f.owners[hash] = user
+	f.expires[hash] = expiresAt
+	return nil
+}
+
+func (f *fakeRefreshTokens) Take(_ context.Context, hash string) (string, error) {
+	user, ok := f.owners[hash]
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+
+	delete(f.owners, hash)
+	return user, nil
+}
+
+func TestRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	refresh := &fakeRefreshTokens{owners: map[string]string{}, expires: map[string]*time.Time{}}
+	s := &AuthServer{
+		user:    &fakeUsers{users: map[string]*pb.User{"user": {Login: "user", Password: "secret"}}},
+		refresh: refresh,
+	}
+	s.SetRefreshLifetime(time.Hour)
+
+	login, err := s.LoginUser(ctx, &pb.LoginUserRequest{User: &pb.User{Login: "user", Password: "secret"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, login.RefreshToken)
+	require.NotNil(t, refresh.expires[auth.HashRefreshToken(login.RefreshToken)])
+
+	resp, err := s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	require.NoError(t, err)
+	require.NotEqual(t, login.RefreshToken, resp.RefreshToken)
+
+	user, err := auth.ParseToken(resp.Token)
+	require.NoError(t, err)
+	require.Equal(t, "user", user)
+
+	// A refresh token is used only once.
+	_, err = s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.RefreshToken})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	s.SetRefreshLifetime(0)
+	resp, err = s.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: resp.RefreshToken})
+	require.NoError(t, err)
+	require.Nil(t, refresh.expires[auth.HashRefreshToken(resp.RefreshToken)])
+}
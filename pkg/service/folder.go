@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+)
+
+type folderRepository interface {
+	Create(ctx context.Context, user, name string, parentID uint32) (*pb.Folder, error)
+	Get(ctx context.Context, user string, id uint32) (*pb.Folder, error)
+	List(ctx context.Context, user string) (folders []*pb.Folder, err error)
+	Rename(ctx context.Context, user string, id uint32, name string) error
+	Move(ctx context.Context, user string, id, parentID uint32) error
+	Delete(ctx context.Context, user string, id uint32, moveToRoot bool) error
+}
+
+// checkFolder makes sure that a non-root folder exists and belongs to the user.
+func (s *GophKeeperServer) checkFolder(ctx context.Context, login string, id uint32) error {
+	if id == 0 {
+		return nil
+	}
+
+	_, err := s.folder.Get(ctx, login, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "Folder %d doesn't found", id)
+	} else if err != nil {
+		return internalError(ctx, err, "Couldn't get folder from database")
+	}
+
+	return nil
+}
+
+func (s *GophKeeperServer) CreateFolder(ctx context.Context, in *pb.CreateFolderRequest) (*pb.CreateFolderResponse, error) {
+	resp := &pb.CreateFolderResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	if in.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "Folder name is empty")
+	}
+
+	err := s.checkFolder(ctx, login, in.ParentId)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, err := s.folder.Create(ctx, login, in.Name, in.ParentId)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't create folder in database")
+	}
+
+	resp.Folder = folder
+
+	return resp, nil
+}
+
+func (s *GophKeeperServer) RenameFolder(ctx context.Context, in *pb.RenameFolderRequest) (*pb.RenameFolderResponse, error) {
+	resp := &pb.RenameFolderResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	if in.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "Folder name is empty")
+	}
+
+	err := s.folder.Rename(ctx, login, in.Id, in.Name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Folder %d doesn't found", in.Id)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't rename folder in database")
+	}
+
+	return resp, nil
+}
+
+func (s *GophKeeperServer) MoveFolder(ctx context.Context, in *pb.MoveFolderRequest) (*pb.MoveFolderResponse, error) {
+	resp := &pb.MoveFolderResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	err := s.checkFolder(ctx, login, in.ParentId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.folder.Move(ctx, login, in.Id, in.ParentId)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Folder %d doesn't found", in.Id)
+	} else if errors.Is(err, storage.ErrFolderCycle) {
+		return nil, status.Errorf(codes.InvalidArgument, "Folder %d can't be moved into itself or its subfolder %d", in.Id, in.ParentId)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't move folder in database")
+	}
+
+	return resp, nil
+}
+
+func (s *GophKeeperServer) DeleteFolder(ctx context.Context, in *pb.DeleteFolderRequest) (*pb.DeleteFolderResponse, error) {
+	resp := &pb.DeleteFolderResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	err := s.folder.Delete(ctx, login, in.Id, in.MoveToRoot)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Folder %d doesn't found", in.Id)
+	} else if errors.Is(err, storage.ErrFolderNotEmpty) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Folder %d isn't empty", in.Id)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't delete folder from database")
+	}
+
+	return resp, nil
+}
+
+func (s *GophKeeperServer) ListFolders(ctx context.Context, in *pb.ListFoldersRequest) (*pb.ListFoldersResponse, error) {
+	resp := &pb.ListFoldersResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	folders, err := s.folder.List(ctx, login)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't get folders from database")
+	}
+
+	resp.Folders = folders
+
+	return resp, nil
+}
+
+func (s *GophKeeperServer) MoveItem(ctx context.Context, in *pb.MoveItemRequest) (*pb.MoveItemResponse, error) {
+	resp := &pb.MoveItemResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	repo, err := s.itemRepository(in.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkFolder(ctx, login, in.FolderId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.Move(ctx, login, in.Id, in.FolderId)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Item %s doesn't found", in.Id)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't move item in database")
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+type fakeFolders struct {
+	folderRepository
+	parents map[uint32]uint32
+}
+
+func (f *fakeFolders) Get(_ context.Context, _ string, id uint32) (*pb.Folder, error) {
+	parentID, ok := f.parents[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &pb.Folder{Id: id, ParentId: parentID}, nil
+}
+
+func (f *fakeFolders) Move(_ context.Context, _ string, id, parentID uint32) error {
+	if _, ok := f.parents[id]; !ok {
+		return storage.ErrNotFound
+	}
+	for p := parentID; p != 0; p = f.parents[p] {
+		if p == id {
+			return storage.ErrFolderCycle
+		}
+	}
+
+	f.parents[id] = parentID
+	return nil
+}
+
+func TestMoveFolder(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "login", "user")
+
+	tests := []struct {
+		name     string
+		in       *pb.MoveFolderRequest
+		wantCode codes.Code
+	}{
+		{
+			name: "to root",
+			in:   &pb.MoveFolderRequest{Id: 3},
+		},
+		{
+			name: "to another folder",
+			in:   &pb.MoveFolderRequest{Id: 3, ParentId: 1},
+		},
+		{
+			name:     "into itself",
+			in:       &pb.MoveFolderRequest{Id: 1, ParentId: 1},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "into subfolder",
+			in:       &pb.MoveFolderRequest{Id: 1, ParentId: 3},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "missing parent",
+			in:       &pb.MoveFolderRequest{Id: 1, ParentId: 4},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "missing folder",
+			in:       &pb.MoveFolderRequest{Id: 4},
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GophKeeperServer{folder: &fakeFolders{parents: map[uint32]uint32{1: 0, 2: 1, 3: 2}}}
+
+			_, err := s.MoveFolder(ctx, tt.in)
+			require.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestCheckFilterRootOnly(t *testing.T) {
+	require.NoError(t, checkFilter(&pb.Filter{RootOnly: true}))
+	require.Equal(t, codes.InvalidArgument, status.Code(checkFilter(&pb.Filter{RootOnly: true, FolderId: 1})))
+}
@@ -2,39 +2,54 @@ package service
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"praktikum-gophkeeper/pkg/broker"
 	"praktikum-gophkeeper/pkg/storage"
 	pb "praktikum-gophkeeper/proto"
+	"sync/atomic"
+	"time"
 )
 
 type passwordRepository interface {
-	Add(user string, password *pb.Password) error
-	Get(user, website string) (passwords []*pb.Password, ids []uint32, err error)
-	Update(user string, id int32, password *pb.Password) error
-	Delete(user string, id int32) error
+	itemRepository
+	Add(ctx context.Context, user string, password *pb.Password) (*pb.Password, error)
+	Get(ctx context.Context, user, website string, filter *pb.Filter) (passwords []*pb.Password, err error)
+	GetByIDs(ctx context.Context, user string, ids []string) (passwords []*pb.Password, err error)
+	Update(ctx context.Context, user, id string, password *pb.Password, base *time.Time) error
+	Delete(ctx context.Context, user, id string) error
 }
 
 type textRepository interface {
-	Add(user string, text *pb.Text) error
-	Get(user, title string) (texts []*pb.Text, ids []uint32, err error)
-	Update(user string, id uint32, text *pb.Text) error
-	Delete(user string, id uint32) error
+	itemRepository
+	Add(ctx context.Context, user string, text *pb.Text) (*pb.Text, error)
+	Get(ctx context.Context, user, title string, filter *pb.Filter) (texts []*pb.Text, err error)
+	GetByIDs(ctx context.Context, user string, ids []string) (texts []*pb.Text, err error)
+	Update(ctx context.Context, user, id string, text *pb.Text, base *time.Time) error
+	Delete(ctx context.Context, user, id string) error
 }
 
 type binaryRepository interface {
-	Add(user string, binary *pb.Binary) error
-	Get(user, title string) (binaries []*pb.Binary, ids []uint32, err error)
-	Update(user string, id uint32, binary *pb.Binary) error
-	Delete(user string, id uint32) error
+	itemRepository
+	Add(ctx context.Context, user string, binary *pb.Binary) (*pb.Binary, error)
+	Get(ctx context.Context, user, title string, filter *pb.Filter) (binaries []*pb.Binary, err error)
+	GetByIDs(ctx context.Context, user string, ids []string) (binaries []*pb.Binary, err error)
+	Update(ctx context.Context, user, id string, binary *pb.Binary, base *time.Time) error
+	Delete(ctx context.Context, user, id string) error
 }
 
 type paymentRepository interface {
-	Add(user string, payment *pb.Payment) error
-	Get(user, name string) (payments []*pb.Payment, ids []uint32, err error)
-	Update(user string, id uint32, payment *pb.Payment) error
-	Delete(user string, id uint32) error
+	itemRepository
+	Add(ctx context.Context, user string, payment *pb.Payment) (*pb.Payment, error)
+	Get(ctx context.Context, user, name string, filter *pb.Filter) (payments []*pb.Payment, err error)
+	GetByIDs(ctx context.Context, user string, ids []string) (payments []*pb.Payment, err error)
+	Update(ctx context.Context, user, id string, payment *pb.Payment, base *time.Time) error
+	Delete(ctx context.Context, user, id string) error
 }
 
 type GophKeeperServer struct {
@@ -43,25 +58,64 @@ type GophKeeperServer struct {
 	text     textRepository
 	binary   binaryRepository
 	payment  paymentRepository
+	history  historyRepository
+	folder   folderRepository
+	change   changeRepository
+	audit    auditRepository
+	usage    usageRepository
+	broker   *broker.Broker
+
+	// maxHistoryDepth can change while the server runs.
+	maxHistoryDepth atomic.Uint32
 }
 
-func NewGophKeeperServer(conn *pgx.Conn) (*GophKeeperServer, error) {
-	pass, err := storage.NewPasswordStorage(conn)
+// NewGophKeeperServer stores items in conn, limiting them by defaultQuota
+// unless their owners have quotas of their own.
+func NewGophKeeperServer(conn *pgxpool.Pool, defaultQuota *storage.DefaultQuota, auditKey []byte) (*GophKeeperServer, error) {
+	// Item tables reference folders, so folders have to be created first.
+	folder, err := storage.NewFolderStorage(conn)
 	if err != nil {
 		return nil, err
 	}
 
-	text, err := storage.NewTextStorage(conn)
+	pass, err := storage.NewPasswordStorage(conn, defaultQuota)
 	if err != nil {
 		return nil, err
 	}
 
-	binary, err := storage.NewBinaryStorage(conn)
+	text, err := storage.NewTextStorage(conn, defaultQuota)
 	if err != nil {
 		return nil, err
 	}
 
-	payment, err := storage.NewPaymentStorage(conn)
+	binary, err := storage.NewBinaryStorage(conn, defaultQuota)
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := storage.NewPaymentStorage(conn, defaultQuota)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := storage.NewHistoryStorage(conn, defaultQuota)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := storage.NewChangeStorage(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := storage.NewAuditStorage(conn, auditKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Usage counts the items and versions stored so far, so item and history
+	// tables have to be created first.
+	usage, err := storage.NewUsageStorage(conn, defaultQuota)
 	if err != nil {
 		return nil, err
 	}
@@ -71,9 +125,66 @@ func NewGophKeeperServer(conn *pgx.Conn) (*GophKeeperServer, error) {
 		text:     text,
 		binary:   binary,
 		payment:  payment,
+		history:  history,
+		folder:   folder,
+		change:   change,
+		audit:    audit,
+		usage:    usage,
+		broker:   broker.New(),
 	}, nil
 }
 
+// checkID makes sure that a client provided item id is a UUID.
+func checkID(id string) error {
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "Invalid item id %q", id)
+	}
+
+	return nil
+}
+
+// checkFilter makes sure that the item ids of a filter are UUIDs and that it
+// doesn't ask for items both in the root and in a folder.
+func checkFilter(filter *pb.Filter) error {
+	if filter.GetRootOnly() && filter.GetFolderId() != 0 {
+		return status.Error(codes.InvalidArgument, "Filter can't have both a folder and root only")
+	}
+
+	for _, id := range filter.GetIds() {
+		err := checkID(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// namesItem reports whether a get request is for one specific item, named or
+// given by its id, rather than a listing. Only such requests mark the item
+// they have found as used.
+func namesItem(name string, filter *pb.Filter) bool {
+	return name != "" || len(filter.GetIds()) == 1
+}
+
+// baseVersion returns the time an update was made against, or nil when the
+// client doesn't care what it overwrites.
+func baseVersion(updatedAt *timestamppb.Timestamp) *time.Time {
+	if updatedAt == nil {
+		return nil
+	}
+
+	base := updatedAt.AsTime()
+	return &base
+}
+
+// internalError logs the cause of a failure, which clients don't see.
+func internalError(ctx context.Context, err error, msg string) error {
+	slog.ErrorContext(ctx, msg, "error", err)
+	return status.Error(codes.Internal, msg)
+}
+
 func (s *GophKeeperServer) AddPassword(ctx context.Context, in *pb.AddPasswordRequest) (*pb.AddPasswordResponse, error) {
 	resp := &pb.AddPasswordResponse{}
 
@@ -82,11 +193,29 @@ func (s *GophKeeperServer) AddPassword(ctx context.Context, in *pb.AddPasswordRe
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.password.Add(login, in.Password)
+	if in.Password.GetId() != "" {
+		err := checkID(in.Password.GetId())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.checkFolder(ctx, login, in.Password.GetFolderId())
 	if err != nil {
 		return nil, err
 	}
 
+	password, err := s.password.Add(ctx, login, in.Password)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "Password %s already exists", in.Password.GetId())
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	resp.Password = password
+
 	return resp, nil
 }
 
@@ -98,13 +227,27 @@ func (s *GophKeeperServer) GetPassword(ctx context.Context, in *pb.GetPasswordRe
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	passwords, ids, err := s.password.Get(login, in.Website)
+	err := checkFilter(in.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords, err := s.password.Get(ctx, login, in.Website, in.Filter)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(passwords) == 1 && namesItem(in.Website, in.Filter) {
+		usedAt, err := s.password.MarkUsed(ctx, login, passwords[0].Id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "Password %s doesn't found", passwords[0].Id)
+		} else if err != nil {
+			return nil, internalError(ctx, err, "Failed to mark password as used")
+		}
+		passwords[0].LastUsedAt = timestamppb.New(usedAt)
+	}
+
 	resp.Passwords = passwords
-	resp.Ids = ids
 
 	return resp, nil
 }
@@ -117,9 +260,20 @@ func (s *GophKeeperServer) UpdatePassword(ctx context.Context, in *pb.UpdatePass
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.password.Update(login, in.Id, in.Password)
+	err := checkID(in.Id)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "Couldn't update password in database")
+		return nil, err
+	}
+
+	err = s.password.Update(ctx, login, in.Id, in.Password, baseVersion(in.BaseUpdatedAt))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Password %s doesn't found", in.Id)
+	} else if errors.Is(err, storage.ErrChanged) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Password %s was changed since %s", in.Id, in.BaseUpdatedAt.AsTime().Format(time.RFC3339))
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't update password in database")
 	}
 
 	return resp, nil
@@ -133,9 +287,16 @@ func (s *GophKeeperServer) DeletePassword(ctx context.Context, in *pb.DeletePass
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.password.Delete(login, in.Id)
+	err := checkID(in.Id)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "Couldn't delete password from database")
+		return nil, err
+	}
+
+	err = s.password.Delete(ctx, login, in.Id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Password %s doesn't found", in.Id)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't delete password from database")
 	}
 
 	return resp, nil
@@ -149,11 +310,29 @@ func (s *GophKeeperServer) AddText(ctx context.Context, in *pb.AddTextRequest) (
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.text.Add(login, in.Text)
+	if in.Text.GetId() != "" {
+		err := checkID(in.Text.GetId())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.checkFolder(ctx, login, in.Text.GetFolderId())
 	if err != nil {
 		return nil, err
 	}
 
+	text, err := s.text.Add(ctx, login, in.Text)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "Text %s already exists", in.Text.GetId())
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	resp.Text = text
+
 	return resp, nil
 }
 
@@ -165,13 +344,27 @@ func (s *GophKeeperServer) GetText(ctx context.Context, in *pb.GetTextRequest) (
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	texts, ids, err := s.text.Get(login, in.Title)
+	err := checkFilter(in.Filter)
 	if err != nil {
 		return nil, err
 	}
 
+	texts, err := s.text.Get(ctx, login, in.Title, in.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(texts) == 1 && namesItem(in.Title, in.Filter) {
+		usedAt, err := s.text.MarkUsed(ctx, login, texts[0].Id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "Text %s doesn't found", texts[0].Id)
+		} else if err != nil {
+			return nil, internalError(ctx, err, "Failed to mark text as used")
+		}
+		texts[0].LastUsedAt = timestamppb.New(usedAt)
+	}
+
 	resp.Texts = texts
-	resp.Ids = ids
 
 	return resp, nil
 }
@@ -184,11 +377,22 @@ func (s *GophKeeperServer) UpdateText(ctx context.Context, in *pb.UpdateTextRequ
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.text.Update(login, in.Id, in.Text)
+	err := checkID(in.Id)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.text.Update(ctx, login, in.Id, in.Text, baseVersion(in.BaseUpdatedAt))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Text %s doesn't found", in.Id)
+	} else if errors.Is(err, storage.ErrChanged) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Text %s was changed since %s", in.Id, in.BaseUpdatedAt.AsTime().Format(time.RFC3339))
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
 
@@ -200,11 +404,18 @@ func (s *GophKeeperServer) DeleteText(ctx context.Context, in *pb.DeleteTextRequ
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.text.Delete(login, in.Id)
+	err := checkID(in.Id)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.text.Delete(ctx, login, in.Id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Text %s doesn't found", in.Id)
+	} else if err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
 
@@ -216,11 +427,29 @@ func (s *GophKeeperServer) AddBinary(ctx context.Context, in *pb.AddBinaryReques
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.binary.Add(login, in.Binary)
+	if in.Binary.GetId() != "" {
+		err := checkID(in.Binary.GetId())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.checkFolder(ctx, login, in.Binary.GetFolderId())
 	if err != nil {
 		return nil, err
 	}
 
+	binary, err := s.binary.Add(ctx, login, in.Binary)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "Binary %s already exists", in.Binary.GetId())
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	resp.Binary = binary
+
 	return resp, nil
 }
 
@@ -232,13 +461,27 @@ func (s *GophKeeperServer) GetBinary(ctx context.Context, in *pb.GetBinaryReques
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	binaries, ids, err := s.binary.Get(login, in.Title)
+	err := checkFilter(in.Filter)
 	if err != nil {
 		return nil, err
 	}
 
+	binaries, err := s.binary.Get(ctx, login, in.Title, in.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(binaries) == 1 && namesItem(in.Title, in.Filter) {
+		usedAt, err := s.binary.MarkUsed(ctx, login, binaries[0].Id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "Binary %s doesn't found", binaries[0].Id)
+		} else if err != nil {
+			return nil, internalError(ctx, err, "Failed to mark binary as used")
+		}
+		binaries[0].LastUsedAt = timestamppb.New(usedAt)
+	}
+
 	resp.Binaries = binaries
-	resp.Ids = ids
 
 	return resp, nil
 }
@@ -251,11 +494,22 @@ func (s *GophKeeperServer) UpdateBinary(ctx context.Context, in *pb.UpdateBinary
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.binary.Update(login, in.Id, in.Binary)
+	err := checkID(in.Id)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.binary.Update(ctx, login, in.Id, in.Binary, baseVersion(in.BaseUpdatedAt))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Binary %s doesn't found", in.Id)
+	} else if errors.Is(err, storage.ErrChanged) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Binary %s was changed since %s", in.Id, in.BaseUpdatedAt.AsTime().Format(time.RFC3339))
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
 
@@ -267,11 +521,18 @@ func (s *GophKeeperServer) DeleteBinary(ctx context.Context, in *pb.DeleteBinary
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.binary.Delete(login, in.Id)
+	err := checkID(in.Id)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.binary.Delete(ctx, login, in.Id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Binary %s doesn't found", in.Id)
+	} else if err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
 
@@ -283,11 +544,29 @@ func (s *GophKeeperServer) AddPayment(ctx context.Context, in *pb.AddPaymentRequ
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.payment.Add(login, in.Payment)
+	if in.Payment.GetId() != "" {
+		err := checkID(in.Payment.GetId())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.checkFolder(ctx, login, in.Payment.GetFolderId())
 	if err != nil {
 		return nil, err
 	}
 
+	payment, err := s.payment.Add(ctx, login, in.Payment)
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "Payment %s already exists", in.Payment.GetId())
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	resp.Payment = payment
+
 	return resp, nil
 }
 
@@ -299,13 +578,27 @@ func (s *GophKeeperServer) GetPayment(ctx context.Context, in *pb.GetPaymentRequ
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	payments, ids, err := s.payment.Get(login, in.Name)
+	err := checkFilter(in.Filter)
 	if err != nil {
 		return nil, err
 	}
 
+	payments, err := s.payment.Get(ctx, login, in.Name, in.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payments) == 1 && namesItem(in.Name, in.Filter) {
+		usedAt, err := s.payment.MarkUsed(ctx, login, payments[0].Id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "Payment %s doesn't found", payments[0].Id)
+		} else if err != nil {
+			return nil, internalError(ctx, err, "Failed to mark payment as used")
+		}
+		payments[0].LastUsedAt = timestamppb.New(usedAt)
+	}
+
 	resp.Payments = payments
-	resp.Ids = ids
 
 	return resp, nil
 }
@@ -318,11 +611,22 @@ func (s *GophKeeperServer) UpdatePayment(ctx context.Context, in *pb.UpdatePayme
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.payment.Update(login, in.Id, in.Payment)
+	err := checkID(in.Id)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.payment.Update(ctx, login, in.Id, in.Payment, baseVersion(in.BaseUpdatedAt))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Payment %s doesn't found", in.Id)
+	} else if errors.Is(err, storage.ErrChanged) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Payment %s was changed since %s", in.Id, in.BaseUpdatedAt.AsTime().Format(time.RFC3339))
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
 
@@ -334,10 +638,17 @@ func (s *GophKeeperServer) DeletePayment(ctx context.Context, in *pb.DeletePayme
 		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
 	}
 
-	err := s.payment.Delete(login, in.Id)
+	err := checkID(in.Id)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.payment.Delete(ctx, login, in.Id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Payment %s doesn't found", in.Id)
+	} else if err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+	"time"
+)
+
+func (f *fakePasswords) Get(_ context.Context, _, website string, _ *pb.Filter) (passwords []*pb.Password, err error) {
+	for _, password := range f.passwords {
+		if website == "" || password.Website == website {
+			passwords = append(passwords, password)
+		}
+	}
+
+	return passwords, nil
+}
+
+func (f *fakePasswords) MarkUsed(_ context.Context, _, id string) (time.Time, error) {
+	f.used = append(f.used, id)
+	return time.Now(), nil
+}
+
+func (f *fakePasswords) Update(_ context.Context, _, id string, password *pb.Password, base *time.Time) error {
+	for i, current := range f.passwords {
+		if current.Id != id {
+			continue
+		}
+		if base != nil && !current.UpdatedAt.AsTime().Equal(*base) {
+			return storage.ErrChanged
+		}
+
+		f.passwords[i] = password
+		return nil
+	}
+
+	return storage.ErrNotFound
+}
+
+func TestGetPasswordMarksUsed(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "login", "user")
+
+	tests := []struct {
+		name string
+		in   *pb.GetPasswordRequest
+		used []string
+	}{
+		{
+			name: "listing",
+			in:   &pb.GetPasswordRequest{},
+		},
+		{
+			name: "by website",
+			in:   &pb.GetPasswordRequest{Website: "example.com"},
+			used: []string{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passwords := &fakePasswords{passwords: []*pb.Password{
+				{Id: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Website: "example.com"},
+				{Id: "6ba7b811-9dad-11d1-80b4-00c04fd430c8", Website: "example.org"},
+			}}
+			s := &GophKeeperServer{password: passwords}
+
+			resp, err := s.GetPassword(ctx, tt.in)
+			require.NoError(t, err)
+			require.Equal(t, tt.used, passwords.used)
+			for _, password := range resp.Passwords {
+				require.Equal(t, tt.used != nil, password.LastUsedAt != nil)
+			}
+		})
+	}
+}
+
+func TestUpdatePasswordPrecondition(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "login", "user")
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	updatedAt := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		base     *timestamppb.Timestamp
+		wantCode codes.Code
+	}{
+		{
+			name: "without base",
+		},
+		{
+			name: "unchanged",
+			base: timestamppb.New(updatedAt),
+		},
+		{
+			name:     "changed",
+			base:     timestamppb.New(updatedAt.Add(-time.Minute)),
+			wantCode: codes.FailedPrecondition,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GophKeeperServer{password: &fakePasswords{passwords: []*pb.Password{
+				{Id: id, Website: "example.com", UpdatedAt: timestamppb.New(updatedAt)},
+			}}}
+
+			_, err := s.UpdatePassword(ctx, &pb.UpdatePasswordRequest{
+				Id:            id,
+				Password:      &pb.Password{Website: "example.org"},
+				BaseUpdatedAt: tt.base,
+			})
+			require.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"praktikum-gophkeeper/pkg/protofield"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+)
+
+type historyRepository interface {
+	Get(ctx context.Context, user string, itemType pb.ItemType, id string) (entries []*pb.HistoryEntry, err error)
+	GetVersion(ctx context.Context, user string, itemType pb.ItemType, id string, version uint32) (*pb.HistoryEntry, error)
+	SetDepth(ctx context.Context, user string, itemType pb.ItemType, depth uint32) error
+}
+
+func (s *GophKeeperServer) GetItemHistory(ctx context.Context, in *pb.GetItemHistoryRequest) (*pb.GetItemHistoryResponse, error) {
+	resp := &pb.GetItemHistoryResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	if _, err := s.itemRepository(in.Type); err != nil {
+		return nil, err
+	}
+
+	err := checkID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.history.Get(ctx, login, in.Type, in.Id)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't get item history from database")
+	}
+
+	current, err := s.currentVersion(ctx, login, in.Type, in.Id)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't get item from database")
+	}
+
+	// Entries are ordered newest first, so every entry is compared with the next one
+	// and the current version with the newest entry.
+	for i := 0; i+1 < len(entries); i++ {
+		entries[i].ChangedFields = changedFields(historyItem(entries[i+1]), historyItem(entries[i]))
+	}
+	if current != nil && len(entries) > 0 {
+		current.ChangedFields = changedFields(historyItem(entries[0]), historyItem(current))
+	}
+
+	resp.Entries = entries
+	resp.Current = current
+
+	return resp, nil
+}
+
+func (s *GophKeeperServer) RevertItem(ctx context.Context, in *pb.RevertItemRequest) (*pb.RevertItemResponse, error) {
+	resp := &pb.RevertItemResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	if _, err := s.itemRepository(in.Type); err != nil {
+		return nil, err
+	}
+
+	err := checkID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := s.history.GetVersion(ctx, login, in.Type, in.Id, in.Version)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Version %d of item %s doesn't found", in.Version, in.Id)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't get item history from database")
+	}
+
+	switch item := entry.Item.(type) {
+	case *pb.HistoryEntry_Password:
+		err = s.password.Update(ctx, login, in.Id, item.Password, nil)
+	case *pb.HistoryEntry_Text:
+		err = s.text.Update(ctx, login, in.Id, item.Text, nil)
+	case *pb.HistoryEntry_Binary:
+		err = s.binary.Update(ctx, login, in.Id, item.Binary, nil)
+	case *pb.HistoryEntry_Payment:
+		err = s.payment.Update(ctx, login, in.Id, item.Payment, nil)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Item %s doesn't found", in.Id)
+	} else if errors.Is(err, storage.ErrQuotaExceeded) {
+		return nil, quotaError(err)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't revert item in database")
+	}
+
+	return resp, nil
+}
+
+// SetMaxHistoryDepth changes the largest history depth users can choose from
+// now on. Depths chosen before are kept.
+func (s *GophKeeperServer) SetMaxHistoryDepth(depth uint32) {
+	s.maxHistoryDepth.Store(depth)
+}
+
+func (s *GophKeeperServer) SetHistoryDepth(ctx context.Context, in *pb.SetHistoryDepthRequest) (*pb.SetHistoryDepthResponse, error) {
+	resp := &pb.SetHistoryDepthResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	if _, err := s.itemRepository(in.Type); err != nil {
+		return nil, err
+	}
+
+	if maxDepth := s.maxHistoryDepth.Load(); in.Depth > maxDepth {
+		return nil, status.Errorf(codes.InvalidArgument, "History depth %d is larger than %d", in.Depth, maxDepth)
+	}
+
+	err := s.history.SetDepth(ctx, login, in.Type, in.Depth)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't set history depth in database")
+	}
+
+	return resp, nil
+}
+
+// currentVersion returns the current version of an item as a history entry,
+// nil while the item is in trash or when it doesn't exist.
+func (s *GophKeeperServer) currentVersion(ctx context.Context, login string, itemType pb.ItemType, id string) (*pb.HistoryEntry, error) {
+	ids := []string{id}
+	entry := &pb.HistoryEntry{}
+
+	switch itemType {
+	case pb.ItemType_ITEM_TYPE_PASSWORD:
+		passwords, err := s.password.GetByIDs(ctx, login, ids)
+		if err != nil || len(passwords) == 0 {
+			return nil, err
+		}
+		entry.Item = &pb.HistoryEntry_Password{Password: passwords[0]}
+		entry.CreatedAt = passwords[0].UpdatedAt
+	case pb.ItemType_ITEM_TYPE_TEXT:
+		texts, err := s.text.GetByIDs(ctx, login, ids)
+		if err != nil || len(texts) == 0 {
+			return nil, err
+		}
+		entry.Item = &pb.HistoryEntry_Text{Text: texts[0]}
+		entry.CreatedAt = texts[0].UpdatedAt
+	case pb.ItemType_ITEM_TYPE_BINARY:
+		binaries, err := s.binary.GetByIDs(ctx, login, ids)
+		if err != nil || len(binaries) == 0 {
+			return nil, err
+		}
+		entry.Item = &pb.HistoryEntry_Binary{Binary: binaries[0]}
+		entry.CreatedAt = binaries[0].UpdatedAt
+	case pb.ItemType_ITEM_TYPE_PAYMENT:
+		payments, err := s.payment.GetByIDs(ctx, login, ids)
+		if err != nil || len(payments) == 0 {
+			return nil, err
+		}
+		entry.Item = &pb.HistoryEntry_Payment{Payment: payments[0]}
+		entry.CreatedAt = payments[0].UpdatedAt
+	}
+
+	return entry, nil
+}
+
+func historyItem(entry *pb.HistoryEntry) proto.Message {
+	switch item := entry.Item.(type) {
+	case *pb.HistoryEntry_Password:
+		return item.Password
+	case *pb.HistoryEntry_Text:
+		return item.Text
+	case *pb.HistoryEntry_Binary:
+		return item.Binary
+	case *pb.HistoryEntry_Payment:
+		return item.Payment
+	}
+
+	return nil
+}
+
+// unversioned holds the fields maintained by the server, which history
+// entries don't keep.
+var unversioned = map[protoreflect.Name]bool{
+	"id":           true,
+	"folder_id":    true,
+	"created_at":   true,
+	"updated_at":   true,
+	"last_used_at": true,
+}
+
+// changedFields returns names of the fields whose values differ between two messages of the same type.
+func changedFields(older, newer proto.Message) []string {
+	if older == nil || newer == nil {
+		return nil
+	}
+
+	a, b := older.ProtoReflect(), newer.ProtoReflect()
+	if a.Descriptor() != b.Descriptor() {
+		return nil
+	}
+
+	var changed []string
+	fields := a.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if unversioned[fd.Name()] {
+			continue
+		}
+		if !proto.Equal(protofield.Only(a, fd), protofield.Only(b, fd)) {
+			changed = append(changed, string(fd.Name()))
+		}
+	}
+
+	return changed
+}
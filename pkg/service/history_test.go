@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"math"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		older proto.Message
+		newer proto.Message
+		want  []string
+	}{
+		{
+			name:  "equal",
+			older: &pb.Password{Website: "example.com", Login: "login", Password: "pass"},
+			newer: &pb.Password{Website: "example.com", Login: "login", Password: "pass"},
+			want:  nil,
+		},
+		{
+			name:  "password rotated",
+			older: &pb.Password{Website: "example.com", Login: "login", Password: "old"},
+			newer: &pb.Password{Website: "example.com", Login: "login", Password: "new"},
+			want:  []string{"password"},
+		},
+		{
+			name:  "cleared fields",
+			older: &pb.Payment{Name: "card", Cardholder: "IVAN IVANOV", Code: "123"},
+			newer: &pb.Payment{Name: "card"},
+			want:  []string{"cardholder", "code"},
+		},
+		{
+			name:  "binary file",
+			older: &pb.Binary{Title: "file", File: []byte{1, 2}},
+			newer: &pb.Binary{Title: "file", File: []byte{1, 3}},
+			want:  []string{"file"},
+		},
+		{
+			name:  "different types",
+			older: &pb.Text{Title: "note"},
+			newer: &pb.Binary{Title: "note"},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, changedFields(tt.older, tt.newer))
+		})
+	}
+}
+
+type fakeHistory struct {
+	historyRepository
+	entries []*pb.HistoryEntry
+	depth   uint32
+}
+
+func (f *fakeHistory) SetDepth(_ context.Context, _ string, _ pb.ItemType, depth uint32) error {
+	f.depth = depth
+	return nil
+}
+
+func (f *fakeHistory) Get(_ context.Context, _ string, _ pb.ItemType, _ string) ([]*pb.HistoryEntry, error) {
+	return f.entries, nil
+}
+
+type fakePasswords struct {
+	passwordRepository
+	passwords []*pb.Password
+	used      []string
+}
+
+func (f *fakePasswords) GetByIDs(_ context.Context, _ string, ids []string) (passwords []*pb.Password, err error) {
+	for _, password := range f.passwords {
+		if password.Id == ids[0] {
+			passwords = append(passwords, password)
+		}
+	}
+
+	return passwords, nil
+}
+
+func TestGetItemHistory(t *testing.T) {
+	const id = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	history := &fakeHistory{entries: []*pb.HistoryEntry{
+		{Version: 2, Item: &pb.HistoryEntry_Password{Password: &pb.Password{Website: "example.com", Login: "new", Password: "old"}}},
+		{Version: 1, Item: &pb.HistoryEntry_Password{Password: &pb.Password{Website: "example.com", Login: "old", Password: "old"}}},
+	}}
+	current := &pb.Password{Id: id, Website: "example.com", Login: "new", Password: "rotated", FolderId: 3, UpdatedAt: timestamppb.Now()}
+	s := &GophKeeperServer{history: history, password: &fakePasswords{passwords: []*pb.Password{current}}}
+	ctx := context.WithValue(context.Background(), "login", "user")
+
+	resp, err := s.GetItemHistory(ctx, &pb.GetItemHistoryRequest{Type: pb.ItemType_ITEM_TYPE_PASSWORD, Id: id})
+	require.NoError(t, err)
+	require.Len(t, resp.Entries, 2)
+	require.Equal(t, []string{"login"}, resp.Entries[0].ChangedFields)
+	require.Empty(t, resp.Entries[1].ChangedFields)
+	require.Equal(t, current, resp.Current.GetPassword())
+	require.Equal(t, current.UpdatedAt, resp.Current.CreatedAt)
+	// Fields the server maintains aren't versioned, so they don't count as changed.
+	require.Equal(t, []string{"password"}, resp.Current.ChangedFields)
+
+	// Items in trash have no current version.
+	s.password = &fakePasswords{}
+	resp, err = s.GetItemHistory(ctx, &pb.GetItemHistoryRequest{Type: pb.ItemType_ITEM_TYPE_PASSWORD, Id: id})
+	require.NoError(t, err)
+	require.Len(t, resp.Entries, 2)
+	require.Nil(t, resp.Current)
+}
+
+func TestSetHistoryDepth(t *testing.T) {
+	tests := []struct {
+		name     string
+		depth    uint32
+		wantCode codes.Code
+	}{
+		{
+			name:  "none",
+			depth: 0,
+		},
+		{
+			name:  "max",
+			depth: 100,
+		},
+		{
+			name:     "too deep",
+			depth:    math.MaxUint32,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := &fakeHistory{depth: 10}
+			s := &GophKeeperServer{history: history}
+			s.SetMaxHistoryDepth(100)
+			ctx := context.WithValue(context.Background(), "login", "user")
+
+			_, err := s.SetHistoryDepth(ctx, &pb.SetHistoryDepthRequest{Type: pb.ItemType_ITEM_TYPE_PASSWORD, Depth: tt.depth})
+			require.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				require.Equal(t, tt.depth, history.depth)
+			} else {
+				require.Equal(t, uint32(10), history.depth)
+			}
+		})
+	}
+}
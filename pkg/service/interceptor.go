@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"praktikum-gophkeeper/pkg/auth"
+	"praktikum-gophkeeper/pkg/logging"
+	"strings"
+)
+
+const (
+	tokenHeader = "authorization"
+	tokenPrefix = "Bearer "
+
+	// authorizationService methods are called before the client has a token.
+	authorizationService = "/gophkeeper.Authorization/"
+	// healthService methods are called by balancers without one.
+	healthService = "/grpc.health.v1.Health/"
+)
+
+// public tells whether the method is called without a token.
+func public(method string) bool {
+	return strings.HasPrefix(method, authorizationService) || strings.HasPrefix(method, healthService)
+}
+
+// AuthUnaryInterceptor puts the login of the token owner into the context of every call except authorization and health ones.
+func AuthUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if public(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// AuthStreamInterceptor is AuthUnaryInterceptor for streaming calls.
+func AuthStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if public(info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	ctx, err := authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+func authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	values := md.Get(tokenHeader)
+	if len(values) == 0 || !strings.HasPrefix(values[0], tokenPrefix) {
+		return nil, status.Error(codes.Unauthenticated, "Token doesn't found in metadata")
+	}
+
+	login, err := auth.ParseToken(strings.TrimPrefix(values[0], tokenPrefix))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid token")
+	}
+	logging.SetLogin(ctx, login)
+
+	return context.WithValue(ctx, "login", login), nil
+}
+
+// contextStream replaces the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
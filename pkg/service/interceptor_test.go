@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"praktikum-gophkeeper/pkg/auth"
+	"testing"
+)
+
+func TestAuthUnaryInterceptor(t *testing.T) {
+	token, err := auth.GenerateToken("Login", 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		method    string
+		md        metadata.MD
+		wantLogin string
+		wantCode  codes.Code
+	}{
+		{
+			name:      "valid token",
+			method:    "/gophkeeper.GophKeeper/GetPassword",
+			md:        metadata.Pairs("authorization", "Bearer "+token),
+			wantLogin: "Login",
+		},
+		{
+			name:     "missing token",
+			method:   "/gophkeeper.GophKeeper/GetPassword",
+			md:       metadata.MD{},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "invalid token",
+			method:   "/gophkeeper.GophKeeper/GetPassword",
+			md:       metadata.Pairs("authorization", "Bearer invalid"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:   "authorization service",
+			method: "/gophkeeper.Authorization/LoginUser",
+			md:     metadata.MD{},
+		},
+		{
+			name:   "health service",
+			method: "/grpc.health.v1.Health/Check",
+			md:     metadata.MD{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			info := &grpc.UnaryServerInfo{FullMethod: tt.method}
+
+			var login string
+			_, err := AuthUnaryInterceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+				login, _ = ctx.Value("login").(string)
+				return nil, nil
+			})
+
+			if tt.wantCode != codes.OK {
+				require.Equal(t, tt.wantCode, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantLogin, login)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	pb "praktikum-gophkeeper/proto"
+)
+
+const (
+	defaultSyncLimit = 100
+	maxSyncLimit     = 1000
+)
+
+type changeRepository interface {
+	Since(ctx context.Context, user string, seq int64, limit uint32) (changes []*pb.Change, err error)
+	Last(ctx context.Context, user string) (int64, error)
+}
+
+func (s *GophKeeperServer) Sync(ctx context.Context, in *pb.SyncRequest) (*pb.SyncResponse, error) {
+	resp := &pb.SyncResponse{Seq: in.Since}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	limit := in.Limit
+	if limit == 0 {
+		limit = defaultSyncLimit
+	} else if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	// One extra change tells whether there is another page.
+	changes, err := s.change.Since(ctx, login, in.Since, limit+1)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't get changes from database")
+	}
+
+	if len(changes) > int(limit) {
+		changes = changes[:limit]
+		resp.HasMore = true
+	}
+
+	err = s.attachItems(ctx, login, changes)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't get changed items from database")
+	}
+
+	resp.Changes = changes
+	if len(changes) > 0 {
+		resp.Seq = changes[len(changes)-1].Seq
+	}
+
+	return resp, nil
+}
+
+// attachItems fills changes with the current state of their items.
+// Changes of items which are in trash or purged are left without payload as tombstones.
+func (s *GophKeeperServer) attachItems(ctx context.Context, login string, changes []*pb.Change) error {
+	ids := map[pb.ItemType][]string{}
+	byID := map[pb.ItemType]map[string]*pb.Change{}
+	for _, change := range changes {
+		if change.Operation == pb.Operation_OPERATION_DELETE || change.Operation == pb.Operation_OPERATION_PURGE {
+			continue
+		}
+
+		if byID[change.Type] == nil {
+			byID[change.Type] = map[string]*pb.Change{}
+		}
+		ids[change.Type] = append(ids[change.Type], change.Id)
+		byID[change.Type][change.Id] = change
+	}
+
+	if len(ids[pb.ItemType_ITEM_TYPE_PASSWORD]) > 0 {
+		passwords, err := s.password.GetByIDs(ctx, login, ids[pb.ItemType_ITEM_TYPE_PASSWORD])
+		if err != nil {
+			return err
+		}
+		for _, password := range passwords {
+			byID[pb.ItemType_ITEM_TYPE_PASSWORD][password.Id].Item = &pb.Change_Password{Password: password}
+		}
+	}
+
+	if len(ids[pb.ItemType_ITEM_TYPE_TEXT]) > 0 {
+		texts, err := s.text.GetByIDs(ctx, login, ids[pb.ItemType_ITEM_TYPE_TEXT])
+		if err != nil {
+			return err
+		}
+		for _, text := range texts {
+			byID[pb.ItemType_ITEM_TYPE_TEXT][text.Id].Item = &pb.Change_Text{Text: text}
+		}
+	}
+
+	if len(ids[pb.ItemType_ITEM_TYPE_BINARY]) > 0 {
+		binaries, err := s.binary.GetByIDs(ctx, login, ids[pb.ItemType_ITEM_TYPE_BINARY])
+		if err != nil {
+			return err
+		}
+		for _, binary := range binaries {
+			byID[pb.ItemType_ITEM_TYPE_BINARY][binary.Id].Item = &pb.Change_Binary{Binary: binary}
+		}
+	}
+
+	if len(ids[pb.ItemType_ITEM_TYPE_PAYMENT]) > 0 {
+		payments, err := s.payment.GetByIDs(ctx, login, ids[pb.ItemType_ITEM_TYPE_PAYMENT])
+		if err != nil {
+			return err
+		}
+		for _, payment := range payments {
+			byID[pb.ItemType_ITEM_TYPE_PAYMENT][payment.Id].Item = &pb.Change_Payment{Payment: payment}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+	"time"
+)
+
+type itemRepository interface {
+	Move(ctx context.Context, user, id string, folderID uint32) error
+	Trash(ctx context.Context, user string) (items []*pb.TrashItem, err error)
+	Restore(ctx context.Context, user, id string) error
+	Purge(ctx context.Context, user, id string) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	MarkUsed(ctx context.Context, user, id string) (time.Time, error)
+}
+
+func (s *GophKeeperServer) itemRepositories() []itemRepository {
+	return []itemRepository{s.password, s.text, s.binary, s.payment}
+}
+
+func (s *GophKeeperServer) itemRepository(itemType pb.ItemType) (itemRepository, error) {
+	switch itemType {
+	case pb.ItemType_ITEM_TYPE_PASSWORD:
+		return s.password, nil
+	case pb.ItemType_ITEM_TYPE_TEXT:
+		return s.text, nil
+	case pb.ItemType_ITEM_TYPE_BINARY:
+		return s.binary, nil
+	case pb.ItemType_ITEM_TYPE_PAYMENT:
+		return s.payment, nil
+	}
+
+	return nil, status.Errorf(codes.InvalidArgument, "Unknown item type %s", itemType)
+}
+
+func (s *GophKeeperServer) ListTrash(ctx context.Context, in *pb.ListTrashRequest) (*pb.ListTrashResponse, error) {
+	resp := &pb.ListTrashResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	for _, repo := range s.itemRepositories() {
+		items, err := repo.Trash(ctx, login)
+		if err != nil {
+			return nil, internalError(ctx, err, "Couldn't get trash from database")
+		}
+
+		resp.Items = append(resp.Items, items...)
+	}
+
+	return resp, nil
+}
+
+func (s *GophKeeperServer) RestoreItem(ctx context.Context, in *pb.RestoreItemRequest) (*pb.RestoreItemResponse, error) {
+	resp := &pb.RestoreItemResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	repo, err := s.itemRepository(in.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.Restore(ctx, login, in.Id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Item %s doesn't found in trash", in.Id)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't restore item in database")
+	}
+
+	return resp, nil
+}
+
+func (s *GophKeeperServer) PurgeItem(ctx context.Context, in *pb.PurgeItemRequest) (*pb.PurgeItemResponse, error) {
+	resp := &pb.PurgeItemResponse{}
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	repo, err := s.itemRepository(in.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.Purge(ctx, login, in.Id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Item %s doesn't found in trash", in.Id)
+	} else if err != nil {
+		return nil, internalError(ctx, err, "Couldn't purge item from database")
+	}
+
+	return resp, nil
+}
+
+// RunPurger permanently deletes items that have stayed in trash longer than retention.
+// It checks the trash every interval until ctx is done.
+func (s *GophKeeperServer) RunPurger(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := time.Now().Add(-retention)
+			for _, repo := range s.itemRepositories() {
+				purged, err := repo.PurgeDeleted(ctx, before)
+				if err != nil {
+					slog.ErrorContext(ctx, "Couldn't purge trash", "error", err)
+					continue
+				}
+				if purged > 0 {
+					slog.InfoContext(ctx, "Purged items from trash", "items", purged)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+)
+
+type usageRepository interface {
+	Get(ctx context.Context, user string) (*pb.GetUsageResponse, error)
+}
+
+// quotaError returns the error of a change the quota of the user doesn't
+// leave space for.
+func quotaError(err error) error {
+	if errors.Is(err, storage.ErrItemQuotaExceeded) {
+		return status.Error(codes.ResourceExhausted, "Quota of items exceeded, purge some items of this type")
+	}
+
+	return status.Error(codes.ResourceExhausted, "Quota of stored bytes exceeded, purge some items or lower history depths")
+}
+
+// GetUsage returns what the items of the user take and the quota they take
+// it from.
+func (s *GophKeeperServer) GetUsage(ctx context.Context, in *pb.GetUsageRequest) (*pb.GetUsageResponse, error) {
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return nil, status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	resp, err := s.usage.Get(ctx, login)
+	if err != nil {
+		return nil, internalError(ctx, err, "Couldn't get usage from database")
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+type fakeUsage struct {
+	usage map[string]*pb.GetUsageResponse
+}
+
+func (f *fakeUsage) Get(_ context.Context, user string) (*pb.GetUsageResponse, error) {
+	usage, ok := f.usage[user]
+	if !ok {
+		return nil, fmt.Errorf("no usage of %s", user)
+	}
+
+	return usage, nil
+}
+
+func TestGetUsage(t *testing.T) {
+	usage := &pb.GetUsageResponse{
+		Items:    []*pb.ItemUsage{{Type: pb.ItemType_ITEM_TYPE_BINARY, Items: 2, Bytes: 300}},
+		Bytes:    300,
+		MaxItems: 10,
+		MaxBytes: 1000,
+	}
+	s := &GophKeeperServer{usage: &fakeUsage{usage: map[string]*pb.GetUsageResponse{"user": usage}}}
+
+	resp, err := s.GetUsage(context.WithValue(context.Background(), "login", "user"), &pb.GetUsageRequest{})
+	require.NoError(t, err)
+	require.Equal(t, usage.String(), resp.String())
+
+	_, err = s.GetUsage(context.WithValue(context.Background(), "login", "other"), &pb.GetUsageRequest{})
+	require.Equal(t, codes.Internal, status.Code(err))
+
+	_, err = s.GetUsage(context.Background(), &pb.GetUsageRequest{})
+	require.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestQuotaError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "items",
+			err:  storage.ErrItemQuotaExceeded,
+			want: "Quota of items exceeded, purge some items of this type",
+		},
+		{
+			name: "bytes",
+			err:  fmt.Errorf("add binary: %w", storage.ErrByteQuotaExceeded),
+			want: "Quota of stored bytes exceeded, purge some items or lower history depths",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, tt.err, storage.ErrQuotaExceeded)
+
+			st := status.Convert(quotaError(tt.err))
+			require.Equal(t, codes.ResourceExhausted, st.Code())
+			require.Equal(t, tt.want, st.Message())
+		})
+	}
+}
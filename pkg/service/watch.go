@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"praktikum-gophkeeper/pkg/broker"
+	"praktikum-gophkeeper/pkg/storage"
+	pb "praktikum-gophkeeper/proto"
+	"time"
+)
+
+const (
+	heartbeatInterval = 30 * time.Second
+	listenerRetry     = 5 * time.Second
+)
+
+func (s *GophKeeperServer) Watch(in *pb.WatchRequest, stream pb.GophKeeper_WatchServer) error {
+	ctx := stream.Context()
+
+	login, ok := ctx.Value("login").(string)
+	if !ok {
+		return status.Error(codes.Internal, "Login value doesn't found in context")
+	}
+
+	seq := in.Since
+	if in.FromNow {
+		last, err := s.change.Last(ctx, login)
+		if err != nil {
+			return internalError(ctx, err, "Couldn't get changes from database")
+		}
+		seq = last
+	}
+
+	for {
+		// Subscribing before the replay guarantees that no change is missed in between.
+		sub := s.broker.Subscribe(login)
+
+		var err error
+		seq, err = s.replayChanges(ctx, login, seq, stream)
+		if err == nil {
+			seq, err = forwardChanges(ctx, sub, seq, stream)
+		}
+		sub.Close()
+
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The subscription fell behind, missed changes are replayed from the database.
+	}
+}
+
+// replayChanges sends all changes made after seq and returns the sequence number of the last sent change.
+func (s *GophKeeperServer) replayChanges(ctx context.Context, login string, seq int64, stream pb.GophKeeper_WatchServer) (int64, error) {
+	for {
+		changes, err := s.change.Since(ctx, login, seq, maxSyncLimit)
+		if err != nil {
+			return seq, internalError(ctx, err, "Couldn't get changes from database")
+		}
+
+		for _, change := range changes {
+			err = stream.Send(&pb.WatchEvent{Event: &pb.WatchEvent_Change{Change: change}})
+			if err != nil {
+				return seq, err
+			}
+			seq = change.Seq
+		}
+
+		if len(changes) < maxSyncLimit {
+			return seq, nil
+		}
+	}
+}
+
+// forwardChanges sends changes received by the subscription and heartbeats until the subscription
+// is closed or the stream is done. It returns the sequence number of the last sent change.
+func forwardChanges(ctx context.Context, sub *broker.Subscription, seq int64, stream pb.GophKeeper_WatchServer) (int64, error) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return seq, nil
+		case <-ticker.C:
+			err := stream.Send(&pb.WatchEvent{Event: &pb.WatchEvent_Heartbeat{Heartbeat: &pb.Heartbeat{
+				Seq:  seq,
+				Time: timestamppb.Now(),
+			}}})
+			if err != nil {
+				return seq, err
+			}
+		case change, ok := <-sub.C:
+			if !ok {
+				return seq, nil
+			}
+			// Changes up to seq have already been sent during the replay.
+			if change.Seq <= seq {
+				continue
+			}
+
+			err := stream.Send(&pb.WatchEvent{Event: &pb.WatchEvent_Change{Change: change}})
+			if err != nil {
+				return seq, err
+			}
+			seq = change.Seq
+		}
+	}
+}
+
+// RunChangeListener passes changes made through every server replica to the sessions watching them.
+// It keeps a dedicated database connection and reconnects until ctx is done.
+func (s *GophKeeperServer) RunChangeListener(ctx context.Context, dsn string) {
+	for {
+		conn, err := pgx.Connect(ctx, dsn)
+		if err == nil {
+			err = storage.ListenChanges(ctx, conn, s.broker.Publish)
+			conn.Close(context.Background())
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		slog.ErrorContext(ctx, "Change listener failed", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenerRetry):
+		}
+	}
+}
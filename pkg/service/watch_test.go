@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"praktikum-gophkeeper/pkg/broker"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+type fakeChanges struct {
+	changes []*pb.Change
+}
+
+func (f *fakeChanges) Since(_ context.Context, _ string, seq int64, _ uint32) (changes []*pb.Change, err error) {
+	for _, change := range f.changes {
+		if change.Seq > seq {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+func (f *fakeChanges) Last(_ context.Context, _ string) (int64, error) {
+	return f.changes[len(f.changes)-1].Seq, nil
+}
+
+type fakeWatchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []int64
+}
+
+func (f *fakeWatchStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeWatchStream) Send(event *pb.WatchEvent) error {
+	f.sent = append(f.sent, event.GetChange().GetSeq())
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *pb.WatchRequest
+		want []int64
+	}{
+		{name: "from the beginning", in: &pb.WatchRequest{}, want: []int64{1, 2, 3}},
+		{name: "since", in: &pb.WatchRequest{Since: 1}, want: []int64{2, 3}},
+		{name: "from now", in: &pb.WatchRequest{Since: 1, FromNow: true}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GophKeeperServer{
+				change: &fakeChanges{changes: []*pb.Change{{Seq: 1}, {Seq: 2}, {Seq: 3}}},
+				broker: broker.New(),
+			}
+
+			// The stream ends once the missed changes are sent.
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "login", "user"))
+			cancel()
+			stream := &fakeWatchStream{ctx: ctx}
+
+			require.NoError(t, s.Watch(tt.in, stream))
+			require.Equal(t, tt.want, stream.sent)
+		})
+	}
+}
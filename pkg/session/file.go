@@ -0,0 +1,169 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	saltSize = 16
+	keySize  = 32
+)
+
+// PassphraseFunc asks for the PIN, or for the master password when pin is false.
+type PassphraseFunc func(pin bool) ([]byte, error)
+
+// FileStore keeps the session in a file encrypted with AES-GCM.
+type FileStore struct {
+	path       string
+	passphrase PassphraseFunc
+	// PIN makes Save protect the session with a PIN instead of the master password.
+	PIN bool
+}
+
+// sessionFile is the layout of the session file.
+type sessionFile struct {
+	PIN   bool   `json:"pin"`
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func NewFileStore(path string, passphrase PassphraseFunc) *FileStore {
+	return &FileStore{
+		path:       path,
+		passphrase: passphrase,
+	}
+}
+
+func newAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (f *FileStore) Load() (*Session, error) {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%w: %s has mode %v, expected -rw-------", ErrInsecurePermissions, f.path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file sessionFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read session file %s: %w", f.path, err)
+	}
+
+	passphrase, err := f.passphrase(file.PIN)
+	if err != nil {
+		return nil, err
+	}
+	// The session is saved again with the same passphrase once its token
+	// is refreshed.
+	f.PIN = file.PIN
+
+	aead, err := newAEAD(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := aead.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	s := &Session{}
+	err = json.Unmarshal(plain, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkExpiry(f, s)
+}
+
+func (f *FileStore) Save(s *Session) error {
+	plain, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := f.passphrase(f.PIN)
+	if err != nil {
+		return err
+	}
+
+	file := sessionFile{
+		PIN:  f.PIN,
+		Salt: make([]byte, saltSize),
+	}
+	_, err = rand.Read(file.Salt)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(passphrase, file.Salt)
+	if err != nil {
+		return err
+	}
+
+	file.Nonce = make([]byte, aead.NonceSize())
+	_, err = rand.Read(file.Nonce)
+	if err != nil {
+		return err
+	}
+	file.Data = aead.Seal(nil, file.Nonce, plain, nil)
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(f.path), 0700)
+	if err != nil {
+		return err
+	}
+
+	// A new file is renamed over the old one, which may have been readable by others.
+	tmp := f.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.path)
+}
+
+func (f *FileStore) Remove() error {
+	err := os.Remove(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
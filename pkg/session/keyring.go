@@ -0,0 +1,57 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/zalando/go-keyring"
+)
+
+const keyringService = "gophkeeper"
+
+// KeyringStore keeps the session in the Secret Service over D-Bus, which
+// encrypts it with the login keyring of the user.
+type KeyringStore struct {
+	user string
+}
+
+// keyringAvailable probes the Secret Service, which needs a D-Bus session.
+func keyringAvailable() bool {
+	_, err := keyring.Get(keyringService, "probe")
+	return err == nil || errors.Is(err, keyring.ErrNotFound)
+}
+
+func (k *KeyringStore) Load() (*Session, error) {
+	data, err := keyring.Get(keyringService, k.user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	err = json.Unmarshal([]byte(data), s)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkExpiry(k, s)
+}
+
+func (k *KeyringStore) Save(s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return keyring.Set(keyringService, k.user, string(data))
+}
+
+func (k *KeyringStore) Remove() error {
+	err := keyring.Delete(keyringService, k.user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"os"
+	"time"
+)
+
+var (
+	ErrNoSession           = errors.New("not logged in, run login first")
+	ErrExpired             = errors.New("session expired, log in again")
+	ErrWrongPassphrase     = errors.New("wrong PIN or master password")
+	ErrInsecurePermissions = errors.New("session file is accessible by other users")
+)
+
+// Session is what login leaves for later commands.
+type Session struct {
+	Address string `json:"address"`
+	Login   string `json:"login"`
+	Token   string `json:"token"`
+	// RefreshToken gets a new token once the token has expired.
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresAt is taken from the token and is zero when the token doesn't expire.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func New(address, login, token, refreshToken string) *Session {
+	s := &Session{
+		Address:      address,
+		Login:        login,
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+
+	// The token is only read here, the server verifies it.
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(token, claims)
+	if exp, ok := claims["exp"].(float64); err == nil && ok {
+		s.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return s
+}
+
+// Expired tells whether the token has expired and there is no refresh token
+// to get a new one with.
+func (s *Session) Expired() bool {
+	return s.RefreshToken == "" && !s.ExpiresAt.IsZero() && time.Now().After(s.ExpiresAt)
+}
+
+// Store keeps the session between runs.
+type Store interface {
+	// Load returns ErrNoSession when there is no session, and ErrExpired
+	// when it has expired, in which case the session is removed.
+	Load() (*Session, error)
+	Save(s *Session) error
+	Remove() error
+}
+
+// Open returns the store of the session file at path. The Secret Service is
+// used when it is available and there is no file yet, otherwise the session
+// is kept in the file encrypted with a key derived from a passphrase.
+func Open(path string, passphrase PassphraseFunc) Store {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) && keyringAvailable() {
+		return &KeyringStore{
+			user: path,
+		}
+	}
+
+	return NewFileStore(path, passphrase)
+}
+
+// checkExpiry removes an expired session from the store.
+func checkExpiry(store Store, s *Session) (*Session, error) {
+	if !s.Expired() {
+		return s, nil
+	}
+
+	err := store.Remove()
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, ErrExpired
+}
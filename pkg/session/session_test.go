@@ -0,0 +1,152 @@
+package session
+
+import (
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func token(t *testing.T, exp time.Time) string {
+	claims := jwt.MapClaims{"login": "user"}
+	if !exp.IsZero() {
+		claims["exp"] = exp.Unix()
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	return token
+}
+
+func passphrases(pin, master string) PassphraseFunc {
+	return func(isPIN bool) ([]byte, error) {
+		if isPIN {
+			return []byte(pin), nil
+		}
+		return []byte(master), nil
+	}
+}
+
+func TestNew(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name         string
+		token        string
+		refreshToken string
+		exp          time.Time
+		expired      bool
+	}{
+		{
+			name:  "no expiry",
+			token: token(t, time.Time{}),
+		},
+		{
+			name:  "expires later",
+			token: token(t, exp),
+			exp:   exp,
+		},
+		{
+			name:    "expired",
+			token:   token(t, exp.Add(-2*time.Hour)),
+			exp:     exp.Add(-2 * time.Hour),
+			expired: true,
+		},
+		{
+			name:         "expired with a refresh token",
+			token:        token(t, exp.Add(-2*time.Hour)),
+			refreshToken: "refresh",
+			exp:          exp.Add(-2 * time.Hour),
+		},
+		{
+			name:  "not a JWT",
+			token: "opaque",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(":8080", "user", tt.token, tt.refreshToken)
+			require.True(t, tt.exp.Equal(s.ExpiresAt))
+			require.Equal(t, tt.expired, s.Expired())
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "session")
+	s := New(":8080", "user", token(t, time.Time{}), "refresh")
+
+	store := NewFileStore(path, passphrases("1234", "master"))
+	_, err := store.Load()
+	require.ErrorIs(t, err, ErrNoSession)
+
+	require.NoError(t, store.Save(s))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, s.Token, loaded.Token)
+	require.Equal(t, s.RefreshToken, loaded.RefreshToken)
+	require.Equal(t, s.Login, loaded.Login)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), s.Token)
+
+	_, err = NewFileStore(path, passphrases("1234", "wrong")).Load()
+	require.ErrorIs(t, err, ErrWrongPassphrase)
+
+	// The file records that a PIN was used, so any store asks for it.
+	store.PIN = true
+	require.NoError(t, store.Save(s))
+	_, err = NewFileStore(path, passphrases("1234", "wrong")).Load()
+	require.NoError(t, err)
+	_, err = NewFileStore(path, passphrases("4321", "master")).Load()
+	require.ErrorIs(t, err, ErrWrongPassphrase)
+
+	// A loaded session is saved again with the passphrase it was saved with.
+	other := NewFileStore(path, passphrases("1234", "wrong"))
+	_, err = other.Load()
+	require.NoError(t, err)
+	require.NoError(t, other.Save(s))
+	_, err = NewFileStore(path, passphrases("1234", "wrong")).Load()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chmod(path, 0644))
+	_, err = store.Load()
+	require.ErrorIs(t, err, ErrInsecurePermissions)
+
+	// Saving replaces the file and its permissions.
+	require.NoError(t, store.Save(New(":8080", "user", token(t, time.Now().Add(-time.Minute)), "")))
+	_, err = store.Load()
+	require.ErrorIs(t, err, ErrExpired)
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, store.Remove())
+}
+
+func TestKeyringStore(t *testing.T) {
+	keyring.MockInit()
+	store := &KeyringStore{user: "session"}
+	s := New(":8080", "user", token(t, time.Time{}), "refresh")
+
+	_, err := store.Load()
+	require.ErrorIs(t, err, ErrNoSession)
+
+	require.NoError(t, store.Save(s))
+	loaded, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, s.Token, loaded.Token)
+
+	require.NoError(t, store.Remove())
+	require.NoError(t, store.Remove())
+	_, err = store.Load()
+	require.ErrorIs(t, err, ErrNoSession)
+}
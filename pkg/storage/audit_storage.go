@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"praktikum-gophkeeper/pkg/audit"
+	pb "praktikum-gophkeeper/proto"
+	"time"
+)
+
+type auditStorage struct {
+	conn *pgxpool.Pool
+	key  []byte
+}
+
+// NewAuditStorage records events hashed with the key, which must be kept out
+// of the database.
+func NewAuditStorage(conn *pgxpool.Pool, key []byte) (*auditStorage, error) {
+	s := &auditStorage{
+		conn: conn,
+		key:  key,
+	}
+
+	err := s.ensureTableExist()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Actors don't reference users: failed logins of unknown users are recorded
+// too, and events outlive their users. audit_heads keeps the last event of
+// every actor, so that deleting the latest events is detected as well.
+const (
+	auditTable = `CREATE TABLE IF NOT EXISTS audit_heads (
+    actor TEXT PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    hash TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS audit_events (
+    actor TEXT NOT NULL,
+    seq BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    session TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    action INTEGER NOT NULL,
+    item_type INTEGER NOT NULL,
+    item_ids TEXT[] NOT NULL,
+    outcome TEXT NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    PRIMARY KEY (actor, seq)
+);`
+)
+
+const auditColumns = `seq, created_at, actor, session, ip, action, item_type, item_ids, outcome, prev_hash, hash`
+
+func (s *auditStorage) ensureTableExist() error {
+	_, err := s.conn.Exec(context.Background(), auditTable)
+	return err
+}
+
+// Record appends the event to the chain of its actor, filling in its sequence
+// number, time and hashes.
+func (s *auditStorage) Record(ctx context.Context, event *pb.AuditEvent) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// The head row serializes the events of an actor.
+	_, err = tx.Exec(ctx, `INSERT INTO audit_heads(actor, seq, hash) VALUES($1, 0, '') ON CONFLICT (actor) DO NOTHING`, event.Actor)
+	if err != nil {
+		return err
+	}
+
+	var seq int64
+	var prevHash string
+	err = tx.QueryRow(ctx, `SELECT seq, hash FROM audit_heads WHERE actor = $1 FOR UPDATE`, event.Actor).Scan(&seq, &prevHash)
+	if err != nil {
+		return err
+	}
+
+	event.Seq = seq + 1
+	event.PrevHash = prevHash
+	event.CreatedAt = timestamppb.New(time.Now().UTC().Truncate(time.Microsecond))
+	if event.ItemIds == nil {
+		event.ItemIds = []string{}
+	}
+	event.Hash = audit.Hash(s.key, event)
+
+	query := `INSERT INTO audit_events(` + auditColumns + `) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, err = tx.Exec(
+		ctx,
+		query,
+		event.Seq,
+		event.CreatedAt.AsTime(),
+		event.Actor,
+		event.Session,
+		event.Ip,
+		event.Action,
+		event.ItemType,
+		event.ItemIds,
+		event.Outcome,
+		event.PrevHash,
+		event.Hash,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE audit_heads SET seq = $2, hash = $3 WHERE actor = $1`, event.Actor, event.Seq, event.Hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Since returns at most limit events of the actor recorded after seq, ordered by sequence number.
+func (s *auditStorage) Since(ctx context.Context, actor string, seq int64, limit uint32) (events []*pb.AuditEvent, err error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_events WHERE actor = $1 AND seq > $2 ORDER BY seq LIMIT $3`
+
+	rows, err := s.conn.Query(
+		ctx,
+		query,
+		actor,
+		seq,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// Head returns the sequence number and the hash of the last event of the actor.
+func (s *auditStorage) Head(ctx context.Context, actor string) (seq int64, hash string, err error) {
+	err = s.conn.QueryRow(ctx, `SELECT seq, hash FROM audit_heads WHERE actor = $1`, actor).Scan(&seq, &hash)
+	if err == pgx.ErrNoRows {
+		return 0, "", nil
+	}
+
+	return seq, hash, err
+}
+
+// Actors returns every actor with recorded events, including the ones whose
+// events were all deleted.
+func (s *auditStorage) Actors(ctx context.Context) (actors []string, err error) {
+	query := `SELECT actor FROM audit_heads UNION SELECT actor FROM audit_events ORDER BY actor`
+
+	rows, err := s.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var actor string
+		err := rows.Scan(&actor)
+		if err != nil {
+			return nil, err
+		}
+
+		actors = append(actors, actor)
+	}
+
+	return actors, rows.Err()
+}
+
+func scanAuditEvent(row pgx.Row) (*pb.AuditEvent, error) {
+	event := &pb.AuditEvent{}
+
+	var createdAt time.Time
+	err := row.Scan(
+		&event.Seq,
+		&createdAt,
+		&event.Actor,
+		&event.Session,
+		&event.Ip,
+		&event.Action,
+		&event.ItemType,
+		&event.ItemIds,
+		&event.Outcome,
+		&event.PrevHash,
+		&event.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	event.CreatedAt = timestamppb.New(createdAt)
+
+	return event, nil
+}
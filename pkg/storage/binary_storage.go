@@ -2,18 +2,23 @@ package storage
 
 import (
 	"context"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	pb "praktikum-gophkeeper/proto"
 	"time"
 )
 
 type binaryStorage struct {
-	conn *pgx.Conn
+	conn         *pgxpool.Pool
+	defaultQuota *DefaultQuota
 }
 
-func NewBinaryStorage(conn *pgx.Conn) (*binaryStorage, error) {
+func NewBinaryStorage(conn *pgxpool.Pool, defaultQuota *DefaultQuota) (*binaryStorage, error) {
 	s := &binaryStorage{
-		conn: conn,
+		conn:         conn,
+		defaultQuota: defaultQuota,
 	}
 
 	err := s.ensureTableExist()
@@ -27,86 +32,482 @@ func NewBinaryStorage(conn *pgx.Conn) (*binaryStorage, error) {
 const (
 	binaryTable = `CREATE TABLE IF NOT EXISTS binaries (
     id SERIAL PRIMARY KEY,
+    uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
     title VARCHAR(100) NOT NULL,
     file bytea NOT NULL,
     owner VARCHAR(100) NOT NULL,
     created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    deleted_at TIMESTAMP,
+    metadata JSONB NOT NULL DEFAULT '[]',
+    folder_id INTEGER REFERENCES folders (id),
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    size BIGINT NOT NULL,
     FOREIGN KEY (owner) REFERENCES users (login)
-);`
+);
+ALTER TABLE binaries ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE binaries ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE binaries ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES folders (id);
+ALTER TABLE binaries ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE binaries ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid();
+ALTER TABLE binaries ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+UPDATE binaries SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE binaries ALTER COLUMN updated_at SET NOT NULL;
+ALTER TABLE binaries ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
+ALTER TABLE binaries ADD COLUMN IF NOT EXISTS size BIGINT;`
+
+	binaryColumns = `uuid, title, file, metadata, COALESCE(folder_id, 0), tags, created_at, updated_at, last_used_at`
 )
 
 func (s *binaryStorage) ensureTableExist() error {
-	_, err := s.conn.Exec(context.Background(), binaryTable)
-	return err
+	ctx := context.Background()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, binaryTable)
+	if err != nil {
+		return err
+	}
+
+	err = backfillSizes(ctx, tx, "binaries", binaryColumns, scanBinary)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *binaryStorage) Add(user string, binary *pb.Binary) error {
-	query := `INSERT INTO binaries(title, file, owner, created_at) VALUES($1, $2, $3, $4)`
+// Add stores a new binary under the client provided id or a generated one and returns the stored binary.
+func (s *binaryStorage) Add(ctx context.Context, user string, binary *pb.Binary) (*pb.Binary, error) {
+	metadata, err := marshalMetadata(binary.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	id := binary.Id
+	if id == "" {
+		id = uuid.NewString()
+	}
+	size := itemSize(binary)
+
+	query := `INSERT INTO binaries(uuid, title, file, metadata, folder_id, tags, owner, created_at, updated_at, size)
+VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING ` + binaryColumns
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	row := tx.QueryRow(
+		ctx,
 		query,
+		id,
 		binary.Title,
 		binary.File,
+		metadata,
+		nullableID(binary.FolderId),
+		nonNilTags(binary.Tags),
 		user,
-		time.Now(),
+		now,
+		now,
+		size,
 	)
 
-	return err
+	stored, err := scanBinary(row)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_BINARY, 1, size, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_BINARY, stored.Id, pb.Operation_OPERATION_CREATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, tx.Commit(ctx)
 }
 
-func (s *binaryStorage) Get(user, title string) (binaries []*pb.Binary, ids []uint32, err error) {
-	query := `SELECT title, file, id FROM binaries WHERE owner = $1 AND title = $2`
+// Get returns binaries matching title and filter. Every binary is matched when title is empty,
+// otherwise the returned binaries are considered used and get their last usage time updated.
+func (s *binaryStorage) Get(ctx context.Context, user, title string, filter *pb.Filter) (binaries []*pb.Binary, err error) {
+	where := &conditions{}
+	where.add("owner = ?", user)
+	where.add("deleted_at IS NULL")
+	if title != "" {
+		where.add("title = ?", title)
+	}
+	where.addFilter(filter)
 
-	rows, err := s.conn.Query(
-		context.Background(),
-		query,
-		user,
-		title,
-	)
+	query := `SELECT ` + binaryColumns + ` FROM binaries WHERE ` + where.where()
+
+	rows, err := s.conn.Query(ctx, query, where.args...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		binary := &pb.Binary{}
-		var id uint32
-		err := rows.Scan(&binary.Title, &binary.File, &id)
+		binary, err := scanBinary(rows)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
-		ids = append(ids, id)
 		binaries = append(binaries, binary)
 	}
 
-	return binaries, ids, nil
+	return binaries, rows.Err()
+}
+
+// MarkUsed sets the time the binary was last used at to now. Using a binary
+// doesn't change it, so neither updated_at nor the change log are touched.
+func (s *binaryStorage) MarkUsed(ctx context.Context, user, id string) (time.Time, error) {
+	query := `UPDATE binaries SET last_used_at = $1 WHERE owner = $2 AND uuid = $3 AND deleted_at IS NULL`
+
+	now := time.Now()
+	tag, err := s.conn.Exec(ctx, query, now, user, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return time.Time{}, ErrNotFound
+	}
+
+	return now, nil
 }
 
-func (s *binaryStorage) Update(user string, id uint32, binary *pb.Binary) error {
-	query := `UPDATE binaries SET title = $1, file = $2 WHERE owner = $3 AND id = $4`
+// GetByIDs returns binaries with the given ids which aren't in trash.
+func (s *binaryStorage) GetByIDs(ctx context.Context, user string, ids []string) (binaries []*pb.Binary, err error) {
+	query := `SELECT ` + binaryColumns + ` FROM binaries WHERE owner = $1 AND uuid = ANY($2) AND deleted_at IS NULL`
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	rows, err := s.conn.Query(ctx, query, user, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		binary, err := scanBinary(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		binaries = append(binaries, binary)
+	}
+
+	return binaries, rows.Err()
+}
+
+// Update replaces the binary. When base is set, it fails with ErrChanged unless
+// the binary was last updated at base, so that concurrent updates don't
+// silently overwrite each other.
+func (s *binaryStorage) Update(ctx context.Context, user, id string, binary *pb.Binary, base *time.Time) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT id, title, file, metadata, tags, size, updated_at FROM binaries WHERE owner = $1 AND uuid = $2 AND deleted_at IS NULL FOR UPDATE`
+
+	previous := &pb.Binary{}
+	var internalID uint32
+	var previousMetadata []byte
+	var previousSize int64
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx, query, user, id).Scan(&internalID, &previous.Title, &previous.File, &previousMetadata, &previous.Tags, &previousSize, &updatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if base != nil && !updatedAt.Equal(*base) {
+		return ErrChanged
+	}
+
+	previous.Metadata, err = unmarshalMetadata(previousMetadata)
+	if err != nil {
+		return err
+	}
+
+	historyBytes, err := writeHistory(ctx, tx, user, pb.ItemType_ITEM_TYPE_BINARY, internalID, previous)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := marshalMetadata(binary.Metadata)
+	if err != nil {
+		return err
+	}
+
+	size := itemSize(binary)
+	query = `UPDATE binaries SET title = $1, file = $2, metadata = $3, tags = $4, updated_at = $5, size = $6 WHERE id = $7`
+
+	_, err = tx.Exec(
+		ctx,
 		query,
 		binary.Title,
 		binary.File,
+		metadata,
+		nonNilTags(binary.Tags),
+		time.Now(),
+		size,
+		internalID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_BINARY, 0, size-previousSize, historyBytes)
+	if err != nil {
+		return err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_BINARY, id, pb.Operation_OPERATION_UPDATE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *binaryStorage) Delete(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE binaries SET deleted_at = $1 WHERE owner = $2 AND uuid = $3 AND deleted_at IS NULL`
+
+	tag, err := tx.Exec(
+		ctx,
+		query,
+		time.Now(),
+		user,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_BINARY, id, pb.Operation_OPERATION_DELETE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *binaryStorage) Move(ctx context.Context, user, id string, folderID uint32) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE binaries SET folder_id = $1, updated_at = $2 WHERE owner = $3 AND uuid = $4 AND deleted_at IS NULL`
+
+	tag, err := tx.Exec(
+		ctx,
+		query,
+		nullableID(folderID),
+		time.Now(),
 		user,
 		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
 
-	return err
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_BINARY, id, pb.Operation_OPERATION_UPDATE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *binaryStorage) Delete(user string, id uint32) error {
-	query := `DELETE FROM binaries WHERE owner = $1 AND id = $2`
+func (s *binaryStorage) Trash(ctx context.Context, user string) (items []*pb.TrashItem, err error) {
+	query := `SELECT uuid, title, deleted_at FROM binaries WHERE owner = $1 AND deleted_at IS NOT NULL`
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	rows, err := s.conn.Query(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &pb.TrashItem{Type: pb.ItemType_ITEM_TYPE_BINARY}
+		var deletedAt time.Time
+		err := rows.Scan(&item.Id, &item.Title, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		item.DeletedAt = timestamppb.New(deletedAt)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (s *binaryStorage) Restore(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE binaries SET deleted_at = NULL WHERE owner = $1 AND uuid = $2 AND deleted_at IS NOT NULL`
+
+	tag, err := tx.Exec(
+		ctx,
 		query,
 		user,
 		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_BINARY, id, pb.Operation_OPERATION_RESTORE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *binaryStorage) Purge(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM binaries WHERE owner = $1 AND uuid = $2 AND deleted_at IS NOT NULL RETURNING id, size`
+
+	var internalID uint32
+	var size int64
+	err = tx.QueryRow(ctx, query, user, id).Scan(&internalID, &size)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	freed, err := purgeHistory(ctx, tx, pb.ItemType_ITEM_TYPE_BINARY, []uint32{internalID})
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_BINARY, -1, -size, -freed[internalID])
+	if err != nil {
+		return err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_BINARY, id, pb.Operation_OPERATION_PURGE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *binaryStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM binaries WHERE deleted_at IS NOT NULL AND deleted_at < $1 RETURNING id, uuid, owner, size`
+
+	rows, err := tx.Query(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := pgx.CollectRows(rows, pgx.RowToStructByPos[purgedItem])
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]uint32, 0, len(purged))
+	for _, item := range purged {
+		ids = append(ids, item.ID)
+	}
+
+	freed, err := purgeHistory(ctx, tx, pb.ItemType_ITEM_TYPE_BINARY, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range purged {
+		err = recordUsage(ctx, tx, s.defaultQuota, item.Owner, pb.ItemType_ITEM_TYPE_BINARY, -1, -item.Size, -freed[item.ID])
+		if err != nil {
+			return 0, err
+		}
+
+		err = recordChange(ctx, tx, item.Owner, pb.ItemType_ITEM_TYPE_BINARY, item.UUID, pb.Operation_OPERATION_PURGE)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
+
+func scanBinary(row pgx.Row) (*pb.Binary, error) {
+	binary := &pb.Binary{}
+	var metadata []byte
+	var createdAt, updatedAt time.Time
+	var lastUsedAt *time.Time
+	err := row.Scan(&binary.Id, &binary.Title, &binary.File, &metadata, &binary.FolderId, &binary.Tags, &createdAt, &updatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	binary.Metadata, err = unmarshalMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	binary.CreatedAt = timestamppb.New(createdAt)
+	binary.UpdatedAt = timestamppb.New(updatedAt)
+	binary.LastUsedAt = nullableTimestamp(lastUsedAt)
 
-	return err
+	return binary, nil
 }
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	pb "praktikum-gophkeeper/proto"
+	"time"
+)
+
+type changeStorage struct {
+	conn *pgxpool.Pool
+}
+
+func NewChangeStorage(conn *pgxpool.Pool) (*changeStorage, error) {
+	s := &changeStorage{
+		conn: conn,
+	}
+
+	err := s.ensureTableExist()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+const (
+	changeTable = `CREATE TABLE IF NOT EXISTS change_sequences (
+    owner VARCHAR(100) PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    FOREIGN KEY (owner) REFERENCES users (login)
+);
+CREATE TABLE IF NOT EXISTS changes (
+    owner VARCHAR(100) NOT NULL,
+    seq BIGINT NOT NULL,
+    item_type INTEGER NOT NULL,
+    item_id UUID NOT NULL,
+    operation INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (owner, seq),
+    FOREIGN KEY (owner) REFERENCES users (login)
+);`
+)
+
+// changeChannel is the notification channel every recorded change is published to,
+// so that all server replicas learn about changes made through any of them.
+const changeChannel = "gophkeeper_changes"
+
+type changeNotification struct {
+	Owner     string       `json:"owner"`
+	Seq       int64        `json:"seq"`
+	Type      pb.ItemType  `json:"type"`
+	ID        string       `json:"id"`
+	Operation pb.Operation `json:"operation"`
+}
+
+func (s *changeStorage) ensureTableExist() error {
+	_, err := s.conn.Exec(context.Background(), changeTable)
+	return err
+}
+
+// Last returns the sequence number of the latest change of the user.
+func (s *changeStorage) Last(ctx context.Context, user string) (int64, error) {
+	query := `SELECT COALESCE((SELECT seq FROM change_sequences WHERE owner = $1), 0)`
+
+	var seq int64
+	err := s.conn.QueryRow(ctx, query, user).Scan(&seq)
+
+	return seq, err
+}
+
+// Since returns the latest change of every item changed after seq, ordered by sequence number.
+// At most limit changes are returned, the last one gives the sequence number to continue from.
+func (s *changeStorage) Since(ctx context.Context, user string, seq int64, limit uint32) (changes []*pb.Change, err error) {
+	query := `SELECT seq, item_type, item_id, operation FROM (
+    SELECT DISTINCT ON (item_type, item_id) seq, item_type, item_id, operation FROM changes
+    WHERE owner = $1 AND seq > $2 ORDER BY item_type, item_id, seq DESC
+) latest ORDER BY seq LIMIT $3`
+
+	rows, err := s.conn.Query(
+		ctx,
+		query,
+		user,
+		seq,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		change := &pb.Change{}
+		err := rows.Scan(&change.Seq, &change.Type, &change.Id, &change.Operation)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// recordChange assigns the next sequence number of the user to a change of an item.
+// It must be called in the same transaction as the change itself.
+func recordChange(ctx context.Context, tx pgx.Tx, user string, itemType pb.ItemType, id string, operation pb.Operation) error {
+	query := `INSERT INTO change_sequences(owner, seq) VALUES($1, 1)
+ON CONFLICT (owner) DO UPDATE SET seq = change_sequences.seq + 1 RETURNING seq`
+
+	var seq int64
+	err := tx.QueryRow(ctx, query, user).Scan(&seq)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO changes(owner, seq, item_type, item_id, operation, created_at) VALUES($1, $2, $3, $4, $5, $6)`
+
+	_, err = tx.Exec(
+		ctx,
+		query,
+		user,
+		seq,
+		itemType,
+		id,
+		operation,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(changeNotification{
+		Owner:     user,
+		Seq:       seq,
+		Type:      itemType,
+		ID:        id,
+		Operation: operation,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Notifications are delivered only when the transaction commits.
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, changeChannel, string(payload))
+
+	return err
+}
+
+// ListenChanges passes changes recorded by any server to publish until ctx is done or the connection fails.
+// It needs a dedicated connection which isn't used for anything else.
+func ListenChanges(ctx context.Context, conn *pgx.Conn, publish func(user string, change *pb.Change)) error {
+	_, err := conn.Exec(ctx, "LISTEN "+changeChannel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var n changeNotification
+		err = json.Unmarshal([]byte(notification.Payload), &n)
+		if err != nil {
+			return err
+		}
+
+		publish(n.Owner, &pb.Change{
+			Seq:       n.Seq,
+			Type:      n.Type,
+			Id:        n.ID,
+			Operation: n.Operation,
+		})
+	}
+}
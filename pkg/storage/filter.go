@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	pb "praktikum-gophkeeper/proto"
+	"strings"
+)
+
+// conditions collects the WHERE conditions of a query together with their positional arguments.
+type conditions struct {
+	clauses []string
+	args    []any
+}
+
+// add appends a condition; every "?" in it is replaced by the placeholder of the next argument.
+func (c *conditions) add(clause string, args ...any) {
+	for _, arg := range args {
+		c.args = append(c.args, arg)
+		clause = strings.Replace(clause, "?", fmt.Sprintf("$%d", len(c.args)), 1)
+	}
+
+	c.clauses = append(c.clauses, clause)
+}
+
+// addFilter appends the conditions of a client provided filter.
+func (c *conditions) addFilter(filter *pb.Filter) {
+	if filter.GetFolderId() != 0 {
+		c.add("folder_id = ?", filter.GetFolderId())
+	}
+	if filter.GetRootOnly() {
+		c.add("folder_id IS NULL")
+	}
+	if len(filter.GetTags()) != 0 {
+		c.add("tags @> ?::text[]", filter.GetTags())
+	}
+	if len(filter.GetIds()) != 0 {
+		c.add("uuid = ANY(?::uuid[])", filter.GetIds())
+	}
+	for _, m := range filter.GetMetadata() {
+		if m.Value == "" {
+			c.add(`metadata @> jsonb_build_array(jsonb_build_object('key', ?::text))`, m.Key)
+		} else {
+			c.add(`metadata @> jsonb_build_array(jsonb_build_object('key', ?::text, 'value', ?::text))`, m.Key, m.Value)
+		}
+	}
+}
+
+// arg adds an argument used outside of the conditions and returns its placeholder.
+func (c *conditions) arg(value any) string {
+	c.args = append(c.args, value)
+	return fmt.Sprintf("$%d", len(c.args))
+}
+
+func (c *conditions) where() string {
+	return strings.Join(c.clauses, " AND ")
+}
+
+type metadataEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func marshalMetadata(metadata []*pb.Metadata) (string, error) {
+	entries := make([]metadataEntry, 0, len(metadata))
+	for _, m := range metadata {
+		entries = append(entries, metadataEntry{Key: m.Key, Value: m.Value})
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func unmarshalMetadata(data []byte) ([]*pb.Metadata, error) {
+	var entries []metadataEntry
+	err := json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata []*pb.Metadata
+	for _, e := range entries {
+		metadata = append(metadata, &pb.Metadata{Key: e.Key, Value: e.Value})
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/require"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+func TestConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		title     string
+		filter    *pb.Filter
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "owner only",
+			wantWhere: "owner = $1 AND deleted_at IS NULL",
+			wantArgs:  []any{"user"},
+		},
+		{
+			name:      "title",
+			title:     "mail",
+			wantWhere: "owner = $1 AND deleted_at IS NULL AND title = $2",
+			wantArgs:  []any{"user", "mail"},
+		},
+		{
+			name:  "metadata",
+			title: "mail",
+			filter: &pb.Filter{Metadata: []*pb.Metadata{
+				{Key: "bank"},
+				{Key: "project", Value: "X"},
+			}},
+			wantWhere: "owner = $1 AND deleted_at IS NULL AND title = $2" +
+				" AND metadata @> jsonb_build_array(jsonb_build_object('key', $3::text))" +
+				" AND metadata @> jsonb_build_array(jsonb_build_object('key', $4::text, 'value', $5::text))",
+			wantArgs: []any{"user", "mail", "bank", "project", "X"},
+		},
+		{
+			name: "folder and tags",
+			filter: &pb.Filter{
+				FolderId: 7,
+				Tags:     []string{"work", "vpn"},
+			},
+			wantWhere: "owner = $1 AND deleted_at IS NULL AND folder_id = $2 AND tags @> $3::text[]",
+			wantArgs:  []any{"user", uint32(7), []string{"work", "vpn"}},
+		},
+		{
+			name:      "root only",
+			filter:    &pb.Filter{RootOnly: true},
+			wantWhere: "owner = $1 AND deleted_at IS NULL AND folder_id IS NULL",
+			wantArgs:  []any{"user"},
+		},
+		{
+			name:      "ids",
+			filter:    &pb.Filter{Ids: []string{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}},
+			wantWhere: "owner = $1 AND deleted_at IS NULL AND uuid = ANY($2::uuid[])",
+			wantArgs:  []any{"user", []string{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where := &conditions{}
+			where.add("owner = ?", "user")
+			where.add("deleted_at IS NULL")
+			if tt.title != "" {
+				where.add("title = ?", tt.title)
+			}
+			where.addFilter(tt.filter)
+
+			require.Equal(t, tt.wantWhere, where.where())
+			require.Equal(t, tt.wantArgs, where.args)
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	metadata := []*pb.Metadata{
+		{Key: "bank", Value: "Gophbank"},
+		{Key: "recovery email"},
+	}
+
+	data, err := marshalMetadata(metadata)
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"key":"bank","value":"Gophbank"},{"key":"recovery email","value":""}]`, data)
+
+	actual, err := unmarshalMetadata([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, actual, len(metadata))
+	for i := range metadata {
+		require.Equal(t, metadata[i].Key, actual[i].Key)
+		require.Equal(t, metadata[i].Value, actual[i].Value)
+	}
+
+	data, err = marshalMetadata(nil)
+	require.NoError(t, err)
+	require.Equal(t, "[]", data)
+}
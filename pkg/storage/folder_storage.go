@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	pb "praktikum-gophkeeper/proto"
+	"slices"
+	"time"
+)
+
+type folderStorage struct {
+	conn *pgxpool.Pool
+}
+
+func NewFolderStorage(conn *pgxpool.Pool) (*folderStorage, error) {
+	s := &folderStorage{
+		conn: conn,
+	}
+
+	err := s.ensureTableExist()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+const (
+	folderTable = `CREATE TABLE IF NOT EXISTS folders (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    parent_id INTEGER REFERENCES folders (id),
+    owner VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (owner) REFERENCES users (login)
+);`
+)
+
+func (s *folderStorage) ensureTableExist() error {
+	_, err := s.conn.Exec(context.Background(), folderTable)
+	return err
+}
+
+func (s *folderStorage) Create(ctx context.Context, user, name string, parentID uint32) (*pb.Folder, error) {
+	query := `INSERT INTO folders(name, parent_id, owner, created_at) VALUES($1, $2, $3, $4) RETURNING id`
+
+	folder := &pb.Folder{Name: name, ParentId: parentID}
+	err := s.conn.QueryRow(
+		ctx,
+		query,
+		name,
+		nullableID(parentID),
+		user,
+		time.Now(),
+	).Scan(&folder.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+func (s *folderStorage) Get(ctx context.Context, user string, id uint32) (*pb.Folder, error) {
+	query := `SELECT id, name, COALESCE(parent_id, 0) FROM folders WHERE owner = $1 AND id = $2`
+
+	folder := &pb.Folder{}
+	err := s.conn.QueryRow(ctx, query, user, id).Scan(&folder.Id, &folder.Name, &folder.ParentId)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return folder, nil
+}
+
+func (s *folderStorage) List(ctx context.Context, user string) (folders []*pb.Folder, err error) {
+	query := `SELECT id, name, COALESCE(parent_id, 0) FROM folders WHERE owner = $1 ORDER BY id`
+
+	rows, err := s.conn.Query(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		folder := &pb.Folder{}
+		err := rows.Scan(&folder.Id, &folder.Name, &folder.ParentId)
+		if err != nil {
+			return nil, err
+		}
+
+		folders = append(folders, folder)
+	}
+
+	return folders, rows.Err()
+}
+
+func (s *folderStorage) Rename(ctx context.Context, user string, id uint32, name string) error {
+	query := `UPDATE folders SET name = $1 WHERE owner = $2 AND id = $3`
+
+	tag, err := s.conn.Exec(
+		ctx,
+		query,
+		name,
+		user,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Move makes a folder a subfolder of the parent one, or a top level folder
+// when parentID is zero. It fails with ErrFolderCycle when the parent is the
+// folder itself or one of its subfolders.
+func (s *folderStorage) Move(ctx context.Context, user string, id, parentID uint32) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Folders of the user are locked, so that concurrent moves can't make a
+	// cycle either.
+	query := `SELECT id FROM folders WHERE owner = $1 ORDER BY id FOR UPDATE`
+
+	rows, err := tx.Query(ctx, query, user)
+	if err != nil {
+		return err
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uint32])
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(ids, id) || parentID != 0 && !slices.Contains(ids, parentID) {
+		return ErrNotFound
+	}
+
+	if parentID != 0 {
+		query = `WITH RECURSIVE subfolders(id) AS (
+    SELECT id FROM folders WHERE id = $1
+    UNION
+    SELECT f.id FROM folders f JOIN subfolders s ON f.parent_id = s.id
+)
+SELECT EXISTS (SELECT 1 FROM subfolders WHERE id = $2)`
+
+		var cycle bool
+		err = tx.QueryRow(ctx, query, id, parentID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+
+		if cycle {
+			return ErrFolderCycle
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE folders SET parent_id = $1 WHERE id = $2`, nullableID(parentID), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Delete removes a folder. Subfolders and items of a non-empty folder are moved to the root
+// when moveToRoot is set, otherwise ErrFolderNotEmpty is returned.
+// Trashed items never keep a folder from being deleted and always end up in the root.
+func (s *folderStorage) Delete(ctx context.Context, user string, id uint32, moveToRoot bool) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT id FROM folders WHERE owner = $1 AND id = $2 FOR UPDATE`
+
+	err = tx.QueryRow(ctx, query, user, id).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if !moveToRoot {
+		query = `SELECT EXISTS (SELECT 1 FROM folders WHERE parent_id = $1)`
+		for _, table := range itemTables {
+			query += fmt.Sprintf(` OR EXISTS (SELECT 1 FROM %s WHERE folder_id = $1 AND deleted_at IS NULL)`, table)
+		}
+
+		var notEmpty bool
+		err = tx.QueryRow(ctx, query, id).Scan(&notEmpty)
+		if err != nil {
+			return err
+		}
+
+		if notEmpty {
+			return ErrFolderNotEmpty
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE folders SET parent_id = NULL WHERE parent_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	for itemType, table := range itemTables {
+		query = fmt.Sprintf(`UPDATE %s SET folder_id = NULL, updated_at = $1 WHERE folder_id = $2 RETURNING uuid`, table)
+
+		rows, err := tx.Query(ctx, query, time.Now(), id)
+		if err != nil {
+			return err
+		}
+
+		moved, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+
+		for _, itemID := range moved {
+			err = recordChange(ctx, tx, user, itemType, itemID, pb.Operation_OPERATION_UPDATE)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM folders WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	pb "praktikum-gophkeeper/proto"
+	"time"
+)
+
+// DefaultHistoryDepth is the number of previous versions kept for an item
+// unless the owner has chosen another depth for the item type.
+const DefaultHistoryDepth = 10
+
+type historyStorage struct {
+	conn         *pgxpool.Pool
+	defaultQuota *DefaultQuota
+}
+
+func NewHistoryStorage(conn *pgxpool.Pool, defaultQuota *DefaultQuota) (*historyStorage, error) {
+	s := &historyStorage{
+		conn:         conn,
+		defaultQuota: defaultQuota,
+	}
+
+	err := s.ensureTableExist()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+const (
+	historyTable = `CREATE TABLE IF NOT EXISTS item_history (
+    id SERIAL PRIMARY KEY,
+    item_type INTEGER NOT NULL,
+    item_id INTEGER NOT NULL,
+    owner VARCHAR(100) NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    size BIGINT NOT NULL,
+    FOREIGN KEY (owner) REFERENCES users (login)
+);
+ALTER TABLE item_history ADD COLUMN IF NOT EXISTS size BIGINT;
+UPDATE item_history SET size = octet_length(data::text) WHERE size IS NULL;
+ALTER TABLE item_history ALTER COLUMN size SET NOT NULL;
+CREATE INDEX IF NOT EXISTS item_history_item_idx ON item_history (owner, item_type, item_id);
+CREATE TABLE IF NOT EXISTS history_depths (
+    owner VARCHAR(100) NOT NULL,
+    item_type INTEGER NOT NULL,
+    depth INTEGER NOT NULL,
+    PRIMARY KEY (owner, item_type),
+    FOREIGN KEY (owner) REFERENCES users (login)
+);`
+)
+
+func (s *historyStorage) ensureTableExist() error {
+	_, err := s.conn.Exec(context.Background(), historyTable)
+	return err
+}
+
+// Get returns the stored versions of an item, newest first.
+func (s *historyStorage) Get(ctx context.Context, user string, itemType pb.ItemType, id string) (entries []*pb.HistoryEntry, err error) {
+	query := fmt.Sprintf(`SELECT h.id, h.data, h.created_at FROM item_history h JOIN %s i ON i.id = h.item_id
+WHERE h.owner = $1 AND h.item_type = $2 AND i.uuid = $3 ORDER BY h.id DESC`, itemTables[itemType])
+
+	rows, err := s.conn.Query(
+		ctx,
+		query,
+		user,
+		itemType,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := &pb.HistoryEntry{}
+		var data []byte
+		var createdAt time.Time
+		err := rows.Scan(&entry.Version, &data, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		err = unmarshalHistoryEntry(entry, itemType, data)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.CreatedAt = timestamppb.New(createdAt)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetVersion returns a single stored version of an item.
+func (s *historyStorage) GetVersion(ctx context.Context, user string, itemType pb.ItemType, id string, version uint32) (*pb.HistoryEntry, error) {
+	query := fmt.Sprintf(`SELECT h.data, h.created_at FROM item_history h JOIN %s i ON i.id = h.item_id
+WHERE h.owner = $1 AND h.item_type = $2 AND i.uuid = $3 AND h.id = $4`, itemTables[itemType])
+
+	entry := &pb.HistoryEntry{Version: version}
+	var data []byte
+	var createdAt time.Time
+	err := s.conn.QueryRow(
+		ctx,
+		query,
+		user,
+		itemType,
+		id,
+		version,
+	).Scan(&data, &createdAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = unmarshalHistoryEntry(entry, itemType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.CreatedAt = timestamppb.New(createdAt)
+
+	return entry, nil
+}
+
+// SetDepth sets how many previous versions are kept for the user's items of
+// the given type. Versions beyond a lowered depth are dropped at once.
+func (s *historyStorage) SetDepth(ctx context.Context, user string, itemType pb.ItemType, depth uint32) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO history_depths(owner, item_type, depth) VALUES($1, $2, $3)
+ON CONFLICT (owner, item_type) DO UPDATE SET depth = EXCLUDED.depth`
+
+	_, err = tx.Exec(
+		ctx,
+		query,
+		user,
+		itemType,
+		depth,
+	)
+	if err != nil {
+		return err
+	}
+
+	query = `DELETE FROM item_history WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY item_id ORDER BY id DESC) AS n
+        FROM item_history WHERE owner = $1 AND item_type = $2
+    ) versions WHERE n > $3
+) RETURNING size`
+
+	freed, err := sumSizes(tx.Query(ctx, query, user, itemType, depth))
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, itemType, 0, 0, -freed)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func unmarshalHistoryEntry(entry *pb.HistoryEntry, itemType pb.ItemType, data []byte) error {
+	switch itemType {
+	case pb.ItemType_ITEM_TYPE_PASSWORD:
+		item := &pb.Password{}
+		entry.Item = &pb.HistoryEntry_Password{Password: item}
+		return protojson.Unmarshal(data, item)
+	case pb.ItemType_ITEM_TYPE_TEXT:
+		item := &pb.Text{}
+		entry.Item = &pb.HistoryEntry_Text{Text: item}
+		return protojson.Unmarshal(data, item)
+	case pb.ItemType_ITEM_TYPE_BINARY:
+		item := &pb.Binary{}
+		entry.Item = &pb.HistoryEntry_Binary{Binary: item}
+		return protojson.Unmarshal(data, item)
+	case pb.ItemType_ITEM_TYPE_PAYMENT:
+		item := &pb.Payment{}
+		entry.Item = &pb.HistoryEntry_Payment{Payment: item}
+		return protojson.Unmarshal(data, item)
+	}
+
+	return ErrNotFound
+}
+
+// writeHistory stores the previous version of an item and drops versions beyond the owner's history depth.
+// It returns how many bytes the history of the item has grown by, negative when it has shrunk.
+// It must be called in the same transaction as the update that replaces the item.
+func writeHistory(ctx context.Context, tx pgx.Tx, user string, itemType pb.ItemType, id uint32, previous proto.Message) (int64, error) {
+	data, err := protojson.Marshal(previous)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO item_history(item_type, item_id, owner, data, created_at, size) VALUES($1, $2, $3, $4, $5, $6)`
+
+	_, err = tx.Exec(
+		ctx,
+		query,
+		itemType,
+		id,
+		user,
+		string(data),
+		time.Now(),
+		len(data),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `DELETE FROM item_history WHERE owner = $1 AND item_type = $2 AND item_id = $3 AND id NOT IN (
+    SELECT id FROM item_history WHERE owner = $1 AND item_type = $2 AND item_id = $3 ORDER BY id DESC
+    LIMIT COALESCE((SELECT depth FROM history_depths WHERE owner = $1 AND item_type = $2), $4)
+) RETURNING size`
+
+	freed, err := sumSizes(tx.Query(
+		ctx,
+		query,
+		user,
+		itemType,
+		id,
+		DefaultHistoryDepth,
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(data)) - freed, nil
+}
+
+// purgeHistory drops all stored versions of permanently deleted items and
+// returns the bytes they took by item.
+func purgeHistory(ctx context.Context, tx pgx.Tx, itemType pb.ItemType, ids []uint32) (map[uint32]int64, error) {
+	query := `DELETE FROM item_history WHERE item_type = $1 AND item_id = ANY($2) RETURNING item_id, size`
+
+	rows, err := tx.Query(ctx, query, itemType, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	freed := map[uint32]int64{}
+	for rows.Next() {
+		var id uint32
+		var size int64
+		err := rows.Scan(&id, &size)
+		if err != nil {
+			return nil, err
+		}
+		freed[id] += size
+	}
+
+	return freed, rows.Err()
+}
+
+// sumSizes adds up the sizes the rows return.
+func sumSizes(rows pgx.Rows, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	sizes, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, err
+	}
+
+	var sum int64
+	for _, size := range sizes {
+		sum += size
+	}
+
+	return sum, nil
+}
@@ -2,18 +2,23 @@ package storage
 
 import (
 	"context"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	pb "praktikum-gophkeeper/proto"
 	"time"
 )
 
 type passwordStorage struct {
-	conn *pgx.Conn
+	conn         *pgxpool.Pool
+	defaultQuota *DefaultQuota
 }
 
-func NewPasswordStorage(conn *pgx.Conn) (*passwordStorage, error) {
+func NewPasswordStorage(conn *pgxpool.Pool, defaultQuota *DefaultQuota) (*passwordStorage, error) {
 	s := &passwordStorage{
-		conn: conn,
+		conn:         conn,
+		defaultQuota: defaultQuota,
 	}
 
 	err := s.ensureTableExist()
@@ -27,85 +32,485 @@ func NewPasswordStorage(conn *pgx.Conn) (*passwordStorage, error) {
 const (
 	passwordTable = `CREATE TABLE IF NOT EXISTS passwords (
     id SERIAL PRIMARY KEY,
+    uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
     website VARCHAR(100),
     login VARCHAR(100) NOT NULL,
     password VARCHAR(100) NOT NULL,
     owner VARCHAR(100) NOT NULL,
     created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    deleted_at TIMESTAMP,
+    metadata JSONB NOT NULL DEFAULT '[]',
+    folder_id INTEGER REFERENCES folders (id),
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    size BIGINT NOT NULL,
     FOREIGN KEY (owner) REFERENCES users (login)
-);`
+);
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES folders (id);
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid();
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+UPDATE passwords SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE passwords ALTER COLUMN updated_at SET NOT NULL;
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS size BIGINT;`
+
+	passwordColumns = `uuid, COALESCE(website, ''), login, password, metadata, COALESCE(folder_id, 0), tags, created_at, updated_at, last_used_at`
 )
 
 func (s *passwordStorage) ensureTableExist() error {
-	_, err := s.conn.Exec(context.Background(), passwordTable)
+	ctx := context.Background()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, passwordTable)
+	if err != nil {
+		return err
+	}
 
-	return err
+	err = backfillSizes(ctx, tx, "passwords", passwordColumns, scanPassword)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *passwordStorage) Add(user string, password *pb.Password) error {
-	query := `INSERT INTO passwords(website, login, password, owner, created_at) VALUES ($1, $2, $3, $4, $5)`
+// Add stores a new password under the client provided id or a generated one and returns the stored password.
+func (s *passwordStorage) Add(ctx context.Context, user string, password *pb.Password) (*pb.Password, error) {
+	metadata, err := marshalMetadata(password.Metadata)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	id := password.Id
+	if id == "" {
+		id = uuid.NewString()
+	}
+	size := itemSize(password)
+
+	query := `INSERT INTO passwords(uuid, website, login, password, metadata, folder_id, tags, owner, created_at, updated_at, size)
+VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING ` + passwordColumns
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	row := tx.QueryRow(
+		ctx,
 		query,
+		id,
 		password.Website,
 		password.Login,
 		password.Password,
+		metadata,
+		nullableID(password.FolderId),
+		nonNilTags(password.Tags),
 		user,
-		time.Now(),
+		now,
+		now,
+		size,
 	)
 
-	return err
+	stored, err := scanPassword(row)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_PASSWORD, 1, size, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PASSWORD, stored.Id, pb.Operation_OPERATION_CREATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, tx.Commit(ctx)
 }
 
-func (s *passwordStorage) Get(user, website string) (passwords []*pb.Password, ids []uint32, err error) {
-	query := `SELECT website, login, password, id FROM passwords WHERE owner = $1 AND website = $2`
+// Get returns passwords matching website and filter. Every password is matched when website is empty,
+// otherwise the returned passwords are considered used and get their last usage time updated.
+func (s *passwordStorage) Get(ctx context.Context, user, website string, filter *pb.Filter) (passwords []*pb.Password, err error) {
+	where := &conditions{}
+	where.add("owner = ?", user)
+	where.add("deleted_at IS NULL")
+	if website != "" {
+		where.add("website = ?", website)
+	}
+	where.addFilter(filter)
+
+	query := `SELECT ` + passwordColumns + ` FROM passwords WHERE ` + where.where()
 
-	rows, err := s.conn.Query(context.Background(), query, user, website)
+	rows, err := s.conn.Query(ctx, query, where.args...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		pass := &pb.Password{}
-		var id uint32
-		err := rows.Scan(&pass.Website, &pass.Login, &pass.Password, &id)
+		pass, err := scanPassword(rows)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		passwords = append(passwords, pass)
-		ids = append(ids, id)
 	}
 
-	return passwords, ids, nil
+	return passwords, rows.Err()
 }
 
-func (s *passwordStorage) Update(user string, id int32, password *pb.Password) error {
-	query := `UPDATE passwords SET website = $1, login = $2, password = $3 WHERE id = $4 AND owner = $5`
+// MarkUsed sets the time the password was last used at to now. Using a password
+// doesn't change it, so neither updated_at nor the change log are touched.
+func (s *passwordStorage) MarkUsed(ctx context.Context, user, id string) (time.Time, error) {
+	query := `UPDATE passwords SET last_used_at = $1 WHERE owner = $2 AND uuid = $3 AND deleted_at IS NULL`
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	now := time.Now()
+	tag, err := s.conn.Exec(ctx, query, now, user, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return time.Time{}, ErrNotFound
+	}
+
+	return now, nil
+}
+
+// GetByIDs returns passwords with the given ids which aren't in trash.
+func (s *passwordStorage) GetByIDs(ctx context.Context, user string, ids []string) (passwords []*pb.Password, err error) {
+	query := `SELECT ` + passwordColumns + ` FROM passwords WHERE owner = $1 AND uuid = ANY($2) AND deleted_at IS NULL`
+
+	rows, err := s.conn.Query(ctx, query, user, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		pass, err := scanPassword(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		passwords = append(passwords, pass)
+	}
+
+	return passwords, rows.Err()
+}
+
+// Update replaces the password. When base is set, it fails with ErrChanged unless
+// the password was last updated at base, so that concurrent updates don't
+// silently overwrite each other.
+func (s *passwordStorage) Update(ctx context.Context, user, id string, password *pb.Password, base *time.Time) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT id, COALESCE(website, ''), login, password, metadata, tags, size, updated_at FROM passwords WHERE owner = $1 AND uuid = $2 AND deleted_at IS NULL FOR UPDATE`
+
+	previous := &pb.Password{}
+	var internalID uint32
+	var previousMetadata []byte
+	var previousSize int64
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx, query, user, id).Scan(&internalID, &previous.Website, &previous.Login, &previous.Password, &previousMetadata, &previous.Tags, &previousSize, &updatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if base != nil && !updatedAt.Equal(*base) {
+		return ErrChanged
+	}
+
+	previous.Metadata, err = unmarshalMetadata(previousMetadata)
+	if err != nil {
+		return err
+	}
+
+	historyBytes, err := writeHistory(ctx, tx, user, pb.ItemType_ITEM_TYPE_PASSWORD, internalID, previous)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := marshalMetadata(password.Metadata)
+	if err != nil {
+		return err
+	}
+
+	size := itemSize(password)
+	query = `UPDATE passwords SET website = $1, login = $2, password = $3, metadata = $4, tags = $5, updated_at = $6, size = $7 WHERE id = $8`
+
+	_, err = tx.Exec(
+		ctx,
 		query,
 		password.Website,
 		password.Login,
 		password.Password,
+		metadata,
+		nonNilTags(password.Tags),
+		time.Now(),
+		size,
+		internalID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_PASSWORD, 0, size-previousSize, historyBytes)
+	if err != nil {
+		return err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PASSWORD, id, pb.Operation_OPERATION_UPDATE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *passwordStorage) Delete(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE passwords SET deleted_at = $1 WHERE owner = $2 AND uuid = $3 AND deleted_at IS NULL`
+
+	tag, err := tx.Exec(
+		ctx,
+		query,
+		time.Now(),
+		user,
 		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PASSWORD, id, pb.Operation_OPERATION_DELETE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *passwordStorage) Move(ctx context.Context, user, id string, folderID uint32) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE passwords SET folder_id = $1, updated_at = $2 WHERE owner = $3 AND uuid = $4 AND deleted_at IS NULL`
+
+	tag, err := tx.Exec(
+		ctx,
+		query,
+		nullableID(folderID),
+		time.Now(),
 		user,
+		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PASSWORD, id, pb.Operation_OPERATION_UPDATE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *passwordStorage) Trash(ctx context.Context, user string) (items []*pb.TrashItem, err error) {
+	query := `SELECT uuid, COALESCE(website, ''), deleted_at FROM passwords WHERE owner = $1 AND deleted_at IS NOT NULL`
+
+	rows, err := s.conn.Query(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &pb.TrashItem{Type: pb.ItemType_ITEM_TYPE_PASSWORD}
+		var deletedAt time.Time
+		err := rows.Scan(&item.Id, &item.Title, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
 
-	return err
+		item.DeletedAt = timestamppb.New(deletedAt)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
 }
 
-func (s *passwordStorage) Delete(user string, id int32) error {
-	query := `DELETE FROM passwords WHERE owner = $1 AND id = $2`
+func (s *passwordStorage) Restore(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE passwords SET deleted_at = NULL WHERE owner = $1 AND uuid = $2 AND deleted_at IS NOT NULL`
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	tag, err := tx.Exec(
+		ctx,
 		query,
 		user,
 		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PASSWORD, id, pb.Operation_OPERATION_RESTORE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *passwordStorage) Purge(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM passwords WHERE owner = $1 AND uuid = $2 AND deleted_at IS NOT NULL RETURNING id, size`
+
+	var internalID uint32
+	var size int64
+	err = tx.QueryRow(ctx, query, user, id).Scan(&internalID, &size)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	freed, err := purgeHistory(ctx, tx, pb.ItemType_ITEM_TYPE_PASSWORD, []uint32{internalID})
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_PASSWORD, -1, -size, -freed[internalID])
+	if err != nil {
+		return err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PASSWORD, id, pb.Operation_OPERATION_PURGE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *passwordStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM passwords WHERE deleted_at IS NOT NULL AND deleted_at < $1 RETURNING id, uuid, owner, size`
+
+	rows, err := tx.Query(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := pgx.CollectRows(rows, pgx.RowToStructByPos[purgedItem])
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]uint32, 0, len(purged))
+	for _, item := range purged {
+		ids = append(ids, item.ID)
+	}
+
+	freed, err := purgeHistory(ctx, tx, pb.ItemType_ITEM_TYPE_PASSWORD, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range purged {
+		err = recordUsage(ctx, tx, s.defaultQuota, item.Owner, pb.ItemType_ITEM_TYPE_PASSWORD, -1, -item.Size, -freed[item.ID])
+		if err != nil {
+			return 0, err
+		}
+
+		err = recordChange(ctx, tx, item.Owner, pb.ItemType_ITEM_TYPE_PASSWORD, item.UUID, pb.Operation_OPERATION_PURGE)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
+
+func scanPassword(row pgx.Row) (*pb.Password, error) {
+	pass := &pb.Password{}
+	var metadata []byte
+	var createdAt, updatedAt time.Time
+	var lastUsedAt *time.Time
+	err := row.Scan(&pass.Id, &pass.Website, &pass.Login, &pass.Password, &metadata, &pass.FolderId, &pass.Tags, &createdAt, &updatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	pass.Metadata, err = unmarshalMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	pass.CreatedAt = timestamppb.New(createdAt)
+	pass.UpdatedAt = timestamppb.New(updatedAt)
+	pass.LastUsedAt = nullableTimestamp(lastUsedAt)
 
-	return err
+	return pass, nil
 }
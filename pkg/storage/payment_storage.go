@@ -2,18 +2,23 @@ package storage
 
 import (
 	"context"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	pb "praktikum-gophkeeper/proto"
 	"time"
 )
 
 type paymentStorage struct {
-	conn *pgx.Conn
+	conn         *pgxpool.Pool
+	defaultQuota *DefaultQuota
 }
 
-func NewPaymentStorage(conn *pgx.Conn) (*paymentStorage, error) {
+func NewPaymentStorage(conn *pgxpool.Pool, defaultQuota *DefaultQuota) (*paymentStorage, error) {
 	s := &paymentStorage{
-		conn: conn,
+		conn:         conn,
+		defaultQuota: defaultQuota,
 	}
 
 	err := s.ensureTableExist()
@@ -27,6 +32,7 @@ func NewPaymentStorage(conn *pgx.Conn) (*paymentStorage, error) {
 const (
 	paymentTable = `CREATE TABLE IF NOT EXISTS payments (
     id SERIAL PRIMARY KEY,
+    uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
     name VARCHAR(100) NOT NULL,
     cardholder VARCHAR(100) NOT NULL,
     number VARCHAR(100) NOT NULL,
@@ -34,88 +40,483 @@ const (
     code VARCHAR(100) NOT NULL,
     owner VARCHAR(100) NOT NULL,
     created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    deleted_at TIMESTAMP,
+    metadata JSONB NOT NULL DEFAULT '[]',
+    folder_id INTEGER REFERENCES folders (id),
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    size BIGINT NOT NULL,
     FOREIGN KEY (owner) REFERENCES users (login)
-);`
+);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES folders (id);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid();
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+UPDATE payments SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE payments ALTER COLUMN updated_at SET NOT NULL;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS size BIGINT;`
+
+	paymentColumns = `uuid, name, cardholder, number, exp_date, code, metadata, COALESCE(folder_id, 0), tags, created_at, updated_at, last_used_at`
 )
 
 func (s *paymentStorage) ensureTableExist() error {
-	_, err := s.conn.Exec(context.Background(), paymentTable)
-	return err
+	ctx := context.Background()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, paymentTable)
+	if err != nil {
+		return err
+	}
+
+	err = backfillSizes(ctx, tx, "payments", paymentColumns, scanPayment)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *paymentStorage) Add(user string, payment *pb.Payment) error {
-	query := `INSERT INTO payments(name, cardholder, number, exp_date, code, owner, created_at) VALUES($1, $2, $3, $4, $5, $6, $7)`
+// Add stores a new payment under the client provided id or a generated one and returns the stored payment.
+func (s *paymentStorage) Add(ctx context.Context, user string, payment *pb.Payment) (*pb.Payment, error) {
+	metadata, err := marshalMetadata(payment.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	id := payment.Id
+	if id == "" {
+		id = uuid.NewString()
+	}
+	size := itemSize(payment)
+
+	query := `INSERT INTO payments(uuid, name, cardholder, number, exp_date, code, metadata, folder_id, tags, owner, created_at, updated_at, size)
+VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING ` + paymentColumns
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	row := tx.QueryRow(
+		ctx,
 		query,
+		id,
 		payment.Name,
 		payment.Cardholder,
 		payment.Number,
 		payment.ExpDate,
 		payment.Code,
+		metadata,
+		nullableID(payment.FolderId),
+		nonNilTags(payment.Tags),
 		user,
-		time.Now(),
+		now,
+		now,
+		size,
 	)
 
-	return err
+	stored, err := scanPayment(row)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_PAYMENT, 1, size, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PAYMENT, stored.Id, pb.Operation_OPERATION_CREATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, tx.Commit(ctx)
 }
 
-func (s *paymentStorage) Get(user, name string) (payments []*pb.Payment, ids []uint32, err error) {
-	query := `SELECT (name, cardholder, number, exp_date, code, id) FROM payments WHERE owner = $1 AND name = $2`
+// Get returns payments matching name and filter. Every payment is matched when name is empty,
+// otherwise the returned payments are considered used and get their last usage time updated.
+func (s *paymentStorage) Get(ctx context.Context, user, name string, filter *pb.Filter) (payments []*pb.Payment, err error) {
+	where := &conditions{}
+	where.add("owner = ?", user)
+	where.add("deleted_at IS NULL")
+	if name != "" {
+		where.add("name = ?", name)
+	}
+	where.addFilter(filter)
 
-	rows, err := s.conn.Query(
-		context.Background(),
-		query,
-		user,
-		name,
-	)
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE ` + where.where()
+
+	rows, err := s.conn.Query(ctx, query, where.args...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		payment := &pb.Payment{}
-		var id uint32
-		err := rows.Scan(&payment.Name, &payment.Cardholder, &payment.Number, &payment.ExpDate, &payment.Code, &id)
+		payment, err := scanPayment(rows)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		payments = append(payments, payment)
-		ids = append(ids, id)
 	}
 
-	return payments, ids, nil
+	return payments, rows.Err()
+}
+
+// MarkUsed sets the time the payment was last used at to now. Using a payment
+// doesn't change it, so neither updated_at nor the change log are touched.
+func (s *paymentStorage) MarkUsed(ctx context.Context, user, id string) (time.Time, error) {
+	query := `UPDATE payments SET last_used_at = $1 WHERE owner = $2 AND uuid = $3 AND deleted_at IS NULL`
+
+	now := time.Now()
+	tag, err := s.conn.Exec(ctx, query, now, user, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return time.Time{}, ErrNotFound
+	}
+
+	return now, nil
 }
 
-func (s *paymentStorage) Update(user string, id uint32, payment *pb.Payment) error {
-	query := `UPDATE payments SET name = $1, cardholder = $2, number = $3, exp_date = $4, code = $5 WHERE owner = $6 AND id = $7`
+// GetByIDs returns payments with the given ids which aren't in trash.
+func (s *paymentStorage) GetByIDs(ctx context.Context, user string, ids []string) (payments []*pb.Payment, err error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE owner = $1 AND uuid = ANY($2) AND deleted_at IS NULL`
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	rows, err := s.conn.Query(ctx, query, user, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, payment)
+	}
+
+	return payments, rows.Err()
+}
+
+// Update replaces the payment. When base is set, it fails with ErrChanged unless
+// the payment was last updated at base, so that concurrent updates don't
+// silently overwrite each other.
+func (s *paymentStorage) Update(ctx context.Context, user, id string, payment *pb.Payment, base *time.Time) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT id, name, cardholder, number, exp_date, code, metadata, tags, size, updated_at FROM payments WHERE owner = $1 AND uuid = $2 AND deleted_at IS NULL FOR UPDATE`
+
+	previous := &pb.Payment{}
+	var internalID uint32
+	var previousMetadata []byte
+	var previousSize int64
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx, query, user, id).Scan(&internalID, &previous.Name, &previous.Cardholder, &previous.Number, &previous.ExpDate, &previous.Code, &previousMetadata, &previous.Tags, &previousSize, &updatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if base != nil && !updatedAt.Equal(*base) {
+		return ErrChanged
+	}
+
+	previous.Metadata, err = unmarshalMetadata(previousMetadata)
+	if err != nil {
+		return err
+	}
+
+	historyBytes, err := writeHistory(ctx, tx, user, pb.ItemType_ITEM_TYPE_PAYMENT, internalID, previous)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := marshalMetadata(payment.Metadata)
+	if err != nil {
+		return err
+	}
+
+	size := itemSize(payment)
+	query = `UPDATE payments SET name = $1, cardholder = $2, number = $3, exp_date = $4, code = $5, metadata = $6, tags = $7, updated_at = $8, size = $9 WHERE id = $10`
+
+	_, err = tx.Exec(
+		ctx,
 		query,
 		payment.Name,
 		payment.Cardholder,
 		payment.Number,
 		payment.ExpDate,
 		payment.Code,
+		metadata,
+		nonNilTags(payment.Tags),
+		time.Now(),
+		size,
+		internalID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_PAYMENT, 0, size-previousSize, historyBytes)
+	if err != nil {
+		return err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PAYMENT, id, pb.Operation_OPERATION_UPDATE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *paymentStorage) Delete(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE payments SET deleted_at = $1 WHERE owner = $2 AND uuid = $3 AND deleted_at IS NULL`
+
+	tag, err := tx.Exec(
+		ctx,
+		query,
+		time.Now(),
+		user,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PAYMENT, id, pb.Operation_OPERATION_DELETE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *paymentStorage) Move(ctx context.Context, user, id string, folderID uint32) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE payments SET folder_id = $1, updated_at = $2 WHERE owner = $3 AND uuid = $4 AND deleted_at IS NULL`
+
+	tag, err := tx.Exec(
+		ctx,
+		query,
+		nullableID(folderID),
+		time.Now(),
 		user,
 		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
 
-	return err
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PAYMENT, id, pb.Operation_OPERATION_UPDATE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *paymentStorage) Delete(user string, id uint32) error {
-	query := `DELETE FROM payments WHERE owner = $1 AND id = $2`
+func (s *paymentStorage) Trash(ctx context.Context, user string) (items []*pb.TrashItem, err error) {
+	query := `SELECT uuid, name, deleted_at FROM payments WHERE owner = $1 AND deleted_at IS NOT NULL`
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	rows, err := s.conn.Query(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &pb.TrashItem{Type: pb.ItemType_ITEM_TYPE_PAYMENT}
+		var deletedAt time.Time
+		err := rows.Scan(&item.Id, &item.Title, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		item.DeletedAt = timestamppb.New(deletedAt)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (s *paymentStorage) Restore(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE payments SET deleted_at = NULL WHERE owner = $1 AND uuid = $2 AND deleted_at IS NOT NULL`
+
+	tag, err := tx.Exec(
+		ctx,
 		query,
 		user,
 		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PAYMENT, id, pb.Operation_OPERATION_RESTORE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *paymentStorage) Purge(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM payments WHERE owner = $1 AND uuid = $2 AND deleted_at IS NOT NULL RETURNING id, size`
+
+	var internalID uint32
+	var size int64
+	err = tx.QueryRow(ctx, query, user, id).Scan(&internalID, &size)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	freed, err := purgeHistory(ctx, tx, pb.ItemType_ITEM_TYPE_PAYMENT, []uint32{internalID})
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_PAYMENT, -1, -size, -freed[internalID])
+	if err != nil {
+		return err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_PAYMENT, id, pb.Operation_OPERATION_PURGE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *paymentStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM payments WHERE deleted_at IS NOT NULL AND deleted_at < $1 RETURNING id, uuid, owner, size`
+
+	rows, err := tx.Query(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := pgx.CollectRows(rows, pgx.RowToStructByPos[purgedItem])
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]uint32, 0, len(purged))
+	for _, item := range purged {
+		ids = append(ids, item.ID)
+	}
+
+	freed, err := purgeHistory(ctx, tx, pb.ItemType_ITEM_TYPE_PAYMENT, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range purged {
+		err = recordUsage(ctx, tx, s.defaultQuota, item.Owner, pb.ItemType_ITEM_TYPE_PAYMENT, -1, -item.Size, -freed[item.ID])
+		if err != nil {
+			return 0, err
+		}
+
+		err = recordChange(ctx, tx, item.Owner, pb.ItemType_ITEM_TYPE_PAYMENT, item.UUID, pb.Operation_OPERATION_PURGE)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
+
+func scanPayment(row pgx.Row) (*pb.Payment, error) {
+	payment := &pb.Payment{}
+	var metadata []byte
+	var createdAt, updatedAt time.Time
+	var lastUsedAt *time.Time
+	err := row.Scan(&payment.Id, &payment.Name, &payment.Cardholder, &payment.Number, &payment.ExpDate, &payment.Code, &metadata, &payment.FolderId, &payment.Tags, &createdAt, &updatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.Metadata, err = unmarshalMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.CreatedAt = timestamppb.New(createdAt)
+	payment.UpdatedAt = timestamppb.New(updatedAt)
+	payment.LastUsedAt = nullableTimestamp(lastUsedAt)
 
-	return err
+	return payment, nil
 }
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type refreshTokenStorage struct {
+	conn *pgxpool.Pool
+}
+
+func NewRefreshTokenStorage(conn *pgxpool.Pool) (*refreshTokenStorage, error) {
+	s := &refreshTokenStorage{
+		conn: conn,
+	}
+
+	err := s.ensureTableExist()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Refresh tokens are stored by their hash, so that the table doesn't leak
+// them. Tokens without an expiry never expire.
+const (
+	refreshTokenTable = `CREATE TABLE IF NOT EXISTS refresh_tokens (
+    hash VARCHAR(64) PRIMARY KEY,
+    owner VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    FOREIGN KEY (owner) REFERENCES users (login)
+);`
+)
+
+func (s *refreshTokenStorage) ensureTableExist() error {
+	_, err := s.conn.Exec(context.Background(), refreshTokenTable)
+	return err
+}
+
+// Add stores the hash of a refresh token of the user, which expires at
+// expiresAt unless it is nil. Expired tokens of the user are dropped.
+func (s *refreshTokenStorage) Add(ctx context.Context, user, hash string, expiresAt *time.Time) error {
+	now := time.Now()
+
+	_, err := s.conn.Exec(ctx, `DELETE FROM refresh_tokens WHERE owner = $1 AND expires_at <= $2`, user, now)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO refresh_tokens(hash, owner, created_at, expires_at) VALUES($1, $2, $3, $4)`
+
+	_, err = s.conn.Exec(ctx, query, hash, user, now, expiresAt)
+	return err
+}
+
+// Take deletes the refresh token with the hash, which can be used only once,
+// and returns its owner. It fails with ErrNotFound when there is no such
+// token or it has expired.
+func (s *refreshTokenStorage) Take(ctx context.Context, hash string) (string, error) {
+	query := `DELETE FROM refresh_tokens WHERE hash = $1 AND (expires_at IS NULL OR expires_at > $2) RETURNING owner`
+
+	var user string
+	err := s.conn.QueryRow(ctx, query, hash, time.Now()).Scan(&user)
+	if err == pgx.ErrNoRows {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	return user, nil
+}
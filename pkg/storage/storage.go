@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	pb "praktikum-gophkeeper/proto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	sqlOperation = regexp.MustCompile(`^\s*(\w+)`)
+	sqlTable     = regexp.MustCompile(`(?i)\b(?:from|into|update|table(?:\s+if\s+not\s+exists)?)\s+(\w+)`)
+)
+
+var (
+	ErrNotFound       = errors.New("item not found")
+	ErrAlreadyExists  = errors.New("item already exists")
+	ErrFolderNotEmpty = errors.New("folder isn't empty")
+	ErrFolderCycle    = errors.New("folder can't be moved into itself")
+	// ErrChanged means that an item was changed since the version an update
+	// was made against.
+	ErrChanged = errors.New("item was changed")
+)
+
+// itemTables maps item types to their tables.
+var itemTables = map[pb.ItemType]string{
+	pb.ItemType_ITEM_TYPE_PASSWORD: "passwords",
+	pb.ItemType_ITEM_TYPE_TEXT:     "texts",
+	pb.ItemType_ITEM_TYPE_BINARY:   "binaries",
+	pb.ItemType_ITEM_TYPE_PAYMENT:  "payments",
+}
+
+// nullableID maps zero id to NULL.
+func nullableID(id uint32) *uint32 {
+	if id == 0 {
+		return nil
+	}
+
+	return &id
+}
+
+// nonNilTags keeps empty tags from being stored as NULL.
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+
+	return tags
+}
+
+func nullableTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return timestamppb.New(*t)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// purgedItem is a permanently deleted item of any type.
+type purgedItem struct {
+	ID    uint32
+	UUID  string
+	Owner string
+	Size  int64
+}
+
+// StoredBytes returns the size of the stored items of every type, trashed
+// ones and previous versions included, as it is counted towards the quotas of
+// their owners.
+func StoredBytes(ctx context.Context, conn *pgxpool.Pool) (map[pb.ItemType]int64, error) {
+	sizes := map[pb.ItemType]int64{}
+	for itemType := range itemTables {
+		sizes[itemType] = 0
+	}
+
+	rows, err := conn.Query(ctx, `SELECT item_type, SUM(bytes + history_bytes) FROM item_usage GROUP BY item_type`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var itemType pb.ItemType
+		var size int64
+		err := rows.Scan(&itemType, &size)
+		if err != nil {
+			return nil, err
+		}
+		sizes[itemType] = size
+	}
+
+	return sizes, rows.Err()
+}
+
+// DescribeQuery returns the first table a query works with, none for queries
+// without one, and its operation.
+func DescribeQuery(sql string) (table, operation string) {
+	table, operation = "none", "unknown"
+	if match := sqlOperation.FindStringSubmatch(sql); match != nil {
+		operation = strings.ToLower(match[1])
+	}
+	if match := sqlTable.FindStringSubmatch(sql); match != nil {
+		table = strings.ToLower(match[1])
+	}
+
+	return table, operation
+}
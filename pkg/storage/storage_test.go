@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDescribeQuery(t *testing.T) {
+	tests := []struct {
+		sql       string
+		table     string
+		operation string
+	}{
+		{
+			sql:       `SELECT login, password FROM users WHERE login = $1`,
+			table:     "users",
+			operation: "select",
+		},
+		{
+			sql:       "\n    INSERT INTO passwords (title) VALUES ($1)",
+			table:     "passwords",
+			operation: "insert",
+		},
+		{
+			sql:       `UPDATE texts SET deleted_at = $1 WHERE owner = $2`,
+			table:     "texts",
+			operation: "update",
+		},
+		{
+			sql:       `DELETE FROM folders WHERE id = $1`,
+			table:     "folders",
+			operation: "delete",
+		},
+		{
+			sql:       `CREATE TABLE IF NOT EXISTS binaries (id SERIAL PRIMARY KEY)`,
+			table:     "binaries",
+			operation: "create",
+		},
+		{
+			sql:       `SELECT pg_notify($1, $2)`,
+			table:     "none",
+			operation: "select",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			table, operation := DescribeQuery(tt.sql)
+			require.Equal(t, tt.table, table)
+			require.Equal(t, tt.operation, operation)
+		})
+	}
+}
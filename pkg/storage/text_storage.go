@@ -2,18 +2,23 @@ package storage
 
 import (
 	"context"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	pb "praktikum-gophkeeper/proto"
 	"time"
 )
 
 type textStorage struct {
-	conn *pgx.Conn
+	conn         *pgxpool.Pool
+	defaultQuota *DefaultQuota
 }
 
-func NewTextStorage(conn *pgx.Conn) (*textStorage, error) {
+func NewTextStorage(conn *pgxpool.Pool, defaultQuota *DefaultQuota) (*textStorage, error) {
 	s := &textStorage{
-		conn: conn,
+		conn:         conn,
+		defaultQuota: defaultQuota,
 	}
 
 	err := s.ensureTableExist()
@@ -27,82 +32,482 @@ func NewTextStorage(conn *pgx.Conn) (*textStorage, error) {
 const (
 	textTable = `CREATE TABLE IF NOT EXISTS texts (
     id SERIAL PRIMARY KEY,
+    uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
     title VARCHAR(100) NOT NULL,
     text VARCHAR(1000) NOT NULL,
     owner VARCHAR(100) NOT NULL,
     created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    deleted_at TIMESTAMP,
+    metadata JSONB NOT NULL DEFAULT '[]',
+    folder_id INTEGER REFERENCES folders (id),
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    size BIGINT NOT NULL,
     FOREIGN KEY (owner) REFERENCES users (login)
-);`
+);
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES folders (id);
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid();
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+UPDATE texts SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE texts ALTER COLUMN updated_at SET NOT NULL;
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS size BIGINT;`
+
+	textColumns = `uuid, title, text, metadata, COALESCE(folder_id, 0), tags, created_at, updated_at, last_used_at`
 )
 
 func (s *textStorage) ensureTableExist() error {
-	_, err := s.conn.Exec(context.Background(), textTable)
+	ctx := context.Background()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, textTable)
+	if err != nil {
+		return err
+	}
 
-	return err
+	err = backfillSizes(ctx, tx, "texts", textColumns, scanText)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *textStorage) Add(user string, text *pb.Text) error {
-	query := `INSERT INTO texts(title, text, owner, created_at) VALUES($1, $2, $3, $4)`
+// Add stores a new text under the client provided id or a generated one and returns the stored text.
+func (s *textStorage) Add(ctx context.Context, user string, text *pb.Text) (*pb.Text, error) {
+	metadata, err := marshalMetadata(text.Metadata)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	id := text.Id
+	if id == "" {
+		id = uuid.NewString()
+	}
+	size := itemSize(text)
+
+	query := `INSERT INTO texts(uuid, title, text, metadata, folder_id, tags, owner, created_at, updated_at, size)
+VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING ` + textColumns
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	row := tx.QueryRow(
+		ctx,
 		query,
+		id,
 		text.Title,
 		text.Text,
+		metadata,
+		nullableID(text.FolderId),
+		nonNilTags(text.Tags),
 		user,
-		time.Now(),
+		now,
+		now,
+		size,
 	)
 
-	return err
+	stored, err := scanText(row)
+	if isUniqueViolation(err) {
+		return nil, ErrAlreadyExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_TEXT, 1, size, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_TEXT, stored.Id, pb.Operation_OPERATION_CREATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, tx.Commit(ctx)
 }
 
-func (s *textStorage) Get(user, title string) (texts []*pb.Text, ids []uint32, err error) {
-	query := `SELECT (title, text, id) FROM texts WHERE owner = $1 AND title = $2`
+// Get returns texts matching title and filter. Every text is matched when title is empty,
+// otherwise the returned texts are considered used and get their last usage time updated.
+func (s *textStorage) Get(ctx context.Context, user, title string, filter *pb.Filter) (texts []*pb.Text, err error) {
+	where := &conditions{}
+	where.add("owner = ?", user)
+	where.add("deleted_at IS NULL")
+	if title != "" {
+		where.add("title = ?", title)
+	}
+	where.addFilter(filter)
+
+	query := `SELECT ` + textColumns + ` FROM texts WHERE ` + where.where()
 
-	rows, err := s.conn.Query(context.Background(), query, user, title)
+	rows, err := s.conn.Query(ctx, query, where.args...)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		text := &pb.Text{}
-		var id uint32
-		err := rows.Scan(&text.Title, &text.Text, &id)
+		text, err := scanText(rows)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		texts = append(texts, text)
-		ids = append(ids, id)
 	}
 
-	return texts, ids, nil
+	return texts, rows.Err()
 }
 
-func (s *textStorage) Update(user string, id uint32, text *pb.Text) error {
-	query := `UPDATE texts SET title = $1, text = $2 WHERE owner = $3 AND id = $4`
+// MarkUsed sets the time the text was last used at to now. Using a text
+// doesn't change it, so neither updated_at nor the change log are touched.
+func (s *textStorage) MarkUsed(ctx context.Context, user, id string) (time.Time, error) {
+	query := `UPDATE texts SET last_used_at = $1 WHERE owner = $2 AND uuid = $3 AND deleted_at IS NULL`
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	now := time.Now()
+	tag, err := s.conn.Exec(ctx, query, now, user, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return time.Time{}, ErrNotFound
+	}
+
+	return now, nil
+}
+
+// GetByIDs returns texts with the given ids which aren't in trash.
+func (s *textStorage) GetByIDs(ctx context.Context, user string, ids []string) (texts []*pb.Text, err error) {
+	query := `SELECT ` + textColumns + ` FROM texts WHERE owner = $1 AND uuid = ANY($2) AND deleted_at IS NULL`
+
+	rows, err := s.conn.Query(ctx, query, user, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		text, err := scanText(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		texts = append(texts, text)
+	}
+
+	return texts, rows.Err()
+}
+
+// Update replaces the text. When base is set, it fails with ErrChanged unless
+// the text was last updated at base, so that concurrent updates don't
+// silently overwrite each other.
+func (s *textStorage) Update(ctx context.Context, user, id string, text *pb.Text, base *time.Time) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT id, title, text, metadata, tags, size, updated_at FROM texts WHERE owner = $1 AND uuid = $2 AND deleted_at IS NULL FOR UPDATE`
+
+	previous := &pb.Text{}
+	var internalID uint32
+	var previousMetadata []byte
+	var previousSize int64
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx, query, user, id).Scan(&internalID, &previous.Title, &previous.Text, &previousMetadata, &previous.Tags, &previousSize, &updatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if base != nil && !updatedAt.Equal(*base) {
+		return ErrChanged
+	}
+
+	previous.Metadata, err = unmarshalMetadata(previousMetadata)
+	if err != nil {
+		return err
+	}
+
+	historyBytes, err := writeHistory(ctx, tx, user, pb.ItemType_ITEM_TYPE_TEXT, internalID, previous)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := marshalMetadata(text.Metadata)
+	if err != nil {
+		return err
+	}
+
+	size := itemSize(text)
+	query = `UPDATE texts SET title = $1, text = $2, metadata = $3, tags = $4, updated_at = $5, size = $6 WHERE id = $7`
+
+	_, err = tx.Exec(
+		ctx,
 		query,
 		text.Title,
 		text.Text,
+		metadata,
+		nonNilTags(text.Tags),
+		time.Now(),
+		size,
+		internalID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_TEXT, 0, size-previousSize, historyBytes)
+	if err != nil {
+		return err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_TEXT, id, pb.Operation_OPERATION_UPDATE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *textStorage) Delete(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE texts SET deleted_at = $1 WHERE owner = $2 AND uuid = $3 AND deleted_at IS NULL`
+
+	tag, err := tx.Exec(
+		ctx,
+		query,
+		time.Now(),
+		user,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_TEXT, id, pb.Operation_OPERATION_DELETE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *textStorage) Move(ctx context.Context, user, id string, folderID uint32) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE texts SET folder_id = $1, updated_at = $2 WHERE owner = $3 AND uuid = $4 AND deleted_at IS NULL`
+
+	tag, err := tx.Exec(
+		ctx,
+		query,
+		nullableID(folderID),
+		time.Now(),
 		user,
 		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_TEXT, id, pb.Operation_OPERATION_UPDATE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *textStorage) Trash(ctx context.Context, user string) (items []*pb.TrashItem, err error) {
+	query := `SELECT uuid, title, deleted_at FROM texts WHERE owner = $1 AND deleted_at IS NOT NULL`
+
+	rows, err := s.conn.Query(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &pb.TrashItem{Type: pb.ItemType_ITEM_TYPE_TEXT}
+		var deletedAt time.Time
+		err := rows.Scan(&item.Id, &item.Title, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
 
-	return err
+		item.DeletedAt = timestamppb.New(deletedAt)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
 }
 
-func (s *textStorage) Delete(user string, id uint32) error {
-	query := `DELETE FROM texts WHERE owner = $1 AND id = $2`
+func (s *textStorage) Restore(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE texts SET deleted_at = NULL WHERE owner = $1 AND uuid = $2 AND deleted_at IS NOT NULL`
 
-	_, err := s.conn.Exec(
-		context.Background(),
+	tag, err := tx.Exec(
+		ctx,
 		query,
 		user,
 		id,
 	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_TEXT, id, pb.Operation_OPERATION_RESTORE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *textStorage) Purge(ctx context.Context, user, id string) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM texts WHERE owner = $1 AND uuid = $2 AND deleted_at IS NOT NULL RETURNING id, size`
+
+	var internalID uint32
+	var size int64
+	err = tx.QueryRow(ctx, query, user, id).Scan(&internalID, &size)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	freed, err := purgeHistory(ctx, tx, pb.ItemType_ITEM_TYPE_TEXT, []uint32{internalID})
+	if err != nil {
+		return err
+	}
+
+	err = recordUsage(ctx, tx, s.defaultQuota, user, pb.ItemType_ITEM_TYPE_TEXT, -1, -size, -freed[internalID])
+	if err != nil {
+		return err
+	}
+
+	err = recordChange(ctx, tx, user, pb.ItemType_ITEM_TYPE_TEXT, id, pb.Operation_OPERATION_PURGE)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *textStorage) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM texts WHERE deleted_at IS NOT NULL AND deleted_at < $1 RETURNING id, uuid, owner, size`
+
+	rows, err := tx.Query(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := pgx.CollectRows(rows, pgx.RowToStructByPos[purgedItem])
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]uint32, 0, len(purged))
+	for _, item := range purged {
+		ids = append(ids, item.ID)
+	}
+
+	freed, err := purgeHistory(ctx, tx, pb.ItemType_ITEM_TYPE_TEXT, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range purged {
+		err = recordUsage(ctx, tx, s.defaultQuota, item.Owner, pb.ItemType_ITEM_TYPE_TEXT, -1, -item.Size, -freed[item.ID])
+		if err != nil {
+			return 0, err
+		}
+
+		err = recordChange(ctx, tx, item.Owner, pb.ItemType_ITEM_TYPE_TEXT, item.UUID, pb.Operation_OPERATION_PURGE)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
+
+func scanText(row pgx.Row) (*pb.Text, error) {
+	text := &pb.Text{}
+	var metadata []byte
+	var createdAt, updatedAt time.Time
+	var lastUsedAt *time.Time
+	err := row.Scan(&text.Id, &text.Title, &text.Text, &metadata, &text.FolderId, &text.Tags, &createdAt, &updatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	text.Metadata, err = unmarshalMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	text.CreatedAt = timestamppb.New(createdAt)
+	text.UpdatedAt = timestamppb.New(updatedAt)
+	text.LastUsedAt = nullableTimestamp(lastUsedAt)
 
-	return err
+	return text, nil
 }
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"praktikum-gophkeeper/pkg/protofield"
+	pb "praktikum-gophkeeper/proto"
+	"sync/atomic"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrItemQuotaExceeded and ErrByteQuotaExceeded tell which limit of the
+	// quota was exceeded, both are ErrQuotaExceeded.
+	ErrItemQuotaExceeded = fmt.Errorf("%w: too many items", ErrQuotaExceeded)
+	ErrByteQuotaExceeded = fmt.Errorf("%w: too many bytes", ErrQuotaExceeded)
+)
+
+// Quota limits the items a user stores, trashed ones included. Zero limits
+// don't limit anything.
+type Quota struct {
+	// Items is the maximum number of items of every type.
+	Items int64
+	// Bytes is the maximum size of all items and their previous versions.
+	Bytes int64
+}
+
+// DefaultQuota holds the quota of users without a quota of their own, which
+// can change while items are stored.
+type DefaultQuota struct {
+	quota atomic.Pointer[Quota]
+}
+
+func NewDefaultQuota(quota Quota) *DefaultQuota {
+	d := &DefaultQuota{}
+	d.Set(quota)
+	return d
+}
+
+func (d *DefaultQuota) Set(quota Quota) {
+	d.quota.Store(&quota)
+}
+
+func (d *DefaultQuota) Get() Quota {
+	return *d.quota.Load()
+}
+
+// rowQuerier is a connection pool or a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type usageStorage struct {
+	conn         *pgxpool.Pool
+	defaultQuota *DefaultQuota
+}
+
+func NewUsageStorage(conn *pgxpool.Pool, defaultQuota *DefaultQuota) (*usageStorage, error) {
+	s := &usageStorage{
+		conn:         conn,
+		defaultQuota: defaultQuota,
+	}
+
+	err := s.ensureTableExist()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// The usage of items stored before it was tracked is counted once, when the
+// table is created, and the usage of their previous versions once, when its
+// column is added.
+const (
+	usageTable = `CREATE TABLE IF NOT EXISTS item_usage (
+    owner VARCHAR(100) NOT NULL,
+    item_type INTEGER NOT NULL,
+    items BIGINT NOT NULL,
+    bytes BIGINT NOT NULL,
+    history_bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (owner, item_type),
+    FOREIGN KEY (owner) REFERENCES users (login)
+);
+ALTER TABLE item_usage ADD COLUMN IF NOT EXISTS history_bytes BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS quotas (
+    owner VARCHAR(100) PRIMARY KEY,
+    items BIGINT,
+    bytes BIGINT,
+    FOREIGN KEY (owner) REFERENCES users (login)
+);`
+
+	countUsage = `INSERT INTO item_usage(owner, item_type, items, bytes)
+SELECT owner, %d, COUNT(*), SUM(size) FROM %s GROUP BY owner
+ON CONFLICT (owner, item_type) DO NOTHING`
+
+	countHistoryUsage = `INSERT INTO item_usage(owner, item_type, items, bytes, history_bytes)
+SELECT owner, item_type, 0, 0, SUM(size) FROM item_history GROUP BY owner, item_type
+ON CONFLICT (owner, item_type) DO UPDATE SET history_bytes = EXCLUDED.history_bytes`
+)
+
+func (s *usageStorage) ensureTableExist() error {
+	ctx := context.Background()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists, historyCounted bool
+	err = tx.QueryRow(ctx, `SELECT to_regclass('item_usage') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'item_usage' AND column_name = 'history_bytes')`
+	err = tx.QueryRow(ctx, query).Scan(&historyCounted)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, usageTable)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		for itemType, table := range itemTables {
+			_, err = tx.Exec(ctx, fmt.Sprintf(countUsage, itemType, table))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !historyCounted {
+		_, err = tx.Exec(ctx, countHistoryUsage)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Get returns the usage of the user and the quota that applies to it.
+func (s *usageStorage) Get(ctx context.Context, user string) (*pb.GetUsageResponse, error) {
+	usage := &pb.GetUsageResponse{}
+
+	rows, err := s.conn.Query(ctx, `SELECT item_type, items, bytes, history_bytes FROM item_usage WHERE owner = $1 ORDER BY item_type`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &pb.ItemUsage{}
+		err := rows.Scan(&item.Type, &item.Items, &item.Bytes, &item.HistoryBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		usage.Bytes += item.Bytes + item.HistoryBytes
+		usage.Items = append(usage.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	quota, err := quotaOf(ctx, s.conn, s.defaultQuota, user)
+	if err != nil {
+		return nil, err
+	}
+	usage.MaxItems, usage.MaxBytes = quota.Items, quota.Bytes
+
+	return usage, nil
+}
+
+// SetQuota sets the quota of the user, a nil limit takes the default one.
+func (s *usageStorage) SetQuota(ctx context.Context, user string, items, bytes *int64) error {
+	query := `INSERT INTO quotas(owner, items, bytes) VALUES($1, $2, $3)
+ON CONFLICT (owner) DO UPDATE SET items = EXCLUDED.items, bytes = EXCLUDED.bytes`
+
+	_, err := s.conn.Exec(
+		ctx,
+		query,
+		user,
+		items,
+		bytes,
+	)
+
+	return err
+}
+
+// quotaOf returns the quota of the user with the default in place of the
+// limits it doesn't set.
+func quotaOf(ctx context.Context, q rowQuerier, defaultQuota *DefaultQuota, user string) (Quota, error) {
+	quota := defaultQuota.Get()
+
+	var items, bytes *int64
+	err := q.QueryRow(ctx, `SELECT items, bytes FROM quotas WHERE owner = $1`, user).Scan(&items, &bytes)
+	if err == pgx.ErrNoRows {
+		return quota, nil
+	} else if err != nil {
+		return Quota{}, err
+	}
+
+	if items != nil {
+		quota.Items = *items
+	}
+	if bytes != nil {
+		quota.Bytes = *bytes
+	}
+
+	return quota, nil
+}
+
+// unsized are the fields of items that the server maintains, or that are
+// changed apart from the rest of an item, so that an item has the same size
+// whether it was added, updated or read back from its table.
+var unsized = map[protoreflect.Name]bool{
+	"id":           true,
+	"folder_id":    true,
+	"created_at":   true,
+	"updated_at":   true,
+	"last_used_at": true,
+}
+
+// itemSize is the number of bytes an item counts towards the quota, the size
+// of its encoding without the unsized fields.
+func itemSize(item proto.Message) int64 {
+	m := item.ProtoReflect()
+	size := proto.Size(item)
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if unsized[fd.Name()] {
+			size -= proto.Size(protofield.Only(m, fd))
+		}
+		return true
+	})
+
+	return int64(size)
+}
+
+// backfillSizes measures the items of the table stored before their size was
+// tracked with itemSize, which new items are measured with as well. columns
+// are the ones scan reads, starting with the uuid.
+func backfillSizes[T interface {
+	proto.Message
+	GetId() string
+}](ctx context.Context, tx pgx.Tx, table, columns string, scan func(pgx.Row) (T, error)) error {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE size IS NULL`, columns, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sizes := map[string]int64{}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		sizes[item.GetId()] = itemSize(item)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, size := range sizes {
+		_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET size = $1 WHERE uuid = $2`, table), size, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN size SET NOT NULL`, table))
+	return err
+}
+
+// recordUsage adds items, bytes and bytes of previous versions, negative when
+// they are freed, to the usage of the user. It fails with ErrQuotaExceeded
+// when a growing usage goes beyond the quota, freeing space always succeeds.
+// It must be called in the same transaction as the change of the items.
+func recordUsage(ctx context.Context, tx pgx.Tx, defaultQuota *DefaultQuota, user string, itemType pb.ItemType, items, bytes, historyBytes int64) error {
+	// Changes of every type are serialized per user, as the size is limited
+	// across types. Key share locks of foreign keys don't wait for this one.
+	_, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE login = $1 FOR NO KEY UPDATE`, user)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO item_usage(owner, item_type, items, bytes, history_bytes) VALUES($1, $2, $3, $4, $5)
+ON CONFLICT (owner, item_type) DO UPDATE SET items = item_usage.items + EXCLUDED.items, bytes = item_usage.bytes + EXCLUDED.bytes,
+    history_bytes = item_usage.history_bytes + EXCLUDED.history_bytes
+RETURNING items`
+
+	var typeItems int64
+	err = tx.QueryRow(ctx, query, user, itemType, items, bytes, historyBytes).Scan(&typeItems)
+	if err != nil {
+		return err
+	}
+
+	if items <= 0 && bytes+historyBytes <= 0 {
+		return nil
+	}
+
+	quota, err := quotaOf(ctx, tx, defaultQuota, user)
+	if err != nil {
+		return err
+	}
+
+	if items > 0 && quota.Items > 0 && typeItems > quota.Items {
+		return ErrItemQuotaExceeded
+	}
+
+	if bytes+historyBytes > 0 && quota.Bytes > 0 {
+		var total int64
+		err = tx.QueryRow(ctx, `SELECT SUM(bytes + history_bytes) FROM item_usage WHERE owner = $1`, user).Scan(&total)
+		if err != nil {
+			return err
+		}
+		if total > quota.Bytes {
+			return ErrByteQuotaExceeded
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	pb "praktikum-gophkeeper/proto"
+	"testing"
+)
+
+func TestItemSize(t *testing.T) {
+	added := &pb.Text{Title: "notes", Text: "content", Tags: []string{"work"}}
+	stored := &pb.Text{
+		Id:        "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		Title:     "notes",
+		Text:      "content",
+		Tags:      []string{"work"},
+		FolderId:  7,
+		CreatedAt: timestamppb.Now(),
+		UpdatedAt: timestamppb.Now(),
+	}
+
+	require.Equal(t, int64(proto.Size(added)), itemSize(added))
+	require.Equal(t, itemSize(added), itemSize(stored))
+	require.Greater(t, itemSize(&pb.Text{Title: "notes", Text: "longer content"}), itemSize(added))
+}
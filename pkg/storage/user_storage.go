@@ -2,16 +2,16 @@ package storage
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	pb "praktikum-gophkeeper/proto"
 	"time"
 )
 
 type userStorage struct {
-	conn *pgx.Conn
+	conn *pgxpool.Pool
 }
 
-func NewUserStorage(conn *pgx.Conn) (*userStorage, error) {
+func NewUserStorage(conn *pgxpool.Pool) (*userStorage, error) {
 	s := &userStorage{
 		conn: conn,
 	}
@@ -37,17 +37,17 @@ func (s *userStorage) ensureTableExist() error {
 	return err
 }
 
-func (s *userStorage) Add(user *pb.User) error {
+func (s *userStorage) Add(ctx context.Context, user *pb.User) error {
 	query := `INSERT INTO users VALUES($1, $2, $3)`
 
-	_, err := s.conn.Exec(context.Background(), query, user.Login, user.Password, time.Now())
+	_, err := s.conn.Exec(ctx, query, user.Login, user.Password, time.Now())
 	return err
 }
 
-func (s *userStorage) Get(login string) (*pb.User, error) {
+func (s *userStorage) Get(ctx context.Context, login string) (*pb.User, error) {
 	query := `SELECT login, password FROM users WHERE login = $1`
 
-	row := s.conn.QueryRow(context.Background(), query, login)
+	row := s.conn.QueryRow(ctx, query, login)
 
 	user := &pb.User{}
 	err := row.Scan(&user.Login, &user.Password)
@@ -0,0 +1,172 @@
+package tlsconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Files of the development certificates in their directory.
+const (
+	DevCAFile   = "ca.pem"
+	DevCAKey    = "ca-key.pem"
+	DevCertFile = "server.pem"
+	DevKeyFile  = "server-key.pem"
+)
+
+const (
+	devCAValidity   = 10 * 365 * 24 * time.Hour
+	devCertValidity = 365 * 24 * time.Hour
+)
+
+// Dev returns the options of a server with a self-signed development CA
+// and a certificate for the hosts, generating the missing ones in dir. The
+// CA isn't used to verify clients; clients trust it with its file.
+func Dev(dir string, hosts []string) (Options, error) {
+	opts := Options{
+		CertFile: filepath.Join(dir, DevCertFile),
+		KeyFile:  filepath.Join(dir, DevKeyFile),
+	}
+
+	_, err := os.Stat(opts.CertFile)
+	if err == nil {
+		return opts, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return Options{}, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return Options{}, err
+	}
+
+	ca, caKey, err := loadOrCreateCA(filepath.Join(dir, DevCAFile), filepath.Join(dir, DevCAKey))
+	if err != nil {
+		return Options{}, err
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "GophKeeper server"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		NotAfter:    time.Now().Add(devCertValidity),
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	err = issue(template, ca, caKey, opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return Options{}, err
+	}
+
+	return opts, nil
+}
+
+func loadOrCreateCA(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if errors.Is(err, os.ErrNotExist) {
+		template := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "GophKeeper development CA"},
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			NotAfter:              time.Now().Add(devCAValidity),
+		}
+
+		err = issue(template, nil, nil, certFile, keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		certPEM, err = os.ReadFile(certFile)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return parsePair(certPEM, keyPEM)
+}
+
+func parsePair(certPEM, keyPEM []byte) (*x509.Certificate, crypto.Signer, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, nil, errors.New("no certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, errors.New("no key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("key can't sign")
+	}
+
+	return cert, signer, nil
+}
+
+// issue creates a key and a certificate signed by the parent, or
+// self-signed without one, and writes them to the files.
+func issue(template, parent *x509.Certificate, parentKey crypto.Signer, certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
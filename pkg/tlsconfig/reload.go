@@ -0,0 +1,111 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadInterval limits how often the files are checked for changes.
+const reloadInterval = 5 * time.Second
+
+// reloader keeps a certificate and optionally a CA, loading them again when
+// one of the files is modified. Renewed certificates are picked up by new
+// connections without a restart.
+type reloader struct {
+	certFile, keyFile, caFile string
+
+	mu      sync.Mutex
+	checked time.Time
+	modTime time.Time
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+}
+
+func newReloader(certFile, keyFile, caFile string) (*reloader, error) {
+	r := &reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.load(modTime)
+	if err != nil {
+		return nil, err
+	}
+
+	r.checked = time.Now()
+	return r, nil
+}
+
+func (r *reloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+
+	return last, nil
+}
+
+// load reads the files, r.mu must be held unless r isn't shared yet.
+func (r *reloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pool, err = loadPool(r.caFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.cert, r.pool, r.modTime = &cert, pool, modTime
+	return nil
+}
+
+// current returns the certificate and CA, reloading them if they changed.
+// The previous ones are kept while the new files can't be loaded, such as
+// in the middle of replacing them.
+func (r *reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < reloadInterval {
+		return r.cert, r.pool
+	}
+	r.checked = time.Now()
+
+	modTime, err := r.lastModified()
+	if err == nil && modTime.After(r.modTime) {
+		err = r.load(modTime)
+		if err == nil {
+			slog.Info("Reloaded TLS certificate", "file", r.certFile)
+		}
+	}
+	if err != nil {
+		slog.Error("Couldn't reload TLS certificate", "error", err)
+	}
+
+	return r.cert, r.pool
+}
@@ -0,0 +1,159 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Options configure TLS on either side of a connection.
+type Options struct {
+	// CertFile and KeyFile are the certificate of the server, or the client
+	// certificate of the client. They are reloaded when they change.
+	CertFile string
+	KeyFile  string
+	// CAFile verifies the server on the client. On the server it enables
+	// verification of client certificates and is reloaded with the certificate.
+	CAFile string
+	// MinVersion defaults to TLS 1.2.
+	MinVersion uint16
+	// CipherSuites are the suites allowed up to TLS 1.2, in order of
+	// preference. TLS 1.3 suites can't be configured.
+	CipherSuites []uint16
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion parses a version such as 1.2, an empty version is zero.
+func ParseVersion(s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	version, ok := versions[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected 1.0 to 1.3", s)
+	}
+
+	return version, nil
+}
+
+// ParseCipherSuites parses a comma-separated list of suite names such as
+// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. Insecure suites are refused.
+func ParseCipherSuites(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	ids := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		ids[suite.Name] = suite.ID
+	}
+
+	var suites []uint16
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := ids[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		suites = append(suites, id)
+	}
+
+	return suites, nil
+}
+
+func (o Options) base() *tls.Config {
+	config := &tls.Config{
+		MinVersion:   o.MinVersion,
+		CipherSuites: o.CipherSuites,
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	return config
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
+
+// Server returns the configuration of a server. Clients must present a
+// certificate signed by the CA when one is set.
+func Server(o Options) (*tls.Config, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, errors.New("both certificate and key are required")
+	}
+
+	r, err := newReloader(o.CertFile, o.KeyFile, o.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// The configuration returned for a client replaces the one gRPC adds its
+	// protocol to, so it is set here.
+	base := o.base()
+	base.NextProtos = []string{"h2"}
+	config := base.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, pool := r.current()
+
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{*cert}
+		if pool != nil {
+			c.ClientCAs = pool
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		return c, nil
+	}
+
+	return config, nil
+}
+
+// Client returns the configuration of a client, which verifies the server
+// with the system roots unless a CA is set.
+func Client(o Options) (*tls.Config, error) {
+	config := o.base()
+
+	if o.CAFile != "" {
+		pool, err := loadPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		r, err := newReloader(o.CertFile, o.KeyFile, "")
+		if err != nil {
+			return nil, err
+		}
+
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,189 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// handshake connects a client to a server and returns the error of the client.
+func handshake(t *testing.T, server, client *tls.Config) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.(*tls.Conn).Handshake()
+		conn.Read(make([]byte, 1))
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), client)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Client certificates are rejected after the client finished its handshake.
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, err = conn.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return nil
+	}
+	return err
+}
+
+func clientCert(t *testing.T, dir string) Options {
+	ca, caKey, err := loadOrCreateCA(filepath.Join(dir, DevCAFile), filepath.Join(dir, DevCAKey))
+	require.NoError(t, err)
+
+	opts := Options{
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client-key.pem"),
+		CAFile:   filepath.Join(dir, DevCAFile),
+	}
+	err = issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotAfter:    time.Now().Add(time.Hour),
+	}, ca, caKey, opts.CertFile, opts.KeyFile)
+	require.NoError(t, err)
+
+	return opts
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	serverOpts, err := Dev(dir, []string{"localhost", "127.0.0.1"})
+	require.NoError(t, err)
+	caFile := filepath.Join(dir, DevCAFile)
+
+	// A second start keeps the certificates.
+	cert, err := os.ReadFile(serverOpts.CertFile)
+	require.NoError(t, err)
+	_, err = Dev(dir, []string{"localhost"})
+	require.NoError(t, err)
+	again, err := os.ReadFile(serverOpts.CertFile)
+	require.NoError(t, err)
+	require.Equal(t, cert, again)
+
+	mutualOpts := serverOpts
+	mutualOpts.CAFile = caFile
+	withCert := clientCert(t, dir)
+
+	tests := []struct {
+		name       string
+		server     Options
+		client     Options
+		maxVersion uint16
+		wantErr    bool
+	}{
+		{
+			name:   "TLS",
+			server: serverOpts,
+			client: Options{CAFile: caFile},
+		},
+		{
+			name:    "unknown CA",
+			server:  serverOpts,
+			client:  Options{},
+			wantErr: true,
+		},
+		{
+			name:   "mutual TLS",
+			server: mutualOpts,
+			client: withCert,
+		},
+		{
+			name:    "mutual TLS without client certificate",
+			server:  mutualOpts,
+			client:  Options{CAFile: caFile},
+			wantErr: true,
+		},
+		{
+			name:       "cipher suite",
+			server:     serverOpts,
+			client:     Options{CAFile: caFile, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}},
+			maxVersion: tls.VersionTLS12,
+		},
+		{
+			name:       "version below minimum",
+			server:     Options{CertFile: serverOpts.CertFile, KeyFile: serverOpts.KeyFile, MinVersion: tls.VersionTLS13},
+			client:     Options{CAFile: caFile},
+			maxVersion: tls.VersionTLS12,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := Server(tt.server)
+			require.NoError(t, err)
+
+			client, err := Client(tt.client)
+			require.NoError(t, err)
+			client.ServerName = "localhost"
+			client.MaxVersion = tt.maxVersion
+
+			err = handshake(t, server, client)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	opts, err := Dev(dir, []string{"localhost"})
+	require.NoError(t, err)
+
+	r, err := newReloader(opts.CertFile, opts.KeyFile, "")
+	require.NoError(t, err)
+	first, _ := r.current()
+
+	require.NoError(t, os.Remove(opts.CertFile))
+	_, err = Dev(dir, []string{"localhost"})
+	require.NoError(t, err)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(opts.CertFile, later, later))
+
+	// Changes are noticed once the interval has passed.
+	cert, _ := r.current()
+	require.Equal(t, first, cert)
+
+	r.checked = time.Time{}
+	cert, _ = r.current()
+	require.NotEqual(t, first.Certificate, cert.Certificate)
+}
+
+func TestParse(t *testing.T) {
+	version, err := ParseVersion("1.3")
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = ParseVersion("2.0")
+	require.Error(t, err)
+
+	suites, err := ParseCipherSuites("TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384")
+	require.NoError(t, err)
+	require.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, suites)
+
+	_, err = ParseCipherSuites("TLS_RSA_WITH_RC4_128_SHA")
+	require.Error(t, err)
+}
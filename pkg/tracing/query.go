@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"praktikum-gophkeeper/pkg/storage"
+)
+
+// QueryTracer starts a span for every database query, named after its
+// operation and table. Neither the statement nor its parameters are recorded.
+type QueryTracer struct{}
+
+// sqlState is the SQLSTATE code of a failed query.
+const sqlState = attribute.Key("db.postgresql.sqlstate")
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	table, operation := storage.DescribeQuery(data.SQL)
+
+	ctx, _ = otel.Tracer(instrumentation).Start(ctx, operation+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(operation), semconv.DBSQLTable(table)),
+	)
+	return ctx
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	// Error messages can quote parameters, so only their codes are recorded.
+	if data.Err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(data.Err, &pgErr) {
+			span.SetAttributes(sqlState.String(pgErr.Code))
+		}
+		span.SetStatus(codes.Error, "Query failed")
+	}
+	span.End()
+}
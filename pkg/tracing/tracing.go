@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"io"
+	"os"
+)
+
+// Exporters of spans.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// instrumentation names the tracer of the spans started here.
+const instrumentation = "praktikum-gophkeeper"
+
+// Propagator carries the trace context of calls in their metadata.
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+type Options struct {
+	Exporter string
+	// Endpoint of the OTLP collector, its default one when empty.
+	Endpoint string
+	Insecure bool
+	// File of the stdout exporter, standard output when empty.
+	File        string
+	SampleRatio float64
+	Service     string
+	Version     string
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function exports the remaining spans and stops; nothing is exported with
+// the none exporter.
+func Setup(ctx context.Context, o Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(Propagator)
+
+	var exporter sdktrace.SpanExporter
+	closeFile := func() error { return nil }
+	var err error
+	switch o.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracegrpc.Option
+		if o.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(o.Endpoint))
+		}
+		if o.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		var out io.Writer = os.Stdout
+		if o.File != "" {
+			file, err := os.OpenFile(o.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+			if err != nil {
+				return nil, err
+			}
+			out, closeFile = file, file.Close
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", o.Exporter)
+	}
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(o.Service),
+		semconv.ServiceVersion(o.Version),
+	))
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeFile())
+	}, nil
+}
@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueryTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "AddBinary")
+
+	tests := []struct {
+		sql  string
+		err  error
+		name string
+	}{
+		{
+			sql:  `INSERT INTO binaries(uuid, title, file) VALUES($1, $2, $3)`,
+			name: "insert binaries",
+		},
+		{
+			sql:  `SELECT login, password FROM users WHERE login = $1`,
+			err:  errors.New("connection reset"),
+			name: "select users",
+		},
+		{
+			sql:  `SELECT uuid FROM texts WHERE uuid = $1`,
+			err:  &pgconn.PgError{Code: "22P02", Message: `invalid input syntax for type uuid: "secret"`},
+			name: "select texts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+
+			queryCtx := QueryTracer{}.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: tt.sql, Args: []any{"secret"}})
+			QueryTracer{}.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: tt.err})
+
+			spans := exporter.GetSpans()
+			require.Len(t, spans, 1)
+			span := spans[0]
+			require.Equal(t, tt.name, span.Name)
+			require.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+			for _, attr := range span.Attributes {
+				require.NotContains(t, attr.Value.Emit(), "secret")
+				require.NotContains(t, attr.Value.Emit(), "$1")
+			}
+			require.NotContains(t, span.Status.Description, "secret")
+			require.Empty(t, span.Events)
+			if tt.err != nil {
+				require.Equal(t, codes.Error, span.Status.Code)
+			}
+			var pgErr *pgconn.PgError
+			if errors.As(tt.err, &pgErr) {
+				require.Contains(t, span.Attributes, sqlState.String(pgErr.Code))
+			}
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+
+	stop, err := Setup(context.Background(), Options{Exporter: ExporterStdout, File: path, SampleRatio: 1, Service: "test"})
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "LoginUser")
+	span.End()
+	require.NoError(t, stop(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"Name":"LoginUser"`)
+
+	_, err = Setup(context.Background(), Options{Exporter: "zipkin"})
+	require.Error(t, err)
+}
@@ -0,0 +1,643 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.23.4
+// source: proto/agent.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Agent_Unlock_FullMethodName              = "/gophkeeper.Agent/Unlock"
+	Agent_Status_FullMethodName              = "/gophkeeper.Agent/Status"
+	Agent_SaveSession_FullMethodName         = "/gophkeeper.Agent/SaveSession"
+	Agent_Lock_FullMethodName                = "/gophkeeper.Agent/Lock"
+	Agent_CacheSeq_FullMethodName            = "/gophkeeper.Agent/CacheSeq"
+	Agent_CacheApply_FullMethodName          = "/gophkeeper.Agent/CacheApply"
+	Agent_CacheItem_FullMethodName           = "/gophkeeper.Agent/CacheItem"
+	Agent_CacheItems_FullMethodName          = "/gophkeeper.Agent/CacheItems"
+	Agent_CacheEnqueue_FullMethodName        = "/gophkeeper.Agent/CacheEnqueue"
+	Agent_CachePending_FullMethodName        = "/gophkeeper.Agent/CachePending"
+	Agent_CacheDequeue_FullMethodName        = "/gophkeeper.Agent/CacheDequeue"
+	Agent_CacheAddConflict_FullMethodName    = "/gophkeeper.Agent/CacheAddConflict"
+	Agent_CacheConflicts_FullMethodName      = "/gophkeeper.Agent/CacheConflicts"
+	Agent_CacheConflict_FullMethodName       = "/gophkeeper.Agent/CacheConflict"
+	Agent_CacheRemoveConflict_FullMethodName = "/gophkeeper.Agent/CacheRemoveConflict"
+)
+
+// AgentClient is the client API for Agent service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AgentClient interface {
+	// Unlock fails with PERMISSION_DENIED when the master password doesn't open
+	// the cache.
+	Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockResponse, error)
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// SaveSession replaces the session the agent holds and saves it to the
+	// session file. It fails with FAILED_PRECONDITION while the agent is locked.
+	SaveSession(ctx context.Context, in *SaveSessionRequest, opts ...grpc.CallOption) (*SaveSessionResponse, error)
+	// Lock zeroes the secrets and closes the cache.
+	Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error)
+	// Cache calls work on the cache the agent has open and fail with
+	// FAILED_PRECONDITION while it has none. CacheItem and CacheConflict fail
+	// with NOT_FOUND when there is no such item or conflict.
+	CacheSeq(ctx context.Context, in *CacheSeqRequest, opts ...grpc.CallOption) (*CacheSeqResponse, error)
+	CacheApply(ctx context.Context, in *CacheApplyRequest, opts ...grpc.CallOption) (*CacheApplyResponse, error)
+	CacheItem(ctx context.Context, in *CacheItemRequest, opts ...grpc.CallOption) (*CacheItemResponse, error)
+	CacheItems(ctx context.Context, in *CacheItemsRequest, opts ...grpc.CallOption) (*CacheItemsResponse, error)
+	CacheEnqueue(ctx context.Context, in *CacheEnqueueRequest, opts ...grpc.CallOption) (*CacheEnqueueResponse, error)
+	CachePending(ctx context.Context, in *CachePendingRequest, opts ...grpc.CallOption) (*CachePendingResponse, error)
+	CacheDequeue(ctx context.Context, in *CacheDequeueRequest, opts ...grpc.CallOption) (*CacheDequeueResponse, error)
+	CacheAddConflict(ctx context.Context, in *CacheAddConflictRequest, opts ...grpc.CallOption) (*CacheAddConflictResponse, error)
+	CacheConflicts(ctx context.Context, in *CacheConflictsRequest, opts ...grpc.CallOption) (*CacheConflictsResponse, error)
+	CacheConflict(ctx context.Context, in *CacheConflictRequest, opts ...grpc.CallOption) (*CacheConflictResponse, error)
+	CacheRemoveConflict(ctx context.Context, in *CacheRemoveConflictRequest, opts ...grpc.CallOption) (*CacheRemoveConflictResponse, error)
+}
+
+type agentClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAgentClient(cc grpc.ClientConnInterface) AgentClient {
+	return &agentClient{cc}
+}
+
+func (c *agentClient) Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockResponse, error) {
+	out := new(UnlockResponse)
+	err := c.cc.Invoke(ctx, Agent_Unlock_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, Agent_Status_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) SaveSession(ctx context.Context, in *SaveSessionRequest, opts ...grpc.CallOption) (*SaveSessionResponse, error) {
+	out := new(SaveSessionResponse)
+	err := c.cc.Invoke(ctx, Agent_SaveSession_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error) {
+	out := new(LockResponse)
+	err := c.cc.Invoke(ctx, Agent_Lock_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheSeq(ctx context.Context, in *CacheSeqRequest, opts ...grpc.CallOption) (*CacheSeqResponse, error) {
+	out := new(CacheSeqResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheSeq_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheApply(ctx context.Context, in *CacheApplyRequest, opts ...grpc.CallOption) (*CacheApplyResponse, error) {
+	out := new(CacheApplyResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheApply_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheItem(ctx context.Context, in *CacheItemRequest, opts ...grpc.CallOption) (*CacheItemResponse, error) {
+	out := new(CacheItemResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheItems(ctx context.Context, in *CacheItemsRequest, opts ...grpc.CallOption) (*CacheItemsResponse, error) {
+	out := new(CacheItemsResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheItems_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheEnqueue(ctx context.Context, in *CacheEnqueueRequest, opts ...grpc.CallOption) (*CacheEnqueueResponse, error) {
+	out := new(CacheEnqueueResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheEnqueue_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CachePending(ctx context.Context, in *CachePendingRequest, opts ...grpc.CallOption) (*CachePendingResponse, error) {
+	out := new(CachePendingResponse)
+	err := c.cc.Invoke(ctx, Agent_CachePending_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheDequeue(ctx context.Context, in *CacheDequeueRequest, opts ...grpc.CallOption) (*CacheDequeueResponse, error) {
+	out := new(CacheDequeueResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheDequeue_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheAddConflict(ctx context.Context, in *CacheAddConflictRequest, opts ...grpc.CallOption) (*CacheAddConflictResponse, error) {
+	out := new(CacheAddConflictResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheAddConflict_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheConflicts(ctx context.Context, in *CacheConflictsRequest, opts ...grpc.CallOption) (*CacheConflictsResponse, error) {
+	out := new(CacheConflictsResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheConflicts_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheConflict(ctx context.Context, in *CacheConflictRequest, opts ...grpc.CallOption) (*CacheConflictResponse, error) {
+	out := new(CacheConflictResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheConflict_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) CacheRemoveConflict(ctx context.Context, in *CacheRemoveConflictRequest, opts ...grpc.CallOption) (*CacheRemoveConflictResponse, error) {
+	out := new(CacheRemoveConflictResponse)
+	err := c.cc.Invoke(ctx, Agent_CacheRemoveConflict_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AgentServer is the server API for Agent service.
+// All implementations must embed UnimplementedAgentServer
+// for forward compatibility
+type AgentServer interface {
+	// Unlock fails with PERMISSION_DENIED when the master password doesn't open
+	// the cache.
+	Unlock(context.Context, *UnlockRequest) (*UnlockResponse, error)
+	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	// SaveSession replaces the session the agent holds and saves it to the
+	// session file. It fails with FAILED_PRECONDITION while the agent is locked.
+	SaveSession(context.Context, *SaveSessionRequest) (*SaveSessionResponse, error)
+	// Lock zeroes the secrets and closes the cache.
+	Lock(context.Context, *LockRequest) (*LockResponse, error)
+	// Cache calls work on the cache the agent has open and fail with
+	// FAILED_PRECONDITION while it has none. CacheItem and CacheConflict fail
+	// with NOT_FOUND when there is no such item or conflict.
+	CacheSeq(context.Context, *CacheSeqRequest) (*CacheSeqResponse, error)
+	CacheApply(context.Context, *CacheApplyRequest) (*CacheApplyResponse, error)
+	CacheItem(context.Context, *CacheItemRequest) (*CacheItemResponse, error)
+	CacheItems(context.Context, *CacheItemsRequest) (*CacheItemsResponse, error)
+	CacheEnqueue(context.Context, *CacheEnqueueRequest) (*CacheEnqueueResponse, error)
+	CachePending(context.Context, *CachePendingRequest) (*CachePendingResponse, error)
+	CacheDequeue(context.Context, *CacheDequeueRequest) (*CacheDequeueResponse, error)
+	CacheAddConflict(context.Context, *CacheAddConflictRequest) (*CacheAddConflictResponse, error)
+	CacheConflicts(context.Context, *CacheConflictsRequest) (*CacheConflictsResponse, error)
+	CacheConflict(context.Context, *CacheConflictRequest) (*CacheConflictResponse, error)
+	CacheRemoveConflict(context.Context, *CacheRemoveConflictRequest) (*CacheRemoveConflictResponse, error)
+	mustEmbedUnimplementedAgentServer()
+}
+
+// UnimplementedAgentServer must be embedded to have forward compatible implementations.
+type UnimplementedAgentServer struct {
+}
+
+func (UnimplementedAgentServer) Unlock(context.Context, *UnlockRequest) (*UnlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unlock not implemented")
+}
+func (UnimplementedAgentServer) Status(context.Context, *StatusRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedAgentServer) SaveSession(context.Context, *SaveSessionRequest) (*SaveSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SaveSession not implemented")
+}
+func (UnimplementedAgentServer) Lock(context.Context, *LockRequest) (*LockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lock not implemented")
+}
+func (UnimplementedAgentServer) CacheSeq(context.Context, *CacheSeqRequest) (*CacheSeqResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheSeq not implemented")
+}
+func (UnimplementedAgentServer) CacheApply(context.Context, *CacheApplyRequest) (*CacheApplyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheApply not implemented")
+}
+func (UnimplementedAgentServer) CacheItem(context.Context, *CacheItemRequest) (*CacheItemResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheItem not implemented")
+}
+func (UnimplementedAgentServer) CacheItems(context.Context, *CacheItemsRequest) (*CacheItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheItems not implemented")
+}
+func (UnimplementedAgentServer) CacheEnqueue(context.Context, *CacheEnqueueRequest) (*CacheEnqueueResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheEnqueue not implemented")
+}
+func (UnimplementedAgentServer) CachePending(context.Context, *CachePendingRequest) (*CachePendingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CachePending not implemented")
+}
+func (UnimplementedAgentServer) CacheDequeue(context.Context, *CacheDequeueRequest) (*CacheDequeueResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheDequeue not implemented")
+}
+func (UnimplementedAgentServer) CacheAddConflict(context.Context, *CacheAddConflictRequest) (*CacheAddConflictResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheAddConflict not implemented")
+}
+func (UnimplementedAgentServer) CacheConflicts(context.Context, *CacheConflictsRequest) (*CacheConflictsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheConflicts not implemented")
+}
+func (UnimplementedAgentServer) CacheConflict(context.Context, *CacheConflictRequest) (*CacheConflictResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheConflict not implemented")
+}
+func (UnimplementedAgentServer) CacheRemoveConflict(context.Context, *CacheRemoveConflictRequest) (*CacheRemoveConflictResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CacheRemoveConflict not implemented")
+}
+func (UnimplementedAgentServer) mustEmbedUnimplementedAgentServer() {}
+
+// UnsafeAgentServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AgentServer will
+// result in compilation errors.
+type UnsafeAgentServer interface {
+	mustEmbedUnimplementedAgentServer()
+}
+
+func RegisterAgentServer(s grpc.ServiceRegistrar, srv AgentServer) {
+	s.RegisterService(&Agent_ServiceDesc, srv)
+}
+
+func _Agent_Unlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).Unlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_Unlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).Unlock(ctx, req.(*UnlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_SaveSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).SaveSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_SaveSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).SaveSession(ctx, req.(*SaveSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_Lock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).Lock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_Lock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).Lock(ctx, req.(*LockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheSeq_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheSeqRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheSeq(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheSeq_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheSeq(ctx, req.(*CacheSeqRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheApply_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheApplyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheApply(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheApply_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheApply(ctx, req.(*CacheApplyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheItem(ctx, req.(*CacheItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheItems_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheItems(ctx, req.(*CacheItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheEnqueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheEnqueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheEnqueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheEnqueue_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheEnqueue(ctx, req.(*CacheEnqueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CachePending_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CachePendingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CachePending(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CachePending_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CachePending(ctx, req.(*CachePendingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheDequeue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheDequeueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheDequeue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheDequeue_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheDequeue(ctx, req.(*CacheDequeueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheAddConflict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheAddConflictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheAddConflict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheAddConflict_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheAddConflict(ctx, req.(*CacheAddConflictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheConflicts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheConflictsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheConflicts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheConflicts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheConflicts(ctx, req.(*CacheConflictsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheConflict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheConflictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheConflict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheConflict_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheConflict(ctx, req.(*CacheConflictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_CacheRemoveConflict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CacheRemoveConflictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CacheRemoveConflict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CacheRemoveConflict_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CacheRemoveConflict(ctx, req.(*CacheRemoveConflictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Agent_ServiceDesc is the grpc.ServiceDesc for Agent service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Agent_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gophkeeper.Agent",
+	HandlerType: (*AgentServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Unlock",
+			Handler:    _Agent_Unlock_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _Agent_Status_Handler,
+		},
+		{
+			MethodName: "SaveSession",
+			Handler:    _Agent_SaveSession_Handler,
+		},
+		{
+			MethodName: "Lock",
+			Handler:    _Agent_Lock_Handler,
+		},
+		{
+			MethodName: "CacheSeq",
+			Handler:    _Agent_CacheSeq_Handler,
+		},
+		{
+			MethodName: "CacheApply",
+			Handler:    _Agent_CacheApply_Handler,
+		},
+		{
+			MethodName: "CacheItem",
+			Handler:    _Agent_CacheItem_Handler,
+		},
+		{
+			MethodName: "CacheItems",
+			Handler:    _Agent_CacheItems_Handler,
+		},
+		{
+			MethodName: "CacheEnqueue",
+			Handler:    _Agent_CacheEnqueue_Handler,
+		},
+		{
+			MethodName: "CachePending",
+			Handler:    _Agent_CachePending_Handler,
+		},
+		{
+			MethodName: "CacheDequeue",
+			Handler:    _Agent_CacheDequeue_Handler,
+		},
+		{
+			MethodName: "CacheAddConflict",
+			Handler:    _Agent_CacheAddConflict_Handler,
+		},
+		{
+			MethodName: "CacheConflicts",
+			Handler:    _Agent_CacheConflicts_Handler,
+		},
+		{
+			MethodName: "CacheConflict",
+			Handler:    _Agent_CacheConflict_Handler,
+		},
+		{
+			MethodName: "CacheRemoveConflict",
+			Handler:    _Agent_CacheRemoveConflict_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/agent.proto",
+}
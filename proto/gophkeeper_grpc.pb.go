@@ -19,22 +19,38 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	GophKeeper_AddPassword_FullMethodName    = "/gophkeeper.GophKeeper/AddPassword"
-	GophKeeper_GetPassword_FullMethodName    = "/gophkeeper.GophKeeper/GetPassword"
-	GophKeeper_UpdatePassword_FullMethodName = "/gophkeeper.GophKeeper/UpdatePassword"
-	GophKeeper_DeletePassword_FullMethodName = "/gophkeeper.GophKeeper/DeletePassword"
-	GophKeeper_AddText_FullMethodName        = "/gophkeeper.GophKeeper/AddText"
-	GophKeeper_GetText_FullMethodName        = "/gophkeeper.GophKeeper/GetText"
-	GophKeeper_UpdateText_FullMethodName     = "/gophkeeper.GophKeeper/UpdateText"
-	GophKeeper_DeleteText_FullMethodName     = "/gophkeeper.GophKeeper/DeleteText"
-	GophKeeper_AddBinary_FullMethodName      = "/gophkeeper.GophKeeper/AddBinary"
-	GophKeeper_GetBinary_FullMethodName      = "/gophkeeper.GophKeeper/GetBinary"
-	GophKeeper_UpdateBinary_FullMethodName   = "/gophkeeper.GophKeeper/UpdateBinary"
-	GophKeeper_DeleteBinary_FullMethodName   = "/gophkeeper.GophKeeper/DeleteBinary"
-	GophKeeper_AddPayment_FullMethodName     = "/gophkeeper.GophKeeper/AddPayment"
-	GophKeeper_GetPayment_FullMethodName     = "/gophkeeper.GophKeeper/GetPayment"
-	GophKeeper_UpdatePayment_FullMethodName  = "/gophkeeper.GophKeeper/UpdatePayment"
-	GophKeeper_DeletePayment_FullMethodName  = "/gophkeeper.GophKeeper/DeletePayment"
+	GophKeeper_AddPassword_FullMethodName     = "/gophkeeper.GophKeeper/AddPassword"
+	GophKeeper_GetPassword_FullMethodName     = "/gophkeeper.GophKeeper/GetPassword"
+	GophKeeper_UpdatePassword_FullMethodName  = "/gophkeeper.GophKeeper/UpdatePassword"
+	GophKeeper_DeletePassword_FullMethodName  = "/gophkeeper.GophKeeper/DeletePassword"
+	GophKeeper_AddText_FullMethodName         = "/gophkeeper.GophKeeper/AddText"
+	GophKeeper_GetText_FullMethodName         = "/gophkeeper.GophKeeper/GetText"
+	GophKeeper_UpdateText_FullMethodName      = "/gophkeeper.GophKeeper/UpdateText"
+	GophKeeper_DeleteText_FullMethodName      = "/gophkeeper.GophKeeper/DeleteText"
+	GophKeeper_AddBinary_FullMethodName       = "/gophkeeper.GophKeeper/AddBinary"
+	GophKeeper_GetBinary_FullMethodName       = "/gophkeeper.GophKeeper/GetBinary"
+	GophKeeper_UpdateBinary_FullMethodName    = "/gophkeeper.GophKeeper/UpdateBinary"
+	GophKeeper_DeleteBinary_FullMethodName    = "/gophkeeper.GophKeeper/DeleteBinary"
+	GophKeeper_AddPayment_FullMethodName      = "/gophkeeper.GophKeeper/AddPayment"
+	GophKeeper_GetPayment_FullMethodName      = "/gophkeeper.GophKeeper/GetPayment"
+	GophKeeper_UpdatePayment_FullMethodName   = "/gophkeeper.GophKeeper/UpdatePayment"
+	GophKeeper_DeletePayment_FullMethodName   = "/gophkeeper.GophKeeper/DeletePayment"
+	GophKeeper_ListTrash_FullMethodName       = "/gophkeeper.GophKeeper/ListTrash"
+	GophKeeper_RestoreItem_FullMethodName     = "/gophkeeper.GophKeeper/RestoreItem"
+	GophKeeper_PurgeItem_FullMethodName       = "/gophkeeper.GophKeeper/PurgeItem"
+	GophKeeper_GetItemHistory_FullMethodName  = "/gophkeeper.GophKeeper/GetItemHistory"
+	GophKeeper_RevertItem_FullMethodName      = "/gophkeeper.GophKeeper/RevertItem"
+	GophKeeper_SetHistoryDepth_FullMethodName = "/gophkeeper.GophKeeper/SetHistoryDepth"
+	GophKeeper_CreateFolder_FullMethodName    = "/gophkeeper.GophKeeper/CreateFolder"
+	GophKeeper_RenameFolder_FullMethodName    = "/gophkeeper.GophKeeper/RenameFolder"
+	GophKeeper_MoveFolder_FullMethodName      = "/gophkeeper.GophKeeper/MoveFolder"
+	GophKeeper_DeleteFolder_FullMethodName    = "/gophkeeper.GophKeeper/DeleteFolder"
+	GophKeeper_ListFolders_FullMethodName     = "/gophkeeper.GophKeeper/ListFolders"
+	GophKeeper_MoveItem_FullMethodName        = "/gophkeeper.GophKeeper/MoveItem"
+	GophKeeper_Sync_FullMethodName            = "/gophkeeper.GophKeeper/Sync"
+	GophKeeper_Watch_FullMethodName           = "/gophkeeper.GophKeeper/Watch"
+	GophKeeper_ListAuditEvents_FullMethodName = "/gophkeeper.GophKeeper/ListAuditEvents"
+	GophKeeper_GetUsage_FullMethodName        = "/gophkeeper.GophKeeper/GetUsage"
 )
 
 // GophKeeperClient is the client API for GophKeeper service.
@@ -57,6 +73,22 @@ type GophKeeperClient interface {
 	GetPayment(ctx context.Context, in *GetPaymentRequest, opts ...grpc.CallOption) (*GetPaymentResponse, error)
 	UpdatePayment(ctx context.Context, in *UpdatePaymentRequest, opts ...grpc.CallOption) (*UpdatePaymentResponse, error)
 	DeletePayment(ctx context.Context, in *DeletePaymentRequest, opts ...grpc.CallOption) (*DeletePaymentResponse, error)
+	ListTrash(ctx context.Context, in *ListTrashRequest, opts ...grpc.CallOption) (*ListTrashResponse, error)
+	RestoreItem(ctx context.Context, in *RestoreItemRequest, opts ...grpc.CallOption) (*RestoreItemResponse, error)
+	PurgeItem(ctx context.Context, in *PurgeItemRequest, opts ...grpc.CallOption) (*PurgeItemResponse, error)
+	GetItemHistory(ctx context.Context, in *GetItemHistoryRequest, opts ...grpc.CallOption) (*GetItemHistoryResponse, error)
+	RevertItem(ctx context.Context, in *RevertItemRequest, opts ...grpc.CallOption) (*RevertItemResponse, error)
+	SetHistoryDepth(ctx context.Context, in *SetHistoryDepthRequest, opts ...grpc.CallOption) (*SetHistoryDepthResponse, error)
+	CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*CreateFolderResponse, error)
+	RenameFolder(ctx context.Context, in *RenameFolderRequest, opts ...grpc.CallOption) (*RenameFolderResponse, error)
+	MoveFolder(ctx context.Context, in *MoveFolderRequest, opts ...grpc.CallOption) (*MoveFolderResponse, error)
+	DeleteFolder(ctx context.Context, in *DeleteFolderRequest, opts ...grpc.CallOption) (*DeleteFolderResponse, error)
+	ListFolders(ctx context.Context, in *ListFoldersRequest, opts ...grpc.CallOption) (*ListFoldersResponse, error)
+	MoveItem(ctx context.Context, in *MoveItemRequest, opts ...grpc.CallOption) (*MoveItemResponse, error)
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (GophKeeper_WatchClient, error)
+	ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...grpc.CallOption) (*ListAuditEventsResponse, error)
+	GetUsage(ctx context.Context, in *GetUsageRequest, opts ...grpc.CallOption) (*GetUsageResponse, error)
 }
 
 type gophKeeperClient struct {
@@ -211,6 +243,173 @@ func (c *gophKeeperClient) DeletePayment(ctx context.Context, in *DeletePaymentR
 	return out, nil
 }
 
+func (c *gophKeeperClient) ListTrash(ctx context.Context, in *ListTrashRequest, opts ...grpc.CallOption) (*ListTrashResponse, error) {
+	out := new(ListTrashResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_ListTrash_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) RestoreItem(ctx context.Context, in *RestoreItemRequest, opts ...grpc.CallOption) (*RestoreItemResponse, error) {
+	out := new(RestoreItemResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_RestoreItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) PurgeItem(ctx context.Context, in *PurgeItemRequest, opts ...grpc.CallOption) (*PurgeItemResponse, error) {
+	out := new(PurgeItemResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_PurgeItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) GetItemHistory(ctx context.Context, in *GetItemHistoryRequest, opts ...grpc.CallOption) (*GetItemHistoryResponse, error) {
+	out := new(GetItemHistoryResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_GetItemHistory_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) RevertItem(ctx context.Context, in *RevertItemRequest, opts ...grpc.CallOption) (*RevertItemResponse, error) {
+	out := new(RevertItemResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_RevertItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) SetHistoryDepth(ctx context.Context, in *SetHistoryDepthRequest, opts ...grpc.CallOption) (*SetHistoryDepthResponse, error) {
+	out := new(SetHistoryDepthResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_SetHistoryDepth_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*CreateFolderResponse, error) {
+	out := new(CreateFolderResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_CreateFolder_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) RenameFolder(ctx context.Context, in *RenameFolderRequest, opts ...grpc.CallOption) (*RenameFolderResponse, error) {
+	out := new(RenameFolderResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_RenameFolder_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) MoveFolder(ctx context.Context, in *MoveFolderRequest, opts ...grpc.CallOption) (*MoveFolderResponse, error) {
+	out := new(MoveFolderResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_MoveFolder_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) DeleteFolder(ctx context.Context, in *DeleteFolderRequest, opts ...grpc.CallOption) (*DeleteFolderResponse, error) {
+	out := new(DeleteFolderResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_DeleteFolder_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) ListFolders(ctx context.Context, in *ListFoldersRequest, opts ...grpc.CallOption) (*ListFoldersResponse, error) {
+	out := new(ListFoldersResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_ListFolders_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) MoveItem(ctx context.Context, in *MoveItemRequest, opts ...grpc.CallOption) (*MoveItemResponse, error) {
+	out := new(MoveItemResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_MoveItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error) {
+	out := new(SyncResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_Sync_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (GophKeeper_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GophKeeper_ServiceDesc.Streams[0], GophKeeper_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gophKeeperWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GophKeeper_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type gophKeeperWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *gophKeeperWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gophKeeperClient) ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...grpc.CallOption) (*ListAuditEventsResponse, error) {
+	out := new(ListAuditEventsResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_ListAuditEvents_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) GetUsage(ctx context.Context, in *GetUsageRequest, opts ...grpc.CallOption) (*GetUsageResponse, error) {
+	out := new(GetUsageResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_GetUsage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GophKeeperServer is the server API for GophKeeper service.
 // All implementations must embed UnimplementedGophKeeperServer
 // for forward compatibility
@@ -231,6 +430,22 @@ type GophKeeperServer interface {
 	GetPayment(context.Context, *GetPaymentRequest) (*GetPaymentResponse, error)
 	UpdatePayment(context.Context, *UpdatePaymentRequest) (*UpdatePaymentResponse, error)
 	DeletePayment(context.Context, *DeletePaymentRequest) (*DeletePaymentResponse, error)
+	ListTrash(context.Context, *ListTrashRequest) (*ListTrashResponse, error)
+	RestoreItem(context.Context, *RestoreItemRequest) (*RestoreItemResponse, error)
+	PurgeItem(context.Context, *PurgeItemRequest) (*PurgeItemResponse, error)
+	GetItemHistory(context.Context, *GetItemHistoryRequest) (*GetItemHistoryResponse, error)
+	RevertItem(context.Context, *RevertItemRequest) (*RevertItemResponse, error)
+	SetHistoryDepth(context.Context, *SetHistoryDepthRequest) (*SetHistoryDepthResponse, error)
+	CreateFolder(context.Context, *CreateFolderRequest) (*CreateFolderResponse, error)
+	RenameFolder(context.Context, *RenameFolderRequest) (*RenameFolderResponse, error)
+	MoveFolder(context.Context, *MoveFolderRequest) (*MoveFolderResponse, error)
+	DeleteFolder(context.Context, *DeleteFolderRequest) (*DeleteFolderResponse, error)
+	ListFolders(context.Context, *ListFoldersRequest) (*ListFoldersResponse, error)
+	MoveItem(context.Context, *MoveItemRequest) (*MoveItemResponse, error)
+	Sync(context.Context, *SyncRequest) (*SyncResponse, error)
+	Watch(*WatchRequest, GophKeeper_WatchServer) error
+	ListAuditEvents(context.Context, *ListAuditEventsRequest) (*ListAuditEventsResponse, error)
+	GetUsage(context.Context, *GetUsageRequest) (*GetUsageResponse, error)
 	mustEmbedUnimplementedGophKeeperServer()
 }
 
@@ -286,6 +501,54 @@ func (UnimplementedGophKeeperServer) UpdatePayment(context.Context, *UpdatePayme
 func (UnimplementedGophKeeperServer) DeletePayment(context.Context, *DeletePaymentRequest) (*DeletePaymentResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeletePayment not implemented")
 }
+func (UnimplementedGophKeeperServer) ListTrash(context.Context, *ListTrashRequest) (*ListTrashResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTrash not implemented")
+}
+func (UnimplementedGophKeeperServer) RestoreItem(context.Context, *RestoreItemRequest) (*RestoreItemResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreItem not implemented")
+}
+func (UnimplementedGophKeeperServer) PurgeItem(context.Context, *PurgeItemRequest) (*PurgeItemResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeItem not implemented")
+}
+func (UnimplementedGophKeeperServer) GetItemHistory(context.Context, *GetItemHistoryRequest) (*GetItemHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetItemHistory not implemented")
+}
+func (UnimplementedGophKeeperServer) RevertItem(context.Context, *RevertItemRequest) (*RevertItemResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevertItem not implemented")
+}
+func (UnimplementedGophKeeperServer) SetHistoryDepth(context.Context, *SetHistoryDepthRequest) (*SetHistoryDepthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetHistoryDepth not implemented")
+}
+func (UnimplementedGophKeeperServer) CreateFolder(context.Context, *CreateFolderRequest) (*CreateFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateFolder not implemented")
+}
+func (UnimplementedGophKeeperServer) RenameFolder(context.Context, *RenameFolderRequest) (*RenameFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenameFolder not implemented")
+}
+func (UnimplementedGophKeeperServer) MoveFolder(context.Context, *MoveFolderRequest) (*MoveFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MoveFolder not implemented")
+}
+func (UnimplementedGophKeeperServer) DeleteFolder(context.Context, *DeleteFolderRequest) (*DeleteFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFolder not implemented")
+}
+func (UnimplementedGophKeeperServer) ListFolders(context.Context, *ListFoldersRequest) (*ListFoldersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFolders not implemented")
+}
+func (UnimplementedGophKeeperServer) MoveItem(context.Context, *MoveItemRequest) (*MoveItemResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MoveItem not implemented")
+}
+func (UnimplementedGophKeeperServer) Sync(context.Context, *SyncRequest) (*SyncResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedGophKeeperServer) Watch(*WatchRequest, GophKeeper_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedGophKeeperServer) ListAuditEvents(context.Context, *ListAuditEventsRequest) (*ListAuditEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditEvents not implemented")
+}
+func (UnimplementedGophKeeperServer) GetUsage(context.Context, *GetUsageRequest) (*GetUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsage not implemented")
+}
 func (UnimplementedGophKeeperServer) mustEmbedUnimplementedGophKeeperServer() {}
 
 // UnsafeGophKeeperServer may be embedded to opt out of forward compatibility for this service.
@@ -587,6 +850,297 @@ func _GophKeeper_DeletePayment_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GophKeeper_ListTrash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTrashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).ListTrash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_ListTrash_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).ListTrash(ctx, req.(*ListTrashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_RestoreItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).RestoreItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_RestoreItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).RestoreItem(ctx, req.(*RestoreItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_PurgeItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).PurgeItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_PurgeItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).PurgeItem(ctx, req.(*PurgeItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_GetItemHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetItemHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).GetItemHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_GetItemHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).GetItemHistory(ctx, req.(*GetItemHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_RevertItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevertItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).RevertItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_RevertItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).RevertItem(ctx, req.(*RevertItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_SetHistoryDepth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetHistoryDepthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).SetHistoryDepth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_SetHistoryDepth_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).SetHistoryDepth(ctx, req.(*SetHistoryDepthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_CreateFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).CreateFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_CreateFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).CreateFolder(ctx, req.(*CreateFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_RenameFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).RenameFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_RenameFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).RenameFolder(ctx, req.(*RenameFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_MoveFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).MoveFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_MoveFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).MoveFolder(ctx, req.(*MoveFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_DeleteFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).DeleteFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_DeleteFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).DeleteFolder(ctx, req.(*DeleteFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_ListFolders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFoldersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).ListFolders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_ListFolders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).ListFolders(ctx, req.(*ListFoldersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_MoveItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).MoveItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_MoveItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).MoveItem(ctx, req.(*MoveItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_Sync_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).Sync(ctx, req.(*SyncRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GophKeeperServer).Watch(m, &gophKeeperWatchServer{stream})
+}
+
+type GophKeeper_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type gophKeeperWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *gophKeeperWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GophKeeper_ListAuditEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuditEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).ListAuditEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_ListAuditEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).ListAuditEvents(ctx, req.(*ListAuditEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_GetUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).GetUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_GetUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).GetUsage(ctx, req.(*GetUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // GophKeeper_ServiceDesc is the grpc.ServiceDesc for GophKeeper service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -658,7 +1212,73 @@ var GophKeeper_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeletePayment",
 			Handler:    _GophKeeper_DeletePayment_Handler,
 		},
+		{
+			MethodName: "ListTrash",
+			Handler:    _GophKeeper_ListTrash_Handler,
+		},
+		{
+			MethodName: "RestoreItem",
+			Handler:    _GophKeeper_RestoreItem_Handler,
+		},
+		{
+			MethodName: "PurgeItem",
+			Handler:    _GophKeeper_PurgeItem_Handler,
+		},
+		{
+			MethodName: "GetItemHistory",
+			Handler:    _GophKeeper_GetItemHistory_Handler,
+		},
+		{
+			MethodName: "RevertItem",
+			Handler:    _GophKeeper_RevertItem_Handler,
+		},
+		{
+			MethodName: "SetHistoryDepth",
+			Handler:    _GophKeeper_SetHistoryDepth_Handler,
+		},
+		{
+			MethodName: "CreateFolder",
+			Handler:    _GophKeeper_CreateFolder_Handler,
+		},
+		{
+			MethodName: "RenameFolder",
+			Handler:    _GophKeeper_RenameFolder_Handler,
+		},
+		{
+			MethodName: "MoveFolder",
+			Handler:    _GophKeeper_MoveFolder_Handler,
+		},
+		{
+			MethodName: "DeleteFolder",
+			Handler:    _GophKeeper_DeleteFolder_Handler,
+		},
+		{
+			MethodName: "ListFolders",
+			Handler:    _GophKeeper_ListFolders_Handler,
+		},
+		{
+			MethodName: "MoveItem",
+			Handler:    _GophKeeper_MoveItem_Handler,
+		},
+		{
+			MethodName: "Sync",
+			Handler:    _GophKeeper_Sync_Handler,
+		},
+		{
+			MethodName: "ListAuditEvents",
+			Handler:    _GophKeeper_ListAuditEvents_Handler,
+		},
+		{
+			MethodName: "GetUsage",
+			Handler:    _GophKeeper_GetUsage_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _GophKeeper_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/gophkeeper.proto",
 }